@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"net/netip"
+	"strconv"
+)
+
+// decimalOctets holds the decimal representation of every byte value, to
+// format IPv4 addresses without dividing.
+var decimalOctets = func() (octets [256]string) {
+	for i := range octets {
+		octets[i] = strconv.Itoa(i)
+	}
+	return octets
+}()
+
+// hexDigits are the digits of the groups of an IPv6 address.
+const hexDigits = "0123456789abcdef"
+
+// appendAddr appends the text form of addr to b, exactly as addr.String would
+// return it, without allocating.
+func appendAddr(b []byte, addr netip.Addr) []byte {
+	switch {
+	case addr.Is4():
+		return appendIPv4(b, addr.As4())
+	case addr.Is4In6():
+		a := addr.As16()
+		b = append(b, "::ffff:"...)
+		b = appendIPv4(b, [4]byte(a[12:]))
+	case addr.Is6():
+		b = appendIPv6(b, addr.As16())
+	default:
+		return append(b, addr.String()...)
+	}
+
+	if zone := addr.Zone(); zone != "" {
+		b = append(b, '%')
+		b = append(b, zone...)
+	}
+
+	return b
+}
+
+// appendAddrPort appends the text form of an address and port to b, as
+// netip.AddrPort.String would return it, such as 192.0.2.1:80 or [2001:db8::1]:80.
+func appendAddrPort(b []byte, addr netip.Addr, port uint16) []byte {
+	if addr.Is4() {
+		b = appendIPv4(b, addr.As4())
+	} else {
+		b = append(b, '[')
+		b = appendAddr(b, addr)
+		b = append(b, ']')
+	}
+
+	b = append(b, ':')
+	return strconv.AppendUint(b, uint64(port), 10)
+}
+
+// appendIPv4 appends an IPv4 address in dotted-decimal form to b.
+func appendIPv4(b []byte, a [4]byte) []byte {
+	b = append(b, decimalOctets[a[0]]...)
+	b = append(b, '.')
+	b = append(b, decimalOctets[a[1]]...)
+	b = append(b, '.')
+	b = append(b, decimalOctets[a[2]]...)
+	b = append(b, '.')
+	return append(b, decimalOctets[a[3]]...)
+}
+
+// appendIPv6 appends an IPv6 address to b in the form recommended by RFC 5952:
+// lowercase groups without leading zeros, the first longest run of two or
+// more zero groups being replaced by "::".
+func appendIPv6(b []byte, a [16]byte) []byte {
+	var groups [8]uint16
+	for i := range groups {
+		groups[i] = uint16(a[2*i])<<8 | uint16(a[2*i+1])
+	}
+
+	zeroStart, zeroEnd := -1, -1
+	for i := 0; i < len(groups); i++ {
+		j := i
+		for j < len(groups) && groups[j] == 0 {
+			j++
+		}
+
+		if n := j - i; n >= 2 && n > zeroEnd-zeroStart {
+			zeroStart, zeroEnd = i, j
+		}
+	}
+
+	for i := 0; i < len(groups); i++ {
+		if i == zeroStart {
+			b = append(b, ':', ':')
+			i = zeroEnd
+			if i >= len(groups) {
+				break
+			}
+		} else if i > 0 {
+			b = append(b, ':')
+		}
+
+		b = appendHexGroup(b, groups[i])
+	}
+
+	return b
+}
+
+// appendHexGroup appends a group of an IPv6 address in hexadecimal, without
+// leading zeros.
+func appendHexGroup(b []byte, g uint16) []byte {
+	switch {
+	case g >= 0x1000:
+		b = append(b, hexDigits[g>>12])
+		fallthrough
+	case g >= 0x100:
+		b = append(b, hexDigits[g>>8&0xf])
+		fallthrough
+	case g >= 0x10:
+		b = append(b, hexDigits[g>>4&0xf])
+	}
+
+	return append(b, hexDigits[g&0xf])
+}
+
+// bufferLender is implemented by buffered writers that lend out the free space
+// of their buffer, such as bufio.Writer and outputWriter.
+type bufferLender interface {
+	AvailableBuffer() []byte
+}
+
+// availableBuffer returns an empty slice to append a line to before passing it
+// to w.Write. When w lends out its buffer, the line is appended in place and
+// not copied again.
+func availableBuffer(w io.Writer) []byte {
+	if lender, ok := w.(bufferLender); ok {
+		return lender.AvailableBuffer()
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// newNextCmd creates the next subcommand.
+func newNextCmd() *cobra.Command {
+	return newAdjacentCmd("next", "following", cidrex.NextPrefix)
+}
+
+// newPrevCmd creates the prev subcommand.
+func newPrevCmd() *cobra.Command {
+	return newAdjacentCmd("prev", "preceding", cidrex.PrevPrefix)
+}
+
+// newAdjacentCmd creates a subcommand printing the blocks of the same size
+// before or after each entry, as computed by step.
+func newAdjacentCmd(name, direction string, step func(netip.Prefix) (netip.Prefix, error)) *cobra.Command {
+	var count int
+
+	cmd := &cobra.Command{
+		Use:   name + " [entry...]",
+		Short: fmt.Sprintf("Print the %s CIDR ranges of the same size", direction),
+		Long: fmt.Sprintf("Print the %s CIDR ranges of the same size.\n\n", direction) +
+			"If no entry is given, entries are read from stdin.",
+		Example: fmt.Sprintf("  cidrex %s 10.0.4.0/22\n", name) +
+			fmt.Sprintf("  cidrex %s -n 4 2001:db8::/48", name),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if count < 1 {
+				return fmt.Errorf("invalid count: %d", count)
+			}
+
+			return runAdjacent(args, count, step)
+		},
+	}
+
+	cmd.Flags().IntVarP(&count, "count", "n", 1, "Number of blocks to print for each entry")
+
+	return cmd
+}
+
+// runAdjacent prints count adjacent blocks for each entry.
+func runAdjacent(args []string, count int, step func(netip.Prefix) (netip.Prefix, error)) error {
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	errs := newTextReporter()
+	err := forEachEntry(args, os.Stdin, func(entry string) error {
+		return adjacentEntry(writer, errs, entry, count, step)
+	})
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return errs.status()
+}
+
+// adjacentEntry prints count adjacent blocks for a single entry. Invalid
+// entries and those with no more blocks before the ends of the address family
+// are reported to errs and skipped.
+func adjacentEntry(w io.Writer, errs *errorReporter, entry string, count int, step func(netip.Prefix) (netip.Prefix, error)) error {
+	t, err := parseEntry(entry)
+	if err != nil {
+		errs.invalid("", 0, entry, entry, err)
+		return nil
+	}
+
+	for _, prefix := range t.prefixes {
+		for i := 0; i < count; i++ {
+			prefix, err = step(prefix)
+			if errors.Is(err, cidrex.ErrOutOfRange) {
+				errs.invalid("", 0, entry, entry, fmt.Errorf("no more blocks: %w", err))
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := printPrefix(w, prefix, t.zone); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printPrefix prints a prefix in CIDR notation, or as a plain address if it
+// holds a single address.
+func printPrefix(w io.Writer, prefix netip.Prefix, zone string) error {
+	if prefix.IsSingleIP() {
+		_, err := fmt.Fprintln(w, prefix.Addr().WithZone(zone))
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, prefix)
+	return err
+}
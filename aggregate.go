@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/netip"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// rangeFormat is implemented by the output formats written from the minimal
+// list of prefixes covering the expanded addresses, such as firewall
+// configurations, rather than from each address in turn.
+type rangeFormat interface {
+	// writePrefixes writes the prefixes, which are disjoint and sorted in
+	// ascending order, IPv4 prefixes first.
+	writePrefixes(w io.Writer, prefixes []netip.Prefix) error
+}
+
+// newRangeFormat returns the rangeFormat for the named output format, or nil
+// if it is not one.
+func newRangeFormat(name string, opts formatOptions) (rangeFormat, error) {
+	switch name {
+	case "ipset":
+		return newIPSetFormat(opts)
+	case "nft":
+		return newNftFormat(opts, true)
+	case "nft-elements":
+		return newNftFormat(opts, false)
+	case "terraform":
+		return newTerraformFormat(opts)
+	case "aws-sg":
+		return newAWSSGFormat(opts)
+	case "pf":
+		return newPFFormat(opts)
+	case "mikrotik":
+		return newMikroTikFormat(opts)
+	default:
+		return nil, nil
+	}
+}
+
+// isRangeFormat reports whether the named output format is written from the
+// aggregated ranges, as listed by newRangeFormat.
+func isRangeFormat(name string) bool {
+	switch name {
+	case "ipset", "nft", "nft-elements", "terraform", "aws-sg", "pf", "mikrotik":
+		return true
+	default:
+		return false
+	}
+}
+
+// aggregator merges the expanded ranges into the minimal list of prefixes
+// covering them, written by a rangeFormat.
+type aggregator struct {
+	format rangeFormat
+	set    rangeSet
+}
+
+// add adds the addresses of a range.
+func (a *aggregator) add(r addrRange) {
+	for _, prefix := range cidrex.RangePrefixes(r.first, r.last) {
+		a.set.addPrefix(prefix)
+	}
+}
+
+// write writes the minimal list of prefixes covering the addresses.
+func (a *aggregator) write(w io.Writer) error {
+	a.set.normalize()
+
+	var prefixes []netip.Prefix
+	for _, r := range a.set.ranges {
+		prefixes = append(prefixes, cidrex.RangePrefixes(r.first, r.last)...)
+	}
+
+	return a.format.writePrefixes(w, prefixes)
+}
+
+// splitFamilies splits sorted prefixes into their IPv4 and IPv6 prefixes.
+func splitFamilies(prefixes []netip.Prefix) (v4, v6 []netip.Prefix) {
+	for i, prefix := range prefixes {
+		if prefix.Addr().Is6() {
+			return prefixes[:i], prefixes[i:]
+		}
+	}
+
+	return prefixes, nil
+}
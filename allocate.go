@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/spf13/cobra"
+)
+
+// newAllocateCmd creates the allocate subcommand.
+func newAllocateCmd() *cobra.Command {
+	var within []string
+	var size string
+	var strategy string
+
+	cmd := &cobra.Command{
+		Use:   "allocate --size /N --within CIDR [filename...]",
+		Short: "Find the next available block of a given size",
+		Long: "Find a free block of the given size within the supernets that does not overlap\n" +
+			"the IP addresses and CIDR ranges listed in the given files, or in stdin if no\n" +
+			"file is given.\n\n" +
+			"The first-fit strategy returns the lowest free block. The best-fit strategy\n" +
+			"takes the block from the smallest free range that can hold it, keeping larger\n" +
+			"ranges available for later allocations.",
+		Example: "  cidrex allocate --size /26 --within 10.0.0.0/16 used.txt\n" +
+			"  cidrex allocate --size /26 --within 10.0.0.0/16 --strategy best used.txt",
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(within) == 0 {
+				return fmt.Errorf("at least one --within is required")
+			}
+			if size == "" {
+				return fmt.Errorf("--size is required")
+			}
+			if strategy != "first" && strategy != "best" {
+				return fmt.Errorf("unknown allocation strategy: %s", strategy)
+			}
+
+			return runAllocate(within, size, strategy, args)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&within, "within", "w", nil, "Supernet in which to allocate (can be repeated)")
+	cmd.Flags().StringVarP(&size, "size", "s", "", "Size of the block to allocate, as a prefix length such as /26")
+	cmd.Flags().StringVar(&strategy, "strategy", "first", "Allocation strategy: first or best")
+
+	return cmd
+}
+
+// runAllocate prints the block allocated from the first supernet that has
+// room for it.
+func runAllocate(within []string, size, strategy string, files []string) error {
+	supernets, err := parseSupernets(within)
+	if err != nil {
+		return err
+	}
+
+	bits, err := parseBlockSize(size, supernets)
+	if err != nil {
+		return err
+	}
+
+	errs := newTextReporter()
+	set, err := readRangeSet(files, errs)
+	if err != nil {
+		return err
+	}
+
+	for _, supernet := range supernets {
+		if block, ok := allocateBlock(set, supernet, bits, strategy == "best"); ok {
+			fmt.Println(block)
+			return errs.status()
+		}
+	}
+
+	return fmt.Errorf("no free /%d block available", bits)
+}
+
+// allocateBlock returns a free block with a prefix length of bits within
+// supernet. Every aligned free block lies within one of the minimal CIDRs
+// covering the free space, so the block is carved from the start of one of
+// them: the first one, or with bestFit, the smallest one.
+func allocateBlock(set *rangeSet, supernet netip.Prefix, bits int, bestFit bool) (netip.Prefix, bool) {
+	free := freePrefixes(set, supernet, bits)
+	if len(free) == 0 {
+		return netip.Prefix{}, false
+	}
+
+	chosen := free[0]
+	if bestFit {
+		for _, prefix := range free[1:] {
+			if prefix.Bits() > chosen.Bits() {
+				chosen = prefix
+			}
+		}
+	}
+
+	return netip.PrefixFrom(chosen.Addr(), bits), true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// defaultAnnotateInterval is the minimum time between two network lookups of
+// --annotate by default, to stay within the rate limits of public services.
+const defaultAnnotateInterval = time.Second
+
+// annotateBatch is the number of records held back to be annotated by a
+// single bulk lookup.
+const annotateBatch = 4096
+
+// annotator annotates the records of addresses with what is known about the
+// network they belong to, for --annotate.
+type annotator interface {
+	annotate(addr netip.Addr) string
+}
+
+// bulkAnnotator is implemented by annotators that look up many addresses
+// faster at once than one by one. prefetch looks up the networks of addrs, so
+// that annotating them takes no further lookup.
+type bulkAnnotator interface {
+	annotator
+	prefetch(addrs []netip.Addr)
+}
+
+// newAnnotator creates the annotator of an --annotate source. Lookups are
+// cached like feeds, as told by feeds, and spaced out by at least interval.
+func newAnnotator(source string, feeds feedCache, interval time.Duration) (annotator, error) {
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid annotation interval: %s", interval)
+	}
+
+	switch source {
+	case "whois":
+		return newWhoisAnnotator(feeds, interval), nil
+	case "cymru":
+		if feeds.offline {
+			return nil, fmt.Errorf("--annotate cymru cannot be combined with --offline, since its lookups are not cached")
+		}
+		return newCymruAnnotator(interval), nil
+	case "ripestat":
+		return newRipeStatAnnotator(feeds, interval), nil
+	default:
+		return nil, fmt.Errorf("unknown annotation source: %s", source)
+	}
+}
+
+// lookupLimiter spaces out network lookups by at least interval.
+type lookupLimiter struct {
+	interval time.Duration
+	last     time.Time
+}
+
+// wait blocks until interval has elapsed since the previous call.
+func (l *lookupLimiter) wait() {
+	if d := l.interval - time.Since(l.last); d > 0 {
+		time.Sleep(d)
+	}
+	l.last = time.Now()
+}
+
+// annotatedNetwork is a network that was looked up, and the annotation of its
+// addresses.
+type annotatedNetwork struct {
+	prefix     netip.Prefix
+	annotation string
+}
+
+// networkAnnotations holds the annotations of the networks looked up so far,
+// indexed by prefix.
+type networkAnnotations struct {
+	prefixes    cidrex.Set
+	annotations map[netip.Prefix]string
+}
+
+// get returns the annotation of the most specific network holding addr, and
+// whether one was looked up.
+func (c *networkAnnotations) get(addr netip.Addr) (string, bool) {
+	prefix, ok := c.prefixes.ContainingPrefix(addr)
+	if !ok {
+		return "", false
+	}
+
+	return c.annotations[prefix], true
+}
+
+// add records the annotation of the addresses of prefix.
+func (c *networkAnnotations) add(prefix netip.Prefix, annotation string) {
+	if c.annotations == nil {
+		c.annotations = make(map[netip.Prefix]string)
+	}
+
+	prefix = prefix.Masked()
+	c.prefixes.Add(prefix)
+	c.annotations[prefix] = annotation
+}
+
+// annotationBlock returns the /24 or /64 holding addr, which stands for its
+// network when it cannot be looked up.
+func annotationBlock(addr netip.Addr) netip.Prefix {
+	if addr.Is4() {
+		return netip.PrefixFrom(addr, defaultGroupBits4).Masked()
+	}
+
+	return netip.PrefixFrom(addr, defaultGroupBits6).Masked()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// defaultAnsibleGroup is the group of the hosts written by the ansible output
+// formats.
+const defaultAnsibleGroup = "cidrex"
+
+// ansibleNameRegex matches the names Ansible accepts for groups and variables.
+var ansibleNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ansibleVar is a group variable of an Ansible inventory.
+type ansibleVar struct {
+	name  string
+	value string
+}
+
+// ansibleFormatter writes records as the hosts of a group of an Ansible
+// inventory, in INI or in YAML. Hosts are named after their address, or, with
+// a hostname template, after their hostname with an ansible_host variable
+// holding the address. Group variables follow the hosts.
+type ansibleFormatter struct {
+	group string
+	vars  []ansibleVar
+	names *hostnameGenerator
+	yaml  bool
+}
+
+// newAnsibleFormatter creates an ansibleFormatter writing YAML if yaml is set.
+func newAnsibleFormatter(opts formatOptions, yaml bool) (*ansibleFormatter, error) {
+	if opts.ports {
+		return nil, fmt.Errorf("ansible output cannot be combined with --ports")
+	}
+
+	if !ansibleNameRegex.MatchString(opts.ansibleGroup) {
+		return nil, fmt.Errorf("invalid Ansible group name: %s", opts.ansibleGroup)
+	}
+
+	f := &ansibleFormatter{group: opts.ansibleGroup, yaml: yaml}
+
+	if opts.hostname != "" {
+		template, err := newHostnameTemplate(opts.hostname)
+		if err != nil {
+			return nil, err
+		}
+		f.names = newHostnameGenerator(template)
+	}
+
+	for _, v := range opts.ansibleVars {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || !ansibleNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid group variable, expected name=value: %s", v)
+		}
+		f.vars = append(f.vars, ansibleVar{name: name, value: value})
+	}
+
+	return f, nil
+}
+
+func (f *ansibleFormatter) writeHeader(w io.Writer) error {
+	if f.yaml {
+		_, err := fmt.Fprintf(w, "all:\n  children:\n    %s:\n      hosts:\n", f.group)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "[%s]\n", f.group)
+	return err
+}
+
+func (f *ansibleFormatter) write(w io.Writer, rec record) error {
+	line := availableBuffer(w)
+
+	if f.yaml {
+		// Hosts are quoted, since IPv6 addresses hold colons
+		line = append(line, "        "...)
+		if f.names != nil {
+			line = appendJSONString(line, f.names.next(rec))
+			line = append(line, ":\n          ansible_host: "...)
+		}
+		line = appendJSONAddr(line, rec.addr)
+		if f.names == nil {
+			line = append(line, ':')
+		}
+	} else {
+		if f.names != nil {
+			line = append(line, f.names.next(rec)...)
+			line = append(line, " ansible_host="...)
+		}
+		line = appendAddr(line, rec.addr)
+	}
+
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
+
+// writeFooter writes the group variables, if any.
+func (f *ansibleFormatter) writeFooter(w io.Writer) error {
+	if len(f.vars) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	if f.yaml {
+		b.WriteString("      vars:\n")
+		for _, v := range f.vars {
+			fmt.Fprintf(&b, "        %s: %s\n", v.name, appendJSONString(nil, v.value))
+		}
+	} else {
+		fmt.Fprintf(&b, "\n[%s:vars]\n", f.group)
+		for _, v := range f.vars {
+			fmt.Fprintf(&b, "%s=%s\n", v.name, v.value)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
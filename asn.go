@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ripeStatURL is the RIPEstat endpoint listing the prefixes announced by an
+// autonomous system.
+const ripeStatURL = "https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS%d"
+
+// parseASN parses an autonomous system number written as AS13335, case
+// insensitively.
+func parseASN(s string) (uint32, bool) {
+	if len(s) < 3 || !strings.EqualFold(s[:2], "AS") {
+		return 0, false
+	}
+
+	asn, err := strconv.ParseUint(s[2:], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint32(asn), true
+}
+
+// asnPrefixes returns the prefixes announced by an autonomous system according
+// to RIPEstat. Responses are cached like feeds.
+func asnPrefixes(asn uint32, cache feedCache) ([]netip.Prefix, error) {
+	data, err := readFeed(fmt.Sprintf(ripeStatURL, asn), cache)
+	if errors.Is(err, errNotCached) {
+		return nil, fmt.Errorf("prefixes of AS%d are %w", asn, errNotCached)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid RIPEstat response for AS%d: %w", asn, err)
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(resp.Data.Prefixes))
+	for _, p := range resp.Data.Prefixes {
+		prefix, err := netip.ParsePrefix(p.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix in RIPEstat response for AS%d: %s", asn, p.Prefix)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// asnResolver resolves ASN entries, remembering the prefixes of each
+// autonomous system for the rest of the run.
+type asnResolver struct {
+	feeds feedCache
+	cache map[uint32][]netip.Prefix
+}
+
+// newASNResolver creates an asnResolver using cached responses as told by
+// feeds.
+func newASNResolver(feeds feedCache) *asnResolver {
+	return &asnResolver{feeds: feeds, cache: make(map[uint32][]netip.Prefix)}
+}
+
+// resolve returns the prefixes announced by asn.
+func (r *asnResolver) resolve(asn uint32) ([]netip.Prefix, error) {
+	if prefixes, ok := r.cache[asn]; ok {
+		return prefixes, nil
+	}
+
+	prefixes, err := asnPrefixes(asn, r.feeds)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache[asn] = prefixes
+
+	return prefixes, nil
+}
+
+// newASNCmd creates the asn subcommand.
+func newASNCmd() *cobra.Command {
+	var ttl time.Duration
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:   "asn ASN...",
+		Short: "Print the prefixes announced by autonomous systems",
+		Long: "Print the prefixes announced by autonomous systems, such as AS13335, according\n" +
+			"to RIPEstat.\n\n" +
+			"ASNs can also be used directly in the input of the expand command.",
+		Example: "  cidrex asn AS13335\n" +
+			"  cidrex asn AS13335 | cidrex expand -4",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runASN(args, feedCache{ttl: ttl, offline: offline})
+		},
+	}
+
+	cmd.Flags().DurationVar(&ttl, "cache-ttl", defaultFeedTTL, "How long RIPEstat responses are cached before being fetched again")
+	cmd.Flags().BoolVar(&offline, "offline", false, "Only use the cached RIPEstat responses, whatever their age, never going to the network")
+
+	return cmd
+}
+
+// runASN prints the prefixes of each autonomous system, using cached
+// responses as told by feeds.
+func runASN(args []string, feeds feedCache) error {
+	var asns []uint32
+	for _, arg := range args {
+		asn, ok := parseASN(arg)
+		if !ok {
+			return fmt.Errorf("invalid ASN: %s", arg)
+		}
+		asns = append(asns, asn)
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+	resolver := newASNResolver(feeds)
+
+	for _, asn := range asns {
+		prefixes, err := resolver.resolve(asn)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+
+		for _, prefix := range prefixes {
+			if _, err := fmt.Fprintln(writer, prefix); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxBraceEntries bounds the number of entries a single entry can expand to
+// through braces, so that a typo cannot exhaust memory.
+const maxBraceEntries = 1 << 16
+
+// expandBraces expands the braces of an entry like a shell does, before it is
+// parsed: 10.{1,2}.0.0/16 stands for 10.1.0.0/16 and 10.2.0.0/16, and
+// 10.{1..5}.0.0/16 for the sequence from 10.1.0.0/16 to 10.5.0.0/16.
+// Sequences can have a step, as in {0..255..16}, and are hexadecimal when an
+// end holds a letter, as in 2001:db8:{a..f}::/48. Braces can be nested, and
+// several braces yield every combination.
+func expandBraces(entry string) ([]string, error) {
+	open := strings.IndexByte(entry, '{')
+	if open < 0 {
+		if strings.Contains(entry, "}") {
+			return nil, fmt.Errorf("unbalanced braces")
+		}
+		return []string{entry}, nil
+	}
+
+	// Find the matching brace, and the commas separating the alternatives
+	closing := -1
+	commas := []int{}
+	depth := 0
+scan:
+	for i := open; i < len(entry); i++ {
+		switch entry[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				closing = i
+				break scan
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	if closing < 0 {
+		return nil, fmt.Errorf("unbalanced braces")
+	}
+
+	prefix, body, suffix := entry[:open], entry[open+1:closing], entry[closing+1:]
+
+	var alternatives []string
+	if len(commas) > 0 {
+		start := open + 1
+		for _, comma := range append(commas, closing) {
+			expanded, err := expandBraces(strings.TrimSpace(entry[start:comma]))
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, expanded...)
+			start = comma + 1
+		}
+	} else {
+		var err error
+		if alternatives, err = braceSequence(body); err != nil {
+			return nil, err
+		}
+	}
+
+	suffixes, err := expandBraces(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(alternatives)*len(suffixes) > maxBraceEntries {
+		return nil, fmt.Errorf("braces expand to more than %d entries", maxBraceEntries)
+	}
+
+	entries := make([]string, 0, len(alternatives)*len(suffixes))
+	for _, alternative := range alternatives {
+		for _, s := range suffixes {
+			entries = append(entries, prefix+alternative+s)
+		}
+	}
+
+	return entries, nil
+}
+
+// braceSequence returns the numbers of a sequence such as 1..5 or 0..255..16,
+// in hexadecimal if an end holds a letter, as in a..f. Like in bash, when an
+// end has a leading zero, as in 08..10, the numbers are padded with zeros to
+// the width of the wider end.
+func braceSequence(body string) ([]string, error) {
+	parts := strings.Split(body, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("invalid brace expression: {%s}", body)
+	}
+
+	base := 10
+	if strings.ContainsAny(strings.ToLower(parts[0]+parts[1]), "abcdef") {
+		base = 16
+	}
+
+	first, err := strconv.ParseUint(parts[0], base, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid brace expression: {%s}", body)
+	}
+	last, err := strconv.ParseUint(parts[1], base, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid brace expression: {%s}", body)
+	}
+
+	step := uint64(1)
+	if len(parts) == 3 {
+		if step, err = strconv.ParseUint(parts[2], 10, 64); err != nil || step == 0 {
+			return nil, fmt.Errorf("invalid brace step: {%s}", body)
+		}
+	}
+
+	// Sequences count down when the first end is the larger one
+	span := last - first
+	if first > last {
+		span = first - last
+	}
+	if span/step >= maxBraceEntries {
+		return nil, fmt.Errorf("braces expand to more than %d entries", maxBraceEntries)
+	}
+
+	width := 0
+	if isZeroPadded(parts[0]) || isZeroPadded(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	numbers := make([]string, 0, span/step+1)
+	for i := uint64(0); i <= span/step; i++ {
+		n := first + i*step
+		if first > last {
+			n = first - i*step
+		}
+
+		number := strconv.FormatUint(n, base)
+		if len(number) < width {
+			number = strings.Repeat("0", width-len(number)) + number
+		}
+		numbers = append(numbers, number)
+	}
+
+	return numbers, nil
+}
+
+// isZeroPadded reports whether a number of a brace sequence has a leading
+// zero.
+func isZeroPadded(s string) bool {
+	return len(s) > 1 && s[0] == '0'
+}
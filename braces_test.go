@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+	}{
+		{"10.0.0.0/8", "[10.0.0.0/8]"},
+		{"10.{1,2}.0.0/16", "[10.1.0.0/16 10.2.0.0/16]"},
+		{"10.{1, 2}.0.0/16", "[10.1.0.0/16 10.2.0.0/16]"},
+		{"10.{1..3}.0.0/16", "[10.1.0.0/16 10.2.0.0/16 10.3.0.0/16]"},
+		{"10.{3..1}.0.0/16", "[10.3.0.0/16 10.2.0.0/16 10.1.0.0/16]"},
+		{"10.0.0.{0..255..64}", "[10.0.0.0 10.0.0.64 10.0.0.128 10.0.0.192]"},
+		{"10.0.0.{10..1..4}", "[10.0.0.10 10.0.0.6 10.0.0.2]"},
+		{"2001:db8:{a..c}::/48", "[2001:db8:a::/48 2001:db8:b::/48 2001:db8:c::/48]"},
+		{"2001:db8:{9..b}::/48", "[2001:db8:9::/48 2001:db8:a::/48 2001:db8:b::/48]"},
+		{"10.{1,{5..6}}.0.0", "[10.1.0.0 10.5.0.0 10.6.0.0]"},
+		{"host{08..10}", "[host08 host09 host10]"},
+		{"host{8..010}", "[host008 host009 host010]"},
+		{"host{10..08..2}", "[host10 host08]"},
+		{"host{0..2}", "[host0 host1 host2]"},
+		{"2001:db8::{0a..0c}", "[2001:db8::0a 2001:db8::0b 2001:db8::0c]"},
+		{"{10,11}.{1,2}.0.0", "[10.1.0.0 10.2.0.0 11.1.0.0 11.2.0.0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := expandBraces(tt.entry)
+			if s := fmt.Sprint(got); err != nil || s != tt.want {
+				t.Errorf("expandBraces(%s) = %s, %v, want %s", tt.entry, s, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandBracesErrors(t *testing.T) {
+	tests := []string{
+		"10.{1,2.0.0",
+		"10.1}.0.0",
+		"10.{1}.0.0",
+		"10.{1..2..3..4}.0.0",
+		"10.{x..y}.0.0",
+		"10.{1..5..0}.0.0",
+		"10.{0..65536}.0.0",
+		"{0..255}.{0..255}.{0..1}.0",
+	}
+
+	for _, entry := range tests {
+		t.Run(entry, func(t *testing.T) {
+			if got, err := expandBraces(entry); err == nil {
+				t.Errorf("expandBraces(%s) = %v, want an error", entry, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+)
+
+// defaultChunkSize is the number of CIDRs per chunk of the terraform and
+// aws-sg outputs, which is the default number of inbound rules per AWS
+// security group.
+const defaultChunkSize = 60
+
+// terraformFormat writes the prefixes as Terraform locals holding lists of
+// CIDR blocks, split into chunks of at most size blocks, for use with
+// for_each in cidr_blocks and ipv6_cidr_blocks arguments. The locals are named
+// after the set name, as in cidrex_cidr_blocks and cidrex_ipv6_cidr_blocks.
+type terraformFormat struct {
+	name string
+	size int
+}
+
+// newTerraformFormat creates a terraformFormat for the set name and chunk size
+// in opts.
+func newTerraformFormat(opts formatOptions) (*terraformFormat, error) {
+	if opts.chunkSize < 1 {
+		return nil, fmt.Errorf("invalid chunk size: %d", opts.chunkSize)
+	}
+
+	return &terraformFormat{name: opts.setName, size: opts.chunkSize}, nil
+}
+
+func (f *terraformFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	v4, v6 := splitFamilies(prefixes)
+
+	if _, err := fmt.Fprintln(w, "locals {"); err != nil {
+		return err
+	}
+
+	if err := f.writeChunks(w, f.name+"_cidr_blocks", v4); err != nil {
+		return err
+	}
+
+	if err := f.writeChunks(w, f.name+"_ipv6_cidr_blocks", v6); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// writeChunks writes a local holding the chunks of prefixes.
+func (f *terraformFormat) writeChunks(w io.Writer, local string, prefixes []netip.Prefix) error {
+	if _, err := fmt.Fprintf(w, "  %s = [\n", local); err != nil {
+		return err
+	}
+
+	for chunk := range slices.Chunk(prefixes, f.size) {
+		if _, err := fmt.Fprintln(w, "    ["); err != nil {
+			return err
+		}
+
+		for _, prefix := range chunk {
+			if _, err := fmt.Fprintf(w, "      %q,\n", prefix.String()); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, "    ],"); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "  ]")
+	return err
+}
+
+// awsSGFormat writes the prefixes as AWS security group ingress permissions,
+// as taken by "aws ec2 authorize-security-group-ingress --ip-permissions".
+// Each line is the JSON array of permissions of one security group, allowing
+// all traffic from at most size CIDRs. The tag, if any, is the description of
+// every CIDR.
+type awsSGFormat struct {
+	size int
+	tag  string
+}
+
+// newAWSSGFormat creates an awsSGFormat for the chunk size and tag in opts.
+func newAWSSGFormat(opts formatOptions) (*awsSGFormat, error) {
+	if opts.chunkSize < 1 {
+		return nil, fmt.Errorf("invalid chunk size: %d", opts.chunkSize)
+	}
+
+	return &awsSGFormat{size: opts.chunkSize, tag: opts.tag}, nil
+}
+
+// awsPermission is an IpPermission of the EC2 API.
+type awsPermission struct {
+	IPProtocol string         `json:"IpProtocol"`
+	IPRanges   []awsIPRange   `json:"IpRanges,omitempty"`
+	IPv6Ranges []awsIPv6Range `json:"Ipv6Ranges,omitempty"`
+}
+
+// awsIPRange is an IpRange of the EC2 API.
+type awsIPRange struct {
+	CidrIP      string `json:"CidrIp"`
+	Description string `json:"Description,omitempty"`
+}
+
+// awsIPv6Range is an Ipv6Range of the EC2 API.
+type awsIPv6Range struct {
+	CidrIPv6    string `json:"CidrIpv6"`
+	Description string `json:"Description,omitempty"`
+}
+
+func (f *awsSGFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	encoder := json.NewEncoder(w)
+
+	for chunk := range slices.Chunk(prefixes, f.size) {
+		perm := awsPermission{IPProtocol: "-1"}
+
+		for _, prefix := range chunk {
+			if prefix.Addr().Is4() {
+				perm.IPRanges = append(perm.IPRanges, awsIPRange{CidrIP: prefix.String(), Description: f.tag})
+			} else {
+				perm.IPv6Ranges = append(perm.IPv6Ranges, awsIPv6Range{CidrIPv6: prefix.String(), Description: f.tag})
+			}
+		}
+
+		if err := encoder.Encode([]awsPermission{perm}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// confirmThreshold is the number of addresses above which printing them to a
+// terminal must be confirmed, unless --yes is given.
+const confirmThreshold = 100000
+
+// confirmation asks before flooding a terminal with addresses. The addresses
+// of the ranges about to be printed are counted, and printing the range that
+// takes the count above the threshold only goes on once agreed to. The
+// question is asked on the controlling terminal, since stdin may be the input.
+type confirmation struct {
+	threshold *big.Int
+	count     *big.Int
+	confirmed bool
+
+	// flush writes out the addresses printed so far, so that they are not
+	// mixed with the question
+	flush func() error
+
+	// done is closed when the run is interrupted, to stop waiting for an
+	// answer
+	done <-chan struct{}
+}
+
+// newConfirmation creates a confirmation asked above threshold addresses.
+func newConfirmation(threshold uint64, flush func() error) *confirmation {
+	return &confirmation{
+		threshold: new(big.Int).SetUint64(threshold),
+		count:     new(big.Int),
+		flush:     flush,
+	}
+}
+
+// check counts the addresses of a range about to be printed, and asks whether
+// to go on if the count goes above the threshold. It returns an exitError if
+// the answer is no.
+func (c *confirmation) check(r addrRange) error {
+	if c.confirmed {
+		return nil
+	}
+
+	c.count.Add(c.count, rangeSize(r))
+	if c.count.Cmp(c.threshold) <= 0 {
+		return nil
+	}
+	c.confirmed = true
+
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		// There is nobody to ask
+		return nil
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "about to print %s addresses — continue? [y/N] ", groupDigits(c.count.String()))
+
+	answer, err := bufio.NewReader(newCancelReader(tty, c.done)).ReadString('\n')
+	if err == errInterrupted {
+		fmt.Fprintln(tty)
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return &exitError{code: exitFatal}
+	}
+}
+
+// groupDigits separates the thousands of a decimal number with commas, such
+// as 16,777,216.
+func groupDigits(s string) string {
+	var b strings.Builder
+	for i, digit := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+
+	return b.String()
+}
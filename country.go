@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// ripeStatCountryURL is the RIPEstat endpoint listing the resources allocated
+// or assigned to a country.
+const ripeStatCountryURL = "https://stat.ripe.net/data/country-resource-list/data.json?resource=%s"
+
+// countryOptions holds the command-line options of the country command.
+type countryOptions struct {
+	ipv4    bool
+	ipv6    bool
+	expand  bool
+	rirFile string
+	ttl     time.Duration
+	offline bool
+}
+
+// newCountryCmd creates the country subcommand.
+func newCountryCmd() *cobra.Command {
+	opts := &countryOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "country CC...",
+		Short: "Print the prefixes allocated to countries",
+		Long: "Print the prefixes allocated or assigned to countries, given as ISO 3166\n" +
+			"two-letter codes, according to RIPEstat or to a local RIR delegation file.\n\n" +
+			"RIR delegation files, such as delegated-ripencc-extended-latest, can be\n" +
+			"downloaded from the FTP servers of the regional Internet registries.",
+		Example: "  cidrex country NL DE\n" +
+			"  cidrex country -4 --expand LU\n" +
+			"  cidrex country --rir-file delegated-ripencc-extended-latest NL",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runCountry(opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 prefixes")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 prefixes")
+	flags.BoolVarP(&opts.expand, "expand", "e", false, "Print every address instead of the prefixes")
+	flags.StringVar(&opts.rirFile, "rir-file", "", "Read the allocations from this RIR delegation file instead of RIPEstat")
+	flags.DurationVar(&opts.ttl, "cache-ttl", defaultFeedTTL, "How long RIPEstat responses are cached before being fetched again")
+	flags.BoolVar(&opts.offline, "offline", false, "Only use the cached RIPEstat responses, whatever their age, never going to the network")
+
+	return cmd
+}
+
+// runCountry prints the prefixes of each country.
+func runCountry(opts *countryOptions, args []string) error {
+	var codes []string
+	for _, arg := range args {
+		if len(arg) != 2 || !isLetter(arg[0]) || !isLetter(arg[1]) {
+			return fmt.Errorf("invalid country code: %s", arg)
+		}
+		codes = append(codes, strings.ToUpper(arg))
+	}
+
+	var prefixes []netip.Prefix
+	if opts.rirFile != "" {
+		var err error
+		if prefixes, err = readDelegations(opts.rirFile, codes); err != nil {
+			return err
+		}
+	} else {
+		for _, code := range codes {
+			p, err := countryPrefixes(code, feedCache{ttl: opts.ttl, offline: opts.offline})
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, p...)
+		}
+	}
+
+	includeIPv4 := opts.ipv4 || !opts.ipv4 && !opts.ipv6
+	includeIPv6 := opts.ipv6 || !opts.ipv4 && !opts.ipv6
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	for _, prefix := range prefixes {
+		if !(includeIPv4 && prefix.Addr().Is4()) && !(includeIPv6 && prefix.Addr().Is6()) {
+			continue
+		}
+
+		var err error
+		if opts.expand {
+			err = printAddrs(writer, prefix)
+		} else {
+			_, err = fmt.Fprintln(writer, prefix)
+		}
+
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// isLetter reports whether c is an ASCII letter.
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// printAddrs prints every address of a prefix.
+func printAddrs(w io.Writer, prefix netip.Prefix) error {
+	last := cidrex.LastAddr(prefix)
+
+	for addr := prefix.Addr(); ; addr = addr.Next() {
+		if _, err := fmt.Fprintln(w, addr); err != nil {
+			return err
+		}
+
+		if addr == last {
+			return nil
+		}
+	}
+}
+
+// countryPrefixes returns the prefixes allocated to a country according to
+// RIPEstat. Responses are cached like feeds, and used as told by cache.
+func countryPrefixes(code string, cache feedCache) ([]netip.Prefix, error) {
+	data, err := readFeed(fmt.Sprintf(ripeStatCountryURL, code), cache)
+	if errors.Is(err, errNotCached) {
+		return nil, fmt.Errorf("allocations of %s are %w", code, errNotCached)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Resources struct {
+				IPv4 []string `json:"ipv4"`
+				IPv6 []string `json:"ipv6"`
+			} `json:"resources"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid RIPEstat response for %s: %w", code, err)
+	}
+
+	var prefixes []netip.Prefix
+	for _, resource := range append(resp.Data.Resources.IPv4, resp.Data.Resources.IPv6...) {
+		p, err := parseResource(resource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource in RIPEstat response for %s: %s", code, resource)
+		}
+		prefixes = append(prefixes, p...)
+	}
+
+	return prefixes, nil
+}
+
+// parseResource parses a resource listed by RIPEstat, which is either a prefix
+// or a first-last range of addresses.
+func parseResource(s string) ([]netip.Prefix, error) {
+	if firstPart, lastPart, ok := strings.Cut(s, "-"); ok {
+		first, err := netip.ParseAddr(firstPart)
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := netip.ParseAddr(lastPart)
+		if err != nil || first.BitLen() != last.BitLen() || last.Less(first) {
+			return nil, fmt.Errorf("invalid range: %s", s)
+		}
+
+		return cidrex.RangePrefixes(first, last), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return []netip.Prefix{prefix.Masked()}, nil
+}
+
+// readDelegations reads the IPv4 and IPv6 allocations and assignments of the
+// given countries from an RIR delegation file. Lines have the form
+// registry|cc|type|start|value|date|status, where value is the number of
+// addresses for IPv4 and the prefix length for IPv6.
+func readDelegations(filename string, codes []string) ([]netip.Prefix, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	wanted := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		wanted[code] = true
+	}
+
+	var prefixes []netip.Prefix
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 7 || !wanted[strings.ToUpper(fields[1])] {
+			continue
+		}
+
+		if status := fields[6]; status != "allocated" && status != "assigned" {
+			continue
+		}
+
+		p, err := parseDelegation(fields[2], fields[3], fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delegation in %s: %s: %w", filename, scanner.Text(), err)
+		}
+		prefixes = append(prefixes, p...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefixes, nil
+}
+
+// parseDelegation returns the prefixes of a single delegation record. Records
+// of other types than ipv4 and ipv6 yield no prefixes.
+func parseDelegation(kind, start, value string) ([]netip.Prefix, error) {
+	if kind != "ipv4" && kind != "ipv6" {
+		return nil, nil
+	}
+
+	first, err := netip.ParseAddr(start)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == "ipv6" {
+		prefix, err := first.Prefix(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return []netip.Prefix{prefix}, nil
+	}
+
+	if n == 0 {
+		return nil, fmt.Errorf("empty delegation")
+	}
+
+	last, err := cidrex.Shift(first, new(big.Int).SetUint64(n-1))
+	if err != nil {
+		return nil, err
+	}
+
+	return cidrex.RangePrefixes(first, last), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// newCoversCmd creates the covers subcommand.
+func newCoversCmd() *cobra.Command {
+	var targets []string
+
+	cmd := &cobra.Command{
+		Use:   "covers --target CIDR [filename...]",
+		Short: "Check whether a set of ranges fully covers target prefixes",
+		Long: "Check whether the IP addresses and CIDR ranges listed in the given files, or\n" +
+			"in stdin if no file is given, fully cover the target prefixes.\n\n" +
+			"The uncovered gaps are printed to stdout as CIDRs, and a summary for each target\n" +
+			"is printed to stderr. The exit status is 0 if every target is fully covered,\n" +
+			"and 4 otherwise.",
+		Example: "  cidrex covers --target 10.0.0.0/16 allocations.txt\n" +
+			"  cat routes.txt | cidrex covers --target 10.0.0.0/8 --target 172.16.0.0/12",
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(targets) == 0 {
+				return fmt.Errorf("at least one --target is required")
+			}
+
+			return runCovers(targets, args)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&targets, "target", "t", nil, "Prefix that must be covered (can be repeated)")
+
+	return cmd
+}
+
+// runCovers checks each target against the ranges read from files.
+func runCovers(targets []string, files []string) error {
+	// Parse the targets first to fail early on typos
+	prefixes, err := parseSupernets(targets)
+	if err != nil {
+		return err
+	}
+
+	errs := newTextReporter()
+	set, err := readRangeSet(files, errs)
+	if err != nil {
+		return err
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	covered := true
+	for _, target := range prefixes {
+		gaps := freePrefixes(set, target, target.Addr().BitLen())
+		for _, gap := range gaps {
+			if _, err := fmt.Fprintln(writer, gap); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+
+		if len(gaps) == 0 {
+			slog.Info("target fully covered", "prefix", target, "covered", true)
+		} else {
+			slog.Info("target not fully covered", "prefix", target, "covered", false, "gaps", len(gaps))
+			covered = false
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if !covered {
+		return &exitError{code: exitCheckFailed}
+	}
+
+	return errs.status()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// loadCryptoPAn reads a Crypto-PAn key from the named file, holding either the
+// 32 bytes of the key or their hexadecimal encoding, and creates the
+// pseudonymizer.
+func loadCryptoPAn(filename string) (*cidrex.CryptoPAn, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Crypto-PAn key: %w", err)
+	}
+
+	key := data
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 2*cidrex.CryptoPAnKeySize {
+		if decoded, err := hex.DecodeString(string(trimmed)); err == nil {
+			key = decoded
+		}
+	}
+
+	pan, err := cidrex.NewCryptoPAn(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use %s: %w", filename, err)
+	}
+
+	return pan, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cymruAddr is the whois server of the IP to ASN mapping service of Team Cymru.
+const cymruAddr = "whois.cymru.com:43"
+
+// cymruTimeout bounds the time spent on a single bulk query.
+const cymruTimeout = 60 * time.Second
+
+// cymruAnnotator annotates addresses with the origin AS, country, registry
+// and BGP prefix of their network, as mapped by Team Cymru. Addresses are
+// looked up in bulk, as many in a single query as the records held back for
+// it, and only one address of each /24 or /64 is sent.
+type cymruAnnotator struct {
+	limiter  lookupLimiter
+	networks networkAnnotations
+}
+
+// newCymruAnnotator creates a cymruAnnotator spacing out queries by at least
+// interval.
+func newCymruAnnotator(interval time.Duration) *cymruAnnotator {
+	return &cymruAnnotator{limiter: lookupLimiter{interval: interval}}
+}
+
+func (a *cymruAnnotator) annotate(addr netip.Addr) string {
+	addr = addr.WithZone("")
+
+	if annotation, ok := a.networks.get(addr); ok {
+		return annotation
+	}
+
+	a.prefetch([]netip.Addr{addr})
+
+	annotation, _ := a.networks.get(addr)
+	return annotation
+}
+
+func (a *cymruAnnotator) prefetch(addrs []netip.Addr) {
+	// Query one address for each block not looked up yet
+	seen := make(map[netip.Prefix]bool)
+	var query []netip.Addr
+	for _, addr := range addrs {
+		addr = addr.WithZone("")
+		block := annotationBlock(addr)
+		if _, ok := a.networks.get(addr); ok || seen[block] {
+			continue
+		}
+		seen[block] = true
+		query = append(query, addr)
+	}
+
+	if len(query) == 0 {
+		return
+	}
+
+	networks, err := a.lookup(query)
+	if err != nil {
+		slog.Warn("unable to look up addresses", "addresses", len(query), "error", err)
+	}
+
+	for _, n := range networks {
+		a.networks.add(n.prefix, n.annotation)
+	}
+
+	// Leave the blocks missing from the response unannotated rather than
+	// querying them again
+	for _, addr := range query {
+		if _, ok := a.networks.get(addr); !ok {
+			a.networks.add(annotationBlock(addr), "")
+		}
+	}
+}
+
+// lookup sends a bulk query for addrs and returns the networks of the
+// response.
+func (a *cymruAnnotator) lookup(addrs []netip.Addr) ([]annotatedNetwork, error) {
+	a.limiter.wait()
+
+	conn, err := net.DialTimeout("tcp", cymruAddr, cymruTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(cymruTimeout)); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("begin\nverbose\n")
+	for _, addr := range addrs {
+		b.WriteString(addr.String())
+		b.WriteByte('\n')
+	}
+	b.WriteString("end\n")
+
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return parseCymru(conn)
+}
+
+// parseCymru parses the response of a verbose bulk query, made of a line for
+// each address such as:
+//
+//	13335   | 1.1.1.1          | 1.1.1.0/24          | AU | apnic    | 2011-08-11 | CLOUDFLARENET, US
+//
+// Addresses that are not announced have an AS and a prefix of NA, and stand
+// for their /24 or /64.
+func parseCymru(r io.Reader) ([]annotatedNetwork, error) {
+	var networks []annotatedNetwork
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) != 7 {
+			// The banner of bulk mode, or an error about a single address
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		addr, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(fields[2])
+		if err != nil || !prefix.Contains(addr) {
+			prefix = annotationBlock(addr)
+		}
+
+		networks = append(networks, annotatedNetwork{prefix: prefix.Masked(), annotation: cymruAnnotation(fields, prefix)})
+	}
+
+	return networks, scanner.Err()
+}
+
+// cymruAnnotation formats the annotation of a network from the fields of its
+// line, such as asn=13335 cc=AU registry=apnic as_name="CLOUDFLARENET, US"
+// cidr=1.1.1.0/24, leaving out the fields that are unknown.
+func cymruAnnotation(fields []string, prefix netip.Prefix) string {
+	var parts []string
+
+	// Prefixes announced by several ASes list all of them
+	if asn, _, _ := strings.Cut(fields[0], " "); asn != "NA" && asn != "" {
+		parts = append(parts, "asn="+asn)
+	}
+	if fields[3] != "" {
+		parts = append(parts, "cc="+fields[3])
+	}
+	if fields[4] != "" {
+		parts = append(parts, "registry="+fields[4])
+	}
+	if fields[6] != "" && fields[6] != "NA" {
+		parts = append(parts, "as_name="+strconv.Quote(fields[6]))
+	}
+	parts = append(parts, "cidr="+prefix.String())
+
+	return strings.Join(parts, " ")
+}
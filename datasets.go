@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// dataset is an external list of ranges kept in the data directory, such as
+// the bogons or the ranges of a cloud provider. A dataset is downloaded from
+// its URLs, each of which must parse into at least one prefix, and stored as
+// a list of normalized prefixes. It is downloaded again once older than ttl.
+type dataset struct {
+	name        string
+	description string
+	urls        []string
+	ttl         time.Duration
+	parse       func(r io.Reader, set *rangeSet) error
+}
+
+// datasets are the datasets known by name, in the order the update command
+// lists them.
+var datasets = []dataset{
+	{
+		name:        "bogons",
+		description: "Unallocated and reserved address space, by Team Cymru",
+		urls: []string{
+			"https://www.team-cymru.org/Services/Bogons/fullbogons-ipv4.txt",
+			"https://www.team-cymru.org/Services/Bogons/fullbogons-ipv6.txt",
+		},
+		ttl:   12 * time.Hour,
+		parse: parseFeed,
+	},
+	{
+		name:        "aws",
+		description: "Ranges of Amazon Web Services",
+		urls:        []string{"https://ip-ranges.amazonaws.com/ip-ranges.json"},
+		ttl:         24 * time.Hour,
+		parse:       parseCloudRanges,
+	},
+	{
+		name:        "gcp",
+		description: "Ranges of Google Cloud",
+		urls:        []string{"https://www.gstatic.com/ipranges/cloud.json"},
+		ttl:         24 * time.Hour,
+		parse:       parseCloudRanges,
+	},
+	{
+		name:        "cloudflare",
+		description: "Ranges of Cloudflare",
+		urls: []string{
+			"https://www.cloudflare.com/ips-v4",
+			"https://www.cloudflare.com/ips-v6",
+		},
+		ttl:   7 * 24 * time.Hour,
+		parse: parseFeed,
+	},
+	{
+		name:        "rir-delegated",
+		description: "Address space allocated or assigned by the five regional Internet registries",
+		urls: []string{
+			"https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+			"https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+			"https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+			"https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+			"https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+		},
+		ttl:   24 * time.Hour,
+		parse: parseDelegationFile,
+	},
+	{
+		name:        "spamhaus-drop",
+		description: "Spamhaus Don't Route Or Peer lists of hijacked and criminal networks",
+		urls: []string{
+			"https://www.spamhaus.org/drop/drop.txt",
+			"https://www.spamhaus.org/drop/dropv6.txt",
+		},
+		ttl:   12 * time.Hour,
+		parse: parseFeed,
+	},
+	{
+		name:        "firehol-level1",
+		description: "FireHOL level 1 blocklist of attackers and invalid traffic",
+		urls:        []string{"https://raw.githubusercontent.com/firehol/blocklist-ipsets/master/firehol_level1.netset"},
+		ttl:         24 * time.Hour,
+		parse:       parseFeed,
+	},
+}
+
+// findDataset returns the dataset of the given name, and whether there is one.
+func findDataset(name string) (dataset, bool) {
+	for _, d := range datasets {
+		if d.name == name {
+			return d, true
+		}
+	}
+
+	return dataset{}, false
+}
+
+// dataDir returns the directory in which datasets are stored.
+func dataDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate cache directory: %w", err)
+	}
+
+	return filepath.Join(dir, "cidrex", "data"), nil
+}
+
+// path returns the file in which the dataset is stored.
+func (d dataset) path() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, d.name+".txt"), nil
+}
+
+// age returns how long ago the dataset was stored, or an error wrapping
+// fs.ErrNotExist if it never was.
+func (d dataset) age() (time.Duration, error) {
+	path, err := d.path()
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(info.ModTime()), nil
+}
+
+// load returns the stored list of prefixes of the dataset, updating it first
+// if it is older than its ttl. If offline is set, the stored list is used
+// whatever its age, and never updated.
+func (d dataset) load(offline bool) ([]byte, error) {
+	path, err := d.path()
+	if err != nil {
+		return nil, err
+	}
+
+	age, err := d.age()
+	if offline || err == nil && age < d.ttl {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) && offline {
+			return nil, fmt.Errorf("dataset %s was never downloaded and --offline was given, run cidrex update %s first", d.name, d.name)
+		}
+		return data, err
+	}
+
+	data, _, err := d.update()
+	if err != nil {
+		// A stale copy is better than no copy at all
+		if stored, storedErr := os.ReadFile(path); storedErr == nil {
+			slog.Warn("unable to update dataset, using stored copy", "dataset", d.name, "error", err)
+			return stored, nil
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// update downloads the dataset, verifies that each of its URLs yields
+// prefixes, and stores it. It returns the stored list and the number of
+// prefixes in it.
+func (d dataset) update() ([]byte, int, error) {
+	set := &rangeSet{}
+
+	for _, url := range d.urls {
+		data, err := downloadFeed(url)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		before := set.set.Len()
+		if err := d.parse(bytes.NewReader(data), set); err != nil {
+			return nil, 0, fmt.Errorf("unable to parse %s: %w", url, err)
+		}
+		if set.set.Len() == before {
+			return nil, 0, fmt.Errorf("no prefixes found in %s", url)
+		}
+	}
+
+	set.normalize()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s: %s\n", d.name, d.description)
+	for _, url := range d.urls {
+		fmt.Fprintf(&b, "# %s\n", url)
+	}
+
+	count := 0
+	for _, r := range set.ranges {
+		for _, prefix := range cidrex.RangePrefixes(r.first, r.last) {
+			fmt.Fprintln(&b, prefix)
+			count++
+		}
+	}
+
+	path, err := d.path()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := writeFileAtomic(path, b.Bytes()); err != nil {
+		return nil, 0, fmt.Errorf("unable to store dataset %s: %w", d.name, err)
+	}
+
+	return b.Bytes(), count, nil
+}
+
+// parseCloudRanges adds the prefixes of the JSON range lists published by
+// Amazon Web Services and Google Cloud to set.
+func parseCloudRanges(r io.Reader, set *rangeSet) error {
+	var ranges struct {
+		Prefixes []struct {
+			IPPrefix   string `json:"ip_prefix"`
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&ranges); err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for _, p := range ranges.Prefixes {
+		prefixes = append(prefixes, p.IPPrefix, p.IPv4Prefix, p.IPv6Prefix)
+	}
+	for _, p := range ranges.IPv6Prefixes {
+		prefixes = append(prefixes, p.IPv6Prefix)
+	}
+
+	for _, s := range prefixes {
+		if s == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid prefix: %s", s)
+		}
+		set.addPrefix(prefix)
+	}
+
+	return nil
+}
+
+// parseDelegationFile adds the IPv4 and IPv6 allocations and assignments of an
+// RIR delegation file to set, like readDelegations does for a few countries.
+func parseDelegationFile(r io.Reader, set *rangeSet) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 7 {
+			continue
+		}
+
+		if status := fields[6]; status != "allocated" && status != "assigned" {
+			continue
+		}
+
+		prefixes, err := parseDelegation(fields[2], fields[3], fields[4])
+		if err != nil {
+			return fmt.Errorf("invalid delegation: %s: %w", scanner.Text(), err)
+		}
+
+		for _, prefix := range prefixes {
+			set.addPrefix(prefix)
+		}
+	}
+
+	return scanner.Err()
+}
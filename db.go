@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// defaultDBBatchSize is the number of rows sent at once to a database.
+const defaultDBBatchSize = 50000
+
+// dbTimeout bounds the time spent sending a single batch to a database.
+const dbTimeout = 5 * time.Minute
+
+// dbFields are the record fields that can be written to database columns, in
+// their default order.
+var dbFields = []string{"ip", "port", "source", "group", "tag", "annotation"}
+
+// dbColumn maps a record field to the column it is written to.
+type dbColumn struct {
+	field string
+	name  string
+}
+
+// parseDBColumns parses a comma-separated list of record fields written to
+// the database, each optionally renamed as field=column. An empty list selects
+// the ip column, plus the fields requested by the other options.
+func parseDBColumns(spec string, opts formatOptions) ([]dbColumn, error) {
+	if spec == "" {
+		columns := []dbColumn{{"ip", "ip"}}
+		if opts.ports {
+			columns = append(columns, dbColumn{"port", "port"})
+		}
+		if opts.source {
+			columns = append(columns, dbColumn{"source", "source"})
+		}
+		if opts.group {
+			columns = append(columns, dbColumn{"group", "group"})
+		}
+		if opts.tag != "" {
+			columns = append(columns, dbColumn{"tag", "tag"})
+		}
+		if opts.annotations {
+			columns = append(columns, dbColumn{"annotation", "annotation"})
+		}
+		return columns, nil
+	}
+
+	var columns []dbColumn
+	for _, part := range strings.Split(spec, ",") {
+		field, name, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			name = field
+		}
+
+		if !slices.Contains(dbFields, field) {
+			return nil, fmt.Errorf("unknown column field %q, expected one of %s", field, strings.Join(dbFields, ", "))
+		}
+		if !identifierRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid column name: %q", name)
+		}
+
+		columns = append(columns, dbColumn{field, name})
+	}
+
+	return columns, nil
+}
+
+// dbSink sends batches of rows to a database table.
+type dbSink interface {
+	insert(rows [][]any) error
+	close() error
+}
+
+// dbFormatter buffers records as rows and sends them to a dbSink in batches.
+// Fields that are not set, such as the port when no ports were requested,
+// are sent as NULL.
+type dbFormatter struct {
+	sink      dbSink
+	columns   []dbColumn
+	tag       string
+	batchSize int
+	rows      [][]any
+}
+
+// newDBFormatter connects to the PostgreSQL or ClickHouse database identified
+// by dsn. PostgreSQL DSNs use the postgres:// or postgresql:// scheme, while
+// ClickHouse DSNs use clickhouse:// and connect to its HTTP interface.
+func newDBFormatter(dsn, columnSpec string, batchSize int, opts formatOptions) (*dbFormatter, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("invalid database batch size: %d", batchSize)
+	}
+
+	table := opts.table
+	if table == "" {
+		table = defaultTable
+	}
+	if !identifierRegex.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+
+	columns, err := parseDBColumns(columnSpec, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	var sink dbSink
+	switch scheme, _, _ := strings.Cut(dsn, "://"); scheme {
+	case "postgres", "postgresql":
+		sink, err = newPostgresSink(dsn, table, names)
+	case "clickhouse":
+		sink, err = newClickHouseSink(dsn, table, names)
+	default:
+		return nil, fmt.Errorf("unsupported database DSN: %s", scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbFormatter{
+		sink:      sink,
+		columns:   columns,
+		tag:       opts.tag,
+		batchSize: batchSize,
+		rows:      make([][]any, 0, batchSize),
+	}, nil
+}
+
+func (f *dbFormatter) write(_ io.Writer, rec record) error {
+	row := make([]any, len(f.columns))
+	for i, column := range f.columns {
+		switch column.field {
+		case "ip":
+			row[i] = rec.addr.String()
+		case "port":
+			if rec.port != 0 {
+				row[i] = int32(rec.port)
+			}
+		case "source":
+			if rec.source != "" {
+				row[i] = rec.source
+			}
+		case "group":
+			if rec.group.IsValid() {
+				row[i] = rec.group.String()
+			}
+		case "tag":
+			if f.tag != "" {
+				row[i] = f.tag
+			}
+		case "annotation":
+			if rec.annotation != "" {
+				row[i] = rec.annotation
+			}
+		}
+	}
+
+	f.rows = append(f.rows, row)
+	if len(f.rows) >= f.batchSize {
+		return f.flush()
+	}
+
+	return nil
+}
+
+// flush sends the buffered rows to the database.
+func (f *dbFormatter) flush() error {
+	if len(f.rows) == 0 {
+		return nil
+	}
+
+	err := f.sink.insert(f.rows)
+	f.rows = f.rows[:0]
+
+	return err
+}
+
+// writeFooter sends the remaining rows and closes the connection.
+func (f *dbFormatter) writeFooter(_ io.Writer) error {
+	err := f.flush()
+
+	if closeErr := f.sink.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// postgresSink inserts rows into PostgreSQL with the COPY protocol.
+type postgresSink struct {
+	conn    *pgx.Conn
+	table   pgx.Identifier
+	columns []string
+}
+
+// newPostgresSink connects to the PostgreSQL database identified by dsn.
+func newPostgresSink(dsn, table string, columns []string) (*postgresSink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	return &postgresSink{conn: conn, table: pgx.Identifier{table}, columns: columns}, nil
+}
+
+func (s *postgresSink) insert(rows [][]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if _, err := s.conn.CopyFrom(ctx, s.table, s.columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("unable to copy rows to database: %w", err)
+	}
+
+	return nil
+}
+
+func (s *postgresSink) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return s.conn.Close(ctx)
+}
+
+// clickHouseSink inserts rows into ClickHouse through its HTTP interface, one
+// INSERT in TabSeparated format per batch. The HTTP interface is used rather
+// than the native protocol so that no driver is needed, at the cost of every
+// value being sent as text for ClickHouse to convert to the column types.
+type clickHouseSink struct {
+	client   *http.Client
+	endpoint string
+	user     *url.Userinfo
+	query    string
+	buf      bytes.Buffer
+}
+
+// newClickHouseSink prepares inserting into the ClickHouse server identified
+// by a DSN of the form clickhouse://[user[:password]@]host[:port][/database].
+// The HTTP port defaults to 8123; add ?secure=true to connect over HTTPS.
+func newClickHouseSink(dsn, table string, columns []string) (*clickHouseSink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database DSN: %w", err)
+	}
+
+	scheme, port := "http", "8123"
+	if secure, _ := strconv.ParseBool(u.Query().Get("secure")); secure {
+		scheme, port = "https", "8443"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "`" + column + "`"
+	}
+
+	target := "`" + table + "`"
+	if database := strings.Trim(u.Path, "/"); database != "" {
+		if !identifierRegex.MatchString(database) {
+			return nil, fmt.Errorf("invalid database name: %q", database)
+		}
+		target = "`" + database + "`." + target
+	}
+
+	endpoint := url.URL{Scheme: scheme, Host: u.Hostname() + ":" + port, Path: "/"}
+
+	return &clickHouseSink{
+		client:   &http.Client{Timeout: dbTimeout},
+		endpoint: endpoint.String(),
+		user:     u.User,
+		query:    fmt.Sprintf("INSERT INTO %s (%s) FORMAT TabSeparated", target, strings.Join(quoted, ", ")),
+	}, nil
+}
+
+func (s *clickHouseSink) insert(rows [][]any) error {
+	s.buf.Reset()
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				s.buf.WriteByte('\t')
+			}
+			s.buf.WriteString(clickHouseField(value))
+		}
+		s.buf.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"?query="+url.QueryEscape(s.query), &s.buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "cidrex")
+
+	if s.user != nil {
+		password, _ := s.user.Password()
+		req.SetBasicAuth(s.user.Username(), password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to insert rows into database: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to insert rows into database: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func (s *clickHouseSink) close() error {
+	return nil
+}
+
+// clickHouseEscaper escapes the special characters of the TabSeparated format
+// with backslashes.
+var clickHouseEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+// clickHouseField formats a value for the TabSeparated format, where NULL is
+// written as \N and special characters are escaped with backslashes.
+func clickHouseField(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return `\N`
+	case string:
+		return clickHouseEscaper.Replace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDNSTimeout is the default time allowed to resolve a hostname.
+const defaultDNSTimeout = 5 * time.Second
+
+// maxCNAMEChain is the number of CNAME records followed when resolving a
+// hostname before giving up.
+const maxCNAMEChain = 8
+
+// errCNAMELoop is returned when the CNAME records of a hostname form a loop.
+var errCNAMELoop = errors.New("CNAME loop")
+
+// isHostname reports whether s is a DNS name, such as www.example.com or
+// localhost, that cannot be mistaken for an address: labels of letters,
+// digits, hyphens and underscores, not starting or ending with a hyphen, the
+// last one not being numeric. A final dot is allowed.
+func isHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	labels := strings.Split(s, ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return strings.ContainsFunc(labels[len(labels)-1], func(c rune) bool {
+		return c < '0' || c > '9'
+	})
+}
+
+// normalizeDomain returns domain in lowercase, without a final dot.
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// dnsResolver resolves hostnames to every one of their A and AAAA records,
+// remembering the addresses of each hostname for the rest of the run.
+type dnsResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+	cache    map[string][]netip.Addr
+}
+
+// newDNSResolver creates a dnsResolver allowing timeout per hostname. Queries
+// are sent to the given servers, written as host or host:port, in turn and
+// retried on the next one on failure, or to the system resolver if none is
+// given.
+func newDNSResolver(servers []string, timeout time.Duration) (*dnsResolver, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid DNS timeout: %s", timeout)
+	}
+
+	r := &dnsResolver{resolver: net.DefaultResolver, timeout: timeout, cache: make(map[string][]netip.Addr)}
+	if len(servers) == 0 {
+		return r, nil
+	}
+
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		if _, err := netip.ParseAddr(server); err == nil || isHostname(server) {
+			server = net.JoinHostPort(server, "53")
+		} else if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, fmt.Errorf("invalid resolver: %s", server)
+		}
+		addrs[i] = server
+	}
+
+	var next atomic.Uint32
+	var dialer net.Dialer
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := addrs[int(next.Add(1)-1)%len(addrs)]
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+
+	return r, nil
+}
+
+// resolve returns the addresses of host, following its CNAME records. The
+// resolvers normally follow them, but answers that stop at a CNAME record are
+// followed up with a query for its target, up to maxCNAMEChain times.
+func (r *dnsResolver) resolve(host string) ([]netip.Addr, error) {
+	key := normalizeDomain(host)
+	if addrs, ok := r.cache[key]; ok {
+		return addrs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	name := key
+	seen := map[string]bool{name: true}
+	for {
+		addrs, err := r.resolver.LookupNetIP(ctx, "ip", name)
+		if err == nil {
+			addrs = normalizeAddrs(addrs)
+			r.cache[key] = addrs
+			return addrs, nil
+		}
+
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return nil, lookupError(err)
+		}
+
+		cname, cnameErr := r.resolver.LookupCNAME(ctx, name)
+		cname = normalizeDomain(cname)
+		if cnameErr != nil || cname == "" || cname == name {
+			return nil, lookupError(err)
+		}
+
+		if seen[cname] {
+			return nil, fmt.Errorf("%w at %s", errCNAMELoop, cname)
+		}
+		if len(seen) > maxCNAMEChain {
+			return nil, fmt.Errorf("more than %d CNAME records", maxCNAMEChain)
+		}
+
+		seen[cname] = true
+		name = cname
+	}
+}
+
+// normalizeAddrs unmaps the IPv4-mapped addresses returned by some resolvers,
+// and sorts the addresses, IPv4 first, so that the output does not depend on
+// the order of the answers.
+func normalizeAddrs(addrs []netip.Addr) []netip.Addr {
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return slices.Compact(addrs)
+}
+
+// txt returns the TXT records of name.
+func (r *dnsResolver) txt(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	records, err := r.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	return records, nil
+}
+
+// mx returns the hostnames of the MX records of name, by preference.
+func (r *dnsResolver) mx(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	records, err := r.resolver.LookupMX(ctx, name)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	hosts := make([]string, 0, len(records))
+	for _, mx := range records {
+		// A null MX record, of host ".", tells that the domain accepts no mail
+		if host := strings.TrimSuffix(mx.Host, "."); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// ns returns the hostnames of the NS records of name.
+func (r *dnsResolver) ns(name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	records, err := r.resolver.LookupNS(ctx, name)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	hosts := make([]string, 0, len(records))
+	for _, ns := range records {
+		hosts = append(hosts, strings.TrimSuffix(ns.Host, "."))
+	}
+
+	return hosts, nil
+}
+
+// ptr returns the names of the PTR records of addr, in lowercase and without
+// a final dot. An address without PTR records has no names.
+func (r *dnsResolver) ptr(addr netip.Addr) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	names, err := r.resolver.LookupAddr(ctx, addr.WithZone("").String())
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, lookupError(err)
+	}
+
+	for i, name := range names {
+		names[i] = normalizeDomain(name)
+	}
+
+	return names, nil
+}
+
+// lookupError returns the reason of a DNS error. The server named by DNS
+// errors is that of the system configuration even when querying others, so
+// it is left out.
+func lookupError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errors.New(dnsErr.Err)
+	}
+
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// rangeCollector is implemented by the outputs computed from the expanded
+// ranges as a whole, rather than from each address in turn.
+type rangeCollector interface {
+	add(r addrRange)
+	write(w io.Writer) error
+}
+
+// dupCounter counts how many input ranges contain each address. It keeps the
+// ranges rather than the addresses, so that large overlapping ranges can be
+// counted without holding every address in memory.
+type dupCounter struct {
+	ranges []addrRange
+}
+
+// add counts the addresses of a range.
+func (c *dupCounter) add(r addrRange) {
+	c.ranges = append(c.ranges, r)
+}
+
+// countEvent marks the start of a range when delta is 1, or the address past
+// its end when delta is -1.
+type countEvent struct {
+	addr  netip.Addr
+	delta int
+}
+
+// write prints every address contained in the ranges once, in ascending order,
+// preceded by the number of ranges containing it, like uniq -c.
+func (c *dupCounter) write(w io.Writer) error {
+	var ipv4, ipv6 []addrRange
+	for _, r := range c.ranges {
+		if r.first.Is4() {
+			ipv4 = append(ipv4, r)
+		} else {
+			ipv6 = append(ipv6, r)
+		}
+	}
+
+	if err := writeCounts(w, ipv4); err != nil {
+		return err
+	}
+
+	return writeCounts(w, ipv6)
+}
+
+// writeCounts prints the addresses of ranges of a single family with their
+// counts, sweeping over the starts and ends of the ranges in address order.
+func writeCounts(w io.Writer, ranges []addrRange) error {
+	events := make([]countEvent, 0, 2*len(ranges))
+	for _, r := range ranges {
+		events = append(events, countEvent{addr: r.first, delta: 1})
+
+		// Ranges reaching the end of the address space never end
+		if end := r.last.Next(); end.IsValid() {
+			events = append(events, countEvent{addr: end, delta: -1})
+		}
+	}
+
+	slices.SortFunc(events, func(a, b countEvent) int {
+		return a.addr.Compare(b.addr)
+	})
+
+	count := 0
+	for i, event := range events {
+		count += event.delta
+
+		// Apply every event at the same address before printing
+		if count == 0 || i+1 < len(events) && events[i+1].addr == event.addr {
+			continue
+		}
+
+		last := cidrex.LastAddr(netip.PrefixFrom(event.addr, 0).Masked())
+		if i+1 < len(events) {
+			last = events[i+1].addr.Prev()
+		}
+
+		for addr := event.addr; ; addr = addr.Next() {
+			if _, err := fmt.Fprintf(w, "%7d %s\n", count, addr); err != nil {
+				return err
+			}
+
+			if addr == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// errorReporter reports the input entries that cannot be parsed, either as
+// warnings logged to stderr or as one JSON object per line written to w.
+type errorReporter struct {
+	w     io.Writer
+	json  bool
+	quiet bool
+	file  *os.File
+
+	// count is the number of entries reported, and firstSource and firstLine
+	// tell where the first one was found
+	count       int
+	firstSource string
+	firstLine   int
+}
+
+// invalidEntry is a rejected input entry as reported in JSON Lines.
+type invalidEntry struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Raw    string `json:"raw"`
+	Entry  string `json:"entry"`
+	Reason string `json:"reason"`
+}
+
+// newTextReporter creates an errorReporter logging warnings, for the commands
+// without an --errors option.
+func newTextReporter() *errorReporter {
+	return &errorReporter{}
+}
+
+// newErrorReporter creates an errorReporter for the given --errors value:
+// "text", "jsonl" or "jsonl:PATH". Errors are written to stderr unless a file
+// is given. With quiet, warnings are counted but not logged.
+func newErrorReporter(spec string, quiet bool) (*errorReporter, error) {
+	name, path, hasPath := strings.Cut(spec, ":")
+
+	switch name {
+	case "text":
+		if hasPath {
+			return nil, fmt.Errorf("--errors text cannot be written to a file")
+		}
+		return &errorReporter{quiet: quiet}, nil
+	case "jsonl":
+	default:
+		return nil, fmt.Errorf("unknown error format: %s", spec)
+	}
+
+	if !hasPath {
+		return &errorReporter{w: os.Stderr, json: true}, nil
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("missing file in error format: %s", spec)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create error file: %w", err)
+	}
+
+	return &errorReporter{w: file, json: true, file: file}, nil
+}
+
+// invalid reports an entry that cannot be parsed, found on the given line of
+// source. raw is the line as read.
+func (r *errorReporter) invalid(source string, line int, raw, entry string, err error) {
+	r.count++
+	if r.count == 1 {
+		r.firstSource, r.firstLine = source, line
+	}
+
+	if !r.json {
+		if !r.quiet {
+			slog.Warn("invalid entry", "source", source, "line", line, "entry", entry, "reason", errorReason(err))
+		}
+		return
+	}
+
+	data, _ := json.Marshal(invalidEntry{
+		Source: source,
+		Line:   line,
+		Raw:    raw,
+		Entry:  entry,
+		Reason: errorReason(err),
+	})
+	r.w.Write(append(data, '\n'))
+}
+
+// status returns an exitError with exitInvalidInput if any entry was reported,
+// and nil otherwise.
+func (r *errorReporter) status() error {
+	if r.count > 0 {
+		return &exitError{code: exitInvalidInput}
+	}
+
+	return nil
+}
+
+// logSummary logs how many entries were expanded and how many were skipped as
+// invalid, if any were.
+func (r *errorReporter) logSummary(expanded uint64) {
+	if r.count == 0 {
+		return
+	}
+
+	slog.Info("skipped invalid entries", "expanded", expanded, "skipped", r.count, "first_source", r.firstSource, "first_line", r.firstLine)
+}
+
+// isInvalidInput reports whether err only tells that invalid entries were
+// skipped, the output being otherwise complete.
+func isInvalidInput(err error) bool {
+	var exit *exitError
+	return errors.As(err, &exit) && exit.code == exitInvalidInput
+}
+
+// Close closes the error file, if any.
+func (r *errorReporter) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	return r.file.Close()
+}
+
+// errorReason describes what was wrong with an entry, without repeating the
+// entry itself.
+func errorReason(err error) string {
+	var parseErr *cidrex.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Err.Error()
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// execPlaceholderRegex matches the placeholders replaced in --exec commands.
+var execPlaceholderRegex = regexp.MustCompile(`\{(ip|port|host|source|tag)\}`)
+
+// execFormatter runs a shell command for every record, with placeholders such
+// as {ip} replaced by the fields of the record. Up to jobs commands run at
+// once, and the output of each command is printed in one piece once it exits.
+type execFormatter struct {
+	command string
+	tag     string
+	timeout time.Duration
+	pool    *jobPool
+
+	// mu serializes writes of the command outputs
+	mu       sync.Mutex
+	timedOut atomic.Int64
+}
+
+// newExecFormatter creates an execFormatter. If the command has no
+// placeholder, the host is appended to it as a last argument. A timeout of 0
+// lets commands run until they exit.
+func newExecFormatter(command string, jobs int, timeout time.Duration, opts formatOptions) (*execFormatter, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid exec timeout: %s", timeout)
+	}
+
+	pool, err := newJobPool(jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	if !execPlaceholderRegex.MatchString(command) {
+		command += " {host}"
+	}
+
+	return &execFormatter{command: command, tag: opts.tag, timeout: timeout, pool: pool}, nil
+}
+
+func (f *execFormatter) write(_ io.Writer, rec record) error {
+	host := rec.addr.String()
+	if rec.port != 0 {
+		host = netip.AddrPortFrom(rec.addr, rec.port).String()
+	}
+
+	command := execPlaceholderRegex.ReplaceAllStringFunc(f.command, func(placeholder string) string {
+		switch placeholder {
+		case "{ip}":
+			return shellQuote(rec.addr.String())
+		case "{port}":
+			if rec.port == 0 {
+				return ""
+			}
+			return strconv.Itoa(int(rec.port))
+		case "{host}":
+			return shellQuote(host)
+		case "{source}":
+			return shellQuote(rec.source)
+		default:
+			return shellQuote(f.tag)
+		}
+	})
+
+	f.pool.start(host, func() error {
+		return f.run(command)
+	})
+
+	return nil
+}
+
+// run runs a single command, killing it after the timeout.
+func (f *execFormatter) run(command string) error {
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(ctx, command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	f.mu.Lock()
+	os.Stdout.Write(stdout.Bytes())
+	os.Stderr.Write(stderr.Bytes())
+	f.mu.Unlock()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		f.timedOut.Add(1)
+		return fmt.Errorf("timed out after %s", f.timeout)
+	}
+
+	return err
+}
+
+// writeFooter waits for all commands to finish and reports the failures.
+func (f *execFormatter) writeFooter(_ io.Writer) error {
+	total, failed := f.pool.wait()
+	if failed == 0 {
+		return nil
+	}
+
+	if timedOut := f.timedOut.Load(); timedOut > 0 {
+		return fmt.Errorf("%d of %d commands failed, %d of them timed out", failed, total, timedOut)
+	}
+
+	return fmt.Errorf("%d of %d commands failed", failed, total)
+}
+
+// shellSafeRegex matches strings that need no quoting in a shell command.
+var shellSafeRegex = regexp.MustCompile(`^[A-Za-z0-9_.:/@%+=,\[\]-]+$`)
+
+// shellQuote quotes s for use as a single argument in a shell command.
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
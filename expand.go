@@ -0,0 +1,1915 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// expandOptions holds the command-line options of the expand command.
+type expandOptions struct {
+	ipv4          bool
+	ipv6          bool
+	bufferSize    int
+	flushInterval time.Duration
+	metrics       bool
+	metricsEvery  time.Duration
+	checkpoint    string
+	resume        string
+	manifest      string
+	strict        bool
+	inputFormat   string
+	xff           bool
+	refang        bool
+	defang        bool
+	expandUpTo    string
+	splitLarger   bool
+	minPrefix     string
+	maxPrefix     string
+	prefixPolicy  string
+	stripZone     bool
+	canonical     bool
+	ports         string
+	keepPorts     bool
+	output        string
+	schemes       []string
+	hostname      string
+	ansibleGroup  string
+	ansibleVars   []string
+	setName       string
+	nftTable      string
+	chunkSize     int
+	excludeFeeds  []string
+	feedTTL       time.Duration
+	offline       bool
+	resolve       bool
+	ptrMatch      string
+	invertMatch   bool
+	resolvers     []string
+	dnsTimeout    time.Duration
+	withHostname  bool
+	tag           string
+	withFilename  bool
+	groupBy       string
+	histogram     string
+	histEntries   bool
+	table         string
+	dbDSN         string
+	dbColumns     string
+	dbBatchSize   int
+	pipe          string
+	pipeEvery     int
+	pipeJobs      int
+	exec          string
+	execJobs      int
+	execTimeout   time.Duration
+	probe         string
+	timeout       time.Duration
+	probeJobs     int
+	where         string
+	filterCmd     string
+	filterBatch   int
+	annotate      string
+	annotateEvery time.Duration
+	ping          bool
+	rate          int
+	reverse       bool
+	follow        bool
+	watch         bool
+	tui           bool
+	watchOutput   string
+	yes           bool
+	errors        string
+	quiet         bool
+	maxLineBytes  int
+	noMmap        bool
+	passthrough   bool
+	lenientIPv4   bool
+	pedantic      bool
+	countDups     bool
+	rollUp        string
+	dryRun        bool
+	maxLineAddrs  uint64
+	anonymize     string
+	cryptoPAn     string
+	shard         string
+	splitFiles    int
+	splitMode     string
+	splitPrefix   string
+
+	// stdin replaces standard input as the "-" input if set, under the name
+	// stdinName, for commands that feed the expander themselves
+	stdin     io.Reader
+	stdinName string
+}
+
+// newExpandCmd creates the expand subcommand.
+func newExpandCmd() *cobra.Command {
+	opts := &expandOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "expand [filename...]",
+		Short: "Expand IP addresses and CIDR ranges into individual addresses",
+		Long: "Expand IP addresses and CIDR ranges into individual addresses.\n\n" +
+			"If no filename is provided, input is read from stdin.",
+		Example: "  cidrex expand input.txt\n" +
+			"  cidrex expand -4 input.txt\n" +
+			"  cat input.txt | cidrex expand -6",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runExpand(opts, args)
+		},
+	}
+
+	addExpandFlags(cmd, opts)
+
+	return cmd
+}
+
+// addExpandFlags registers the expand options on the given command. It is shared
+// by the expand subcommand and the root command.
+func addExpandFlags(cmd *cobra.Command, opts *expandOptions) {
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 addresses")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 addresses")
+	flags.StringVarP(&opts.ports, "ports", "p", "", "Print ip:port pairs for these ports, e.g. 1-1024,8080,!22")
+	flags.BoolVar(&opts.keepPorts, "keep-ports", false, "Print the port of entries such as 10.0.0.0/24:8443 or [2001:db8::1]:443 with each of their addresses, as ip:port pairs")
+	flags.StringVarP(&opts.output, "output", "o", "text", "Output format: text, urls, csv, json, tree, hosts, dnsmasq, hosts-csv, ansible, ansible-yaml, ipset, nft, nft-elements, terraform, aws-sg, pf, mikrotik, sqlite:PATH or parquet:PATH")
+	flags.StringVar(&opts.tag, "tag", "", "Add this label to every output record")
+	flags.BoolVarP(&opts.withFilename, "with-filename", "H", false, "Prefix each output record with the name of the input file")
+	flags.StringVar(&opts.expandUpTo, "expand-up-to", "", "Only expand prefixes of this length or longer, e.g. 20 or 20,64, printing larger ones as CIDRs")
+	flags.BoolVar(&opts.splitLarger, "split-larger", false, "With --expand-up-to, split the larger prefixes into CIDRs of that length")
+	flags.StringVar(&opts.minPrefix, "min-prefix", "", "Only expand prefixes of this length or longer, e.g. 16 or 16,48, handling the others as told by --prefix-policy")
+	flags.StringVar(&opts.maxPrefix, "max-prefix", "", "Only expand prefixes of this length or shorter, e.g. 30 or 30,64, handling the others as told by --prefix-policy")
+	flags.StringVar(&opts.prefixPolicy, "prefix-policy", prefixDrop, "What to do with the prefixes outside of --min-prefix and --max-prefix: drop them, pass them as CIDRs, or reject them as invalid")
+	flags.BoolVar(&opts.defang, "defang", false, "Print addresses in defanged form, such as 203[.]0[.]113[.]5, for safe inclusion in reports")
+	flags.BoolVarP(&opts.reverse, "reverse", "r", false, "Print the addresses of each range from the last one downward")
+	flags.StringVar(&opts.anonymize, "anonymize", "", "Clear the host bits of every address past this prefix length before printing, e.g. 24 or 24,48")
+	flags.StringVar(&opts.cryptoPAn, "cryptopan", "", "Replace every address with its prefix-preserving Crypto-PAn pseudonym, using the key in this file")
+	flags.StringVar(&opts.groupBy, "group-by", "", "Group addresses by their enclosing prefix of this length, e.g. 24 or 24,64 for IPv6")
+	flags.StringVar(&opts.histogram, "histogram", "", "Instead of the addresses, print how many fall into each prefix of this length, e.g. 24 or 24,64")
+	flags.BoolVar(&opts.histEntries, "histogram-entries", false, "Count input entries instead of addresses in --histogram")
+	flags.StringVar(&opts.rollUp, "roll-up", "", "Instead of the addresses, print the unique prefixes of this length containing them, e.g. 24 or 24,64")
+	flags.BoolVar(&opts.countDups, "count-duplicates", false, "Print each address once, preceded by the number of input ranges containing it, like uniq -c")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Instead of the addresses, print how many each input line expands to, flagging the lines above --max-line-addresses, as a table or JSON with --output json")
+	flags.Uint64Var(&opts.maxLineAddrs, "max-line-addresses", defaultMaxLineAddresses, "Number of addresses above which --dry-run flags a line (0 for no limit)")
+	flags.StringVar(&opts.table, "table", defaultTable, "Table to insert records into with --output sqlite:PATH or --db-dsn, or to fill with --output pf")
+	flags.StringVar(&opts.dbDSN, "db-dsn", "", "Stream records into this PostgreSQL (postgres://) or ClickHouse (clickhouse://, over HTTP in TabSeparated format) database")
+	flags.StringVar(&opts.dbColumns, "db-columns", "", "Fields written by --db-dsn, optionally renamed, e.g. ip=addr,port,tag")
+	flags.IntVar(&opts.dbBatchSize, "db-batch-size", defaultDBBatchSize, "Number of rows sent at once by --db-dsn")
+	flags.StringVar(&opts.pipe, "pipe", "", "Run this shell command for each chunk of records, fed to its stdin")
+	flags.IntVar(&opts.pipeEvery, "pipe-every", defaultPipeEvery, "Number of records fed to each run of the --pipe command")
+	flags.IntVar(&opts.pipeJobs, "pipe-jobs", 1, "Number of --pipe commands run at once")
+	flags.StringVar(&opts.shard, "shard", "", "Only print the addresses of shard i of n, e.g. 3/10, to share the input between n invocations")
+	flags.IntVar(&opts.splitFiles, "split-files", 0, "Deal the records across this many output files instead of printing them")
+	flags.StringVar(&opts.splitMode, "split-mode", splitRoundRobin, "How --split-files deals the records: round-robin or contiguous")
+	flags.StringVar(&opts.splitPrefix, "split-prefix", defaultSplitPrefix, "Prefix of the files written by --split-files, followed by their number")
+	flags.StringVar(&opts.exec, "exec", "", "Run this shell command for each record, e.g. \"nmap -p443 {ip}\"")
+	flags.IntVar(&opts.execJobs, "exec-jobs", runtime.NumCPU(), "Number of --exec commands run at once")
+	flags.DurationVar(&opts.execTimeout, "exec-timeout", 0, "Kill --exec commands running longer than this, e.g. 30s (0 disables)")
+	flags.StringVar(&opts.where, "where", "", "Only print the addresses matching this expression, e.g. '!private && last_octet in [1, 254]'")
+	flags.StringVar(&opts.filterCmd, "filter-cmd", "", "Only print the addresses this shell command echoes back, in order, when fed one address per line")
+	flags.IntVar(&opts.filterBatch, "filter-batch", defaultFilterBatch, "Number of addresses written to the --filter-cmd command at once")
+	flags.StringVar(&opts.annotate, "annotate", "", "Annotate each record with the network its address belongs to, looked up with this source: whois, cymru or ripestat")
+	flags.DurationVar(&opts.annotateEvery, "annotate-interval", defaultAnnotateInterval, "Minimum time between two network lookups of --annotate")
+	flags.StringVar(&opts.probe, "probe", "", "Only print addresses accepting a connection to one of these probes, e.g. tcp:443,tcp:80")
+	flags.BoolVar(&opts.ping, "ping", false, "Only print addresses answering an ICMP echo request, or one of the --probe probes")
+	flags.IntVar(&opts.rate, "rate", 0, "Maximum number of addresses probed per second, up to 1000000000 (0 for no limit)")
+	flags.DurationVar(&opts.timeout, "timeout", defaultProbeTimeout, "Timeout of each probe")
+	flags.IntVar(&opts.probeJobs, "probe-jobs", defaultProbeJobs, "Number of probes run at once")
+	flags.StringSliceVar(&opts.schemes, "scheme", []string{"http"}, "URL schemes for --output urls, e.g. http,https")
+	flags.StringVar(&opts.hostname, "hostname-template", "", "Hostnames for --output hosts, dnsmasq, hosts-csv and ansible, with {index}, {subnet_index}, {dashed} and {last_octet} placeholders, numbers padded as in {index:3} (default \""+defaultHostnameTemplate+"\" for hosts, dnsmasq and hosts-csv)")
+	flags.StringVar(&opts.ansibleGroup, "group", defaultAnsibleGroup, "Group of the hosts written by --output ansible and ansible-yaml")
+	flags.StringArrayVar(&opts.ansibleVars, "group-var", nil, "Variable of the group written by --output ansible and ansible-yaml, as name=value (can be repeated)")
+	flags.StringVar(&opts.setName, "set-name", defaultSetName, "Name of the set written by --output ipset, nft, terraform or mikrotik")
+	flags.IntVar(&opts.chunkSize, "chunk-size", defaultChunkSize, "Number of CIDRs per chunk of --output terraform and aws-sg")
+	flags.StringVar(&opts.nftTable, "nft-table", defaultNftTable, "Family and name of the table holding the set written by --output nft")
+	flags.StringArrayVar(&opts.excludeFeeds, "exclude-feed", nil, "Remove addresses listed in this blocklist URL, file or dataset, such as bogons (can be repeated)")
+	flags.DurationVar(&opts.feedTTL, "feed-ttl", defaultFeedTTL, "How long downloaded feeds, ASN prefixes and --annotate lookups are cached before being fetched again")
+	flags.BoolVar(&opts.offline, "offline", false, "Only use the cached copies of feeds, ASN prefixes and --annotate lookups, whatever their age, never going to the network")
+	flags.BoolVar(&opts.resolve, "resolve", false, "Resolve hostname entries to all of their A and AAAA records")
+	flags.StringSliceVar(&opts.resolvers, "resolvers", nil, "DNS servers used by --resolve and --ptr-match, e.g. 1.1.1.1,8.8.8.8:53 (default: the system resolver)")
+	flags.DurationVar(&opts.dnsTimeout, "dns-timeout", defaultDNSTimeout, "Time allowed to resolve each hostname with --resolve, or look up the PTR records of each address with --ptr-match")
+	flags.BoolVar(&opts.withHostname, "with-hostname", false, "With --resolve, print each resolved address as a hostname,ip pair")
+	flags.StringVar(&opts.ptrMatch, "ptr-match", "", "Only print the addresses with a PTR record matching this regular expression, e.g. 'vpn|fw|gw'")
+	flags.BoolVarP(&opts.invertMatch, "invert-match", "v", false, "With --ptr-match, only print the addresses without a matching PTR record")
+	flags.IntVar(&opts.bufferSize, "buffer-size", defaultBufferSize, "Size of the output buffer in bytes (0 disables buffering)")
+	flags.BoolVarP(&opts.follow, "follow", "f", false, "Keep reading the input file as it grows, like tail -F")
+	flags.BoolVarP(&opts.watch, "watch", "w", false, "Expand the input files again whenever they change, printing the added and removed records")
+	flags.StringVar(&opts.watchOutput, "watch-output", "", "With --watch, rewrite this file with the full output on every change instead of printing differences")
+	flags.BoolVar(&opts.tui, "tui", false, "On a terminal, browse large outputs in a viewer with search, folding by group and filtering")
+	flags.BoolVarP(&opts.yes, "yes", "y", false, "Print more than 100000 addresses to a terminal without asking first")
+	flags.DurationVar(&opts.flushInterval, "flush-interval", 0, "Flush the output buffer at this interval, e.g. 100ms (0 flushes only when full)")
+	flags.BoolVar(&opts.metrics, "metrics", false, "Periodically print the throughput to stderr: addresses/s, MB/s written, lines/s and how often the output blocked")
+	flags.DurationVar(&opts.metricsEvery, "metrics-interval", defaultMetricsInterval, "Interval between two --metrics reports")
+	flags.StringVar(&opts.checkpoint, "checkpoint", "", "Write a resume checkpoint to this file when interrupted")
+	flags.StringVar(&opts.resume, "resume", "", "Resume processing from a checkpoint file written by --checkpoint")
+	flags.StringVar(&opts.manifest, "manifest", "", "Write the hashes of the inputs and of the output, the arguments, the version and the counts of the run to this JSON file")
+	flags.BoolVar(&opts.stripZone, "strip-zone", false, "Remove zone identifiers such as %eth0 from IPv6 addresses")
+	flags.BoolVar(&opts.canonical, "canonical", false, "Print IPv6 addresses in the canonical form of RFC 5952, as is always done; accepted so that scripts can require it")
+	flags.StringVar(&opts.errors, "errors", "text", "Report invalid entries as text or jsonl, optionally to a file with jsonl:PATH")
+	flags.BoolVar(&opts.lenientIPv4, "lenient-ipv4", false, "Accept IPv4 addresses in the forms accepted by inet_aton, such as 3232235777, 0xC0A80101 or 10.1")
+	flags.BoolVar(&opts.pedantic, "pedantic", false, "Reject non-canonical IPv6 addresses, prefixes with host bits set and zones")
+	flags.BoolVar(&opts.refang, "refang", false, "Accept defanged entries such as 192[.]168[.]1[.]1 or hxxp://10[.]0[.]0[.]1/, restoring them before parsing")
+	flags.BoolVar(&opts.passthrough, "passthrough", false, "Copy entries that are not IP addresses or ranges to the output unchanged instead of reporting them")
+	flags.BoolVarP(&opts.quiet, "quiet", "q", false, "Do not print warnings about invalid entries, nor the summary of those skipped")
+	flags.IntVar(&opts.maxLineBytes, "max-line-bytes", defaultMaxLineBytes, "Maximum length of an input line in bytes (0 for no limit)")
+	flags.BoolVar(&opts.noMmap, "no-mmap", false, "Read large input files through a buffer instead of memory-mapping them and parsing their lines in parallel")
+	flags.StringVar(&opts.inputFormat, "input-format", inputText, "Format of the input: text, or eve, zeek and clf to read the addresses logged by Suricata, Zeek and web servers")
+	flags.BoolVar(&opts.xff, "xff", false, "With --input-format clf, read the client address from the X-Forwarded-For header when logged last")
+	flags.BoolVar(&opts.strict, "strict", false, "Parse each line exactly as read as a single entry, without normalization")
+}
+
+// runExpand expands the addresses read from the files named in args, or from
+// stdin if no file is given, and prints them to stdout.
+func runExpand(opts *expandOptions, args []string) error {
+	if opts.tui && isTerminal(os.Stdout) {
+		return runTUI(opts, args)
+	}
+
+	if opts.watch {
+		return runWatch(opts, args)
+	}
+
+	return expandTo(opts, args, os.Stdout)
+}
+
+// Flags that some options cannot be combined with, as checked by
+// checkConflicts. The options printing CIDRs or input lines in between the
+// addresses, and those collecting the ranges instead of printing them, need
+// each address printed on its own.
+var (
+	cidrConflicts      = []string{"--histogram", "--ports", "--probe", "--ping", "--where", "--ptr-match", "--filter-cmd", "--shard", "--anonymize", "--cryptopan", "--roll-up", "--count-duplicates", "--dry-run"}
+	collectorConflicts = []string{"--histogram", "--ports", "--probe", "--ping", "--where", "--ptr-match", "--filter-cmd", "--passthrough", "--anonymize", "--cryptopan", "--shard"}
+)
+
+// checkConflicts returns an error naming the first of the conflicts flags
+// that is set in opts, which option cannot be combined with.
+func checkConflicts(option string, conflicts []string, opts *expandOptions) error {
+	set := map[string]bool{
+		"--histogram":        opts.histogram != "",
+		"--ports":            opts.ports != "",
+		"--probe":            opts.probe != "",
+		"--ping":             opts.ping,
+		"--where":            opts.where != "",
+		"--ptr-match":        opts.ptrMatch != "",
+		"--filter-cmd":       opts.filterCmd != "",
+		"--passthrough":      opts.passthrough,
+		"--shard":            opts.shard != "",
+		"--anonymize":        opts.anonymize != "",
+		"--cryptopan":        opts.cryptoPAn != "",
+		"--roll-up":          opts.rollUp != "",
+		"--count-duplicates": opts.countDups,
+		"--dry-run":          opts.dryRun,
+		"--pipe":             opts.pipe != "",
+		"--exec":             opts.exec != "",
+		"--db-dsn":           opts.dbDSN != "",
+	}
+
+	for _, flag := range conflicts {
+		if set[flag] {
+			return fmt.Errorf("%s cannot be combined with %s", option, flag)
+		}
+	}
+
+	return nil
+}
+
+// textOutput reports whether the addresses are printed as text to the
+// output, and not to another sink.
+func (opts *expandOptions) textOutput() bool {
+	return opts.output == "text" && opts.dbDSN == "" && opts.exec == "" && opts.pipe == "" && opts.splitFiles == 0
+}
+
+// validate checks the options expanding args with, and the combinations of
+// them that are not supported, before anything is opened or read.
+func (opts *expandOptions) validate(args []string) error {
+	if opts.bufferSize < 0 {
+		return fmt.Errorf("invalid buffer size: %d", opts.bufferSize)
+	}
+
+	if opts.flushInterval < 0 {
+		return fmt.Errorf("invalid flush interval: %s", opts.flushInterval)
+	}
+
+	if opts.metrics && opts.metricsEvery <= 0 {
+		return fmt.Errorf("invalid metrics interval: %s", opts.metricsEvery)
+	}
+
+	if opts.maxLineBytes < 0 {
+		return fmt.Errorf("invalid maximum line length: %d", opts.maxLineBytes)
+	}
+
+	if opts.pedantic && opts.lenientIPv4 {
+		return fmt.Errorf("--pedantic cannot be combined with --lenient-ipv4")
+	}
+
+	if _, err := newLogParser(opts.inputFormat, opts.xff); err != nil {
+		return err
+	}
+
+	if opts.follow && (len(args) != 1 || args[0] == "-") {
+		return fmt.Errorf("--follow requires a single input file")
+	}
+
+	if err := opts.validateOutput(args); err != nil {
+		return err
+	}
+
+	if err := opts.validateFilters(); err != nil {
+		return err
+	}
+
+	if err := opts.validateCollector(); err != nil {
+		return err
+	}
+
+	if opts.manifest != "" && (opts.resume != "" || opts.follow || opts.watch) {
+		return fmt.Errorf("--manifest cannot be combined with --resume, --follow or --watch")
+	}
+
+	return nil
+}
+
+// validateOutput checks the options selecting where and how the addresses
+// are written.
+func (opts *expandOptions) validateOutput(args []string) error {
+	if opts.defang && (opts.output != "text" && opts.output != "urls" || opts.dbDSN != "") {
+		return fmt.Errorf("--defang requires --output text or urls")
+	}
+
+	if opts.dbDSN != "" && opts.output != "text" {
+		return fmt.Errorf("--db-dsn cannot be combined with --output %s", opts.output)
+	}
+
+	if opts.exec != "" && (opts.output != "text" || opts.pipe != "" || opts.dbDSN != "") {
+		return fmt.Errorf("--exec cannot be combined with other outputs")
+	}
+
+	if opts.passthrough {
+		if !opts.textOutput() {
+			return fmt.Errorf("--passthrough requires --output text")
+		}
+		if err := checkConflicts("--passthrough", []string{"--histogram", "--probe", "--ping", "--where", "--ptr-match", "--filter-cmd"}, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.splitFiles != 0 {
+		if err := checkConflicts("--split-files", []string{"--pipe", "--exec", "--db-dsn", "--histogram"}, opts); err != nil {
+			return err
+		}
+		if opts.resume != "" || opts.watch {
+			return fmt.Errorf("--resume and --watch are not supported with --split-files")
+		}
+
+		switch opts.splitMode {
+		case splitRoundRobin:
+		case splitContiguous:
+			if len(args) == 0 || slices.Contains(args, "-") || opts.follow {
+				return fmt.Errorf("--split-mode contiguous requires input files, since they are read twice")
+			}
+			if err := checkConflicts("--split-mode contiguous", []string{"--probe", "--ping", "--filter-cmd"}, opts); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown split mode: %s", opts.splitMode)
+		}
+	}
+
+	if opts.keepPorts && opts.ports != "" {
+		return fmt.Errorf("--keep-ports cannot be combined with --ports")
+	}
+
+	// The tree is only printed once complete, so it cannot be continued
+	if opts.output == "tree" && opts.resume != "" {
+		return fmt.Errorf("--resume is not supported with --output tree")
+	}
+
+	if opts.expandUpTo != "" {
+		if !opts.textOutput() {
+			return fmt.Errorf("--expand-up-to requires --output text")
+		}
+		if err := checkConflicts("--expand-up-to", cidrConflicts, opts); err != nil {
+			return err
+		}
+	} else if opts.splitLarger {
+		return fmt.Errorf("--split-larger requires --expand-up-to")
+	}
+
+	if opts.minPrefix != "" || opts.maxPrefix != "" {
+		if opts.prefixPolicy == prefixPass {
+			if !opts.textOutput() {
+				return fmt.Errorf("--prefix-policy pass requires --output text")
+			}
+			if err := checkConflicts("--prefix-policy pass", cidrConflicts, opts); err != nil {
+				return err
+			}
+		}
+	} else if opts.prefixPolicy != prefixDrop {
+		return fmt.Errorf("--prefix-policy requires --min-prefix or --max-prefix")
+	}
+
+	if opts.withHostname && !opts.resolve {
+		return fmt.Errorf("--with-hostname requires --resolve")
+	}
+
+	if opts.withHostname && (opts.output != "text" && opts.output != "csv" && opts.output != "json" || opts.dbDSN != "") {
+		return fmt.Errorf("--with-hostname requires --output text, csv or json")
+	}
+
+	if opts.histogram != "" {
+		if opts.output != "text" {
+			return fmt.Errorf("--histogram cannot be combined with --output %s", opts.output)
+		}
+		if opts.resume != "" {
+			return fmt.Errorf("--resume is not supported with --histogram")
+		}
+	}
+
+	return nil
+}
+
+// validateFilters checks the options dropping or annotating addresses.
+func (opts *expandOptions) validateFilters() error {
+	if opts.shard != "" {
+		if err := checkConflicts("--shard", []string{"--passthrough"}, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.invertMatch && opts.ptrMatch == "" {
+		return fmt.Errorf("--invert-match requires --ptr-match")
+	}
+
+	if opts.annotate != "" {
+		if err := checkConflicts("--annotate", []string{"--filter-cmd", "--histogram"}, opts); err != nil {
+			return err
+		}
+		if opts.annotate == "cymru" && (opts.follow || opts.watch) {
+			return fmt.Errorf("--annotate cymru cannot be combined with --follow or --watch, since records are held back for bulk lookups")
+		}
+	}
+
+	if opts.filterCmd != "" {
+		if err := checkConflicts("--filter-cmd", []string{"--probe", "--ping"}, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateCollector checks the options collecting the expanded ranges
+// instead of printing their addresses, of which only one can be used.
+func (opts *expandOptions) validateCollector() error {
+	var collectorFlag string
+	if opts.countDups {
+		collectorFlag = "--count-duplicates"
+	}
+	if opts.rollUp != "" {
+		if collectorFlag != "" {
+			return fmt.Errorf("--roll-up cannot be combined with %s", collectorFlag)
+		}
+		collectorFlag = "--roll-up"
+	}
+
+	// The formats written from the aggregated ranges print them as text
+	output := opts.output
+	if isRangeFormat(opts.output) {
+		if collectorFlag != "" {
+			return fmt.Errorf("--output %s cannot be combined with %s", opts.output, collectorFlag)
+		}
+		collectorFlag, output = "--output "+opts.output, "text"
+	}
+	if opts.dryRun {
+		if collectorFlag != "" {
+			return fmt.Errorf("--dry-run cannot be combined with %s", collectorFlag)
+		}
+		if output != "text" && output != "json" || opts.dbDSN != "" || opts.exec != "" || opts.pipe != "" || opts.splitFiles != 0 {
+			return fmt.Errorf("--dry-run requires --output text or json")
+		}
+		collectorFlag = "--dry-run"
+	}
+
+	if collectorFlag == "" {
+		return nil
+	}
+
+	if output != "text" && !opts.dryRun || opts.dbDSN != "" || opts.exec != "" || opts.pipe != "" || opts.splitFiles != 0 {
+		return fmt.Errorf("%s requires --output text", collectorFlag)
+	}
+	if err := checkConflicts(collectorFlag, collectorConflicts, opts); err != nil {
+		return err
+	}
+	if opts.resume != "" || opts.follow {
+		return fmt.Errorf("--resume and --follow are not supported with %s", collectorFlag)
+	}
+
+	return nil
+}
+
+// formatOptions returns the options of the output formats.
+func (opts *expandOptions) formatOptions() formatOptions {
+	return formatOptions{
+		schemes:   opts.schemes,
+		tag:       opts.tag,
+		ports:     opts.ports != "" || opts.keepPorts,
+		source:    opts.withFilename,
+		hostnames: opts.withHostname,
+		group:     opts.groupBy != "",
+		table:     opts.table,
+		hostname:  opts.hostname,
+		setName:   opts.setName,
+		defang:    opts.defang,
+		nftTable:  opts.nftTable,
+		chunkSize: opts.chunkSize,
+
+		annotations:  opts.filterCmd != "" || opts.annotate != "",
+		ansibleGroup: opts.ansibleGroup,
+		ansibleVars:  opts.ansibleVars,
+	}
+}
+
+// expandTo expands the addresses read from the files named in args, or from
+// stdin if no file is given, and writes them to out.
+func expandTo(opts *expandOptions, args []string, out io.Writer) error {
+	if err := opts.validate(args); err != nil {
+		return err
+	}
+
+	// Do not hold back addresses while waiting for more input
+	flushInterval := opts.flushInterval
+	if opts.follow && flushInterval == 0 {
+		flushInterval = followFlushInterval
+	}
+
+	format, aggregate, err := newExpandFormat(opts, args)
+	if err != nil {
+		return err
+	}
+
+	feeds := feedCache{ttl: opts.feedTTL, offline: opts.offline}
+
+	exp, err := newExpander(opts, format, feeds)
+	if err != nil {
+		return err
+	}
+
+	errs, err := newErrorReporter(opts.errors, opts.quiet)
+	if err != nil {
+		return err
+	}
+	defer errs.Close()
+	exp.errors = errs
+
+	collector, pre, err := newCollector(opts, aggregate)
+	if err != nil {
+		return err
+	}
+	exp.collector = collector
+
+	if len(opts.excludeFeeds) > 0 {
+		if exp.exclude, err = loadFeeds(opts.excludeFeeds, feeds); err != nil {
+			return err
+		}
+	}
+
+	// Read from the files given, otherwise from stdin
+	inputs := args
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	exp.scanned = make([]bool, len(inputs))
+
+	if opts.resume != "" {
+		cp, err := readCheckpoint(opts.resume)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Equal(cp.Inputs, inputs) {
+			return fmt.Errorf("checkpoint %s was written for other inputs: %s", opts.resume, strings.Join(cp.Inputs, " "))
+		}
+
+		exp.resume = cp.Position
+	}
+
+	// Ask before flooding a terminal with addresses, unless they go elsewhere
+	confirm := !opts.yes && out == io.Writer(os.Stdout) && isTerminal(os.Stdout) &&
+		exp.hist == nil && opts.dbDSN == "" && opts.exec == "" && opts.pipe == "" && opts.splitFiles == 0
+
+	// Hash the output as it is written, and the inputs as they are read
+	var outputDigest *digest
+	if opts.manifest != "" {
+		outputDigest = newDigest()
+		out = io.MultiWriter(out, outputDigest)
+
+		exp.digests = make([]*digest, len(inputs))
+		for i := range inputs {
+			exp.digests[i] = newDigest()
+		}
+	}
+
+	// Measure what reaches the output, below the buffer
+	if opts.metrics {
+		exp.metrics = startThroughput(opts.metricsEvery)
+		defer exp.metrics.stop()
+
+		out = exp.metrics.meter(out)
+	}
+
+	// Create a new buffered writer to the output
+	writer := newOutputWriter(out, opts.bufferSize, flushInterval)
+	exp.writer = writer
+
+	// The header was already written by the run being resumed
+	if header, ok := format.(headerWriter); ok && opts.resume == "" && exp.hist == nil && collector == nil {
+		if err := header.writeHeader(writer); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	if opts.probe != "" || opts.ping {
+		probeOpts := probeOptions{
+			spec:    opts.probe,
+			ping:    opts.ping,
+			timeout: opts.timeout,
+			jobs:    opts.probeJobs,
+			rate:    opts.rate,
+		}
+		if exp.probe, err = newProber(probeOpts, exp.deliver); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	if opts.filterCmd != "" {
+		if exp.filter, err = newFilterCmd(opts.filterCmd, opts.filterBatch, exp.deliver); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	// A followed file keeps growing, so its exclusions are applied as they
+	// are read, like those of stdin. Logs hold no exclusions.
+	if !opts.follow && exp.inputFormat == inputText {
+		if err := exp.collectExclusions(inputs); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	// Stop gracefully on Ctrl-C, even while blocked waiting for input
+	interrupted, stopNotify := notifyInterrupt(exp)
+
+	if confirm {
+		exp.confirm = newConfirmation(confirmThreshold, writer.Flush)
+		exp.confirm.done = interrupted
+	}
+
+	err = exp.processInputs(inputs, interrupted)
+	stopNotify()
+
+	// Let the probes in flight finish delivering their records
+	if exp.probe != nil {
+		if probeErr := exp.probe.wait(); probeErr != nil && (err == nil || err == errInterrupted) {
+			err = probeErr
+		}
+	}
+
+	// Let the filter command answer the addresses it was given
+	if exp.filter != nil {
+		if filterErr := exp.filter.wait(); filterErr != nil && (err == nil || err == errInterrupted) {
+			err = filterErr
+		}
+	}
+
+	// Annotate the records held back for a bulk lookup
+	if exp.annotate != nil {
+		if flushErr := exp.flushAnnotations(); flushErr != nil && (err == nil || err == errInterrupted) {
+			err = flushErr
+		}
+	}
+
+	// Whatever happened, make sure everything emitted so far is written out
+	if exp.hist != nil {
+		if histErr := exp.hist.write(writer); err == nil {
+			err = histErr
+		}
+	}
+
+	if collector != nil {
+		if collectErr := collector.write(writer); err == nil {
+			err = collectErr
+		}
+	}
+
+	if footer, ok := format.(footerWriter); ok {
+		if footerErr := footer.writeFooter(writer); err == nil {
+			err = footerErr
+		}
+	}
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == errInterrupted {
+		exp.logProgress()
+
+		if opts.checkpoint != "" {
+			cp := checkpoint{Inputs: inputs, Position: exp.pos}
+			if err := writeCheckpoint(opts.checkpoint, cp); err != nil {
+				return err
+			}
+		}
+
+		return errInterrupted
+	}
+
+	if err != nil {
+		return fmt.Errorf("error processing input: %w", err)
+	}
+
+	if !opts.quiet {
+		errs.logSummary(exp.expanded)
+	}
+
+	if opts.manifest != "" {
+		if err := writeManifest(opts.manifest, inputs, exp.digests, outputDigest, exp, errs.count); err != nil {
+			return err
+		}
+	}
+
+	if err := errs.status(); err != nil {
+		return err
+	}
+
+	// The report flags the lines above the limit
+	if pre != nil && pre.exceeded > 0 {
+		return &exitError{code: exitCheckFailed}
+	}
+
+	return nil
+}
+
+// newExpandFormat returns the formatter writing the records of the addresses
+// expanded with opts, wrapped by the sinks they are sent to, and the
+// rangeFormat writing the aggregated ranges instead if the output format is
+// one.
+func newExpandFormat(opts *expandOptions, args []string) (formatter, rangeFormat, error) {
+	formatOpts := opts.formatOptions()
+
+	// Formats written from the aggregated ranges, once all input is read
+	aggregate, err := newRangeFormat(opts.output, formatOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output := opts.output
+	if aggregate != nil {
+		output = "text"
+	}
+
+	var format formatter
+	if opts.dbDSN != "" {
+		format, err = newDBFormatter(opts.dbDSN, opts.dbColumns, opts.dbBatchSize, formatOpts)
+	} else {
+		format, err = newFormatter(output, formatOpts)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.exec != "" {
+		if format, err = newExecFormatter(opts.exec, opts.execJobs, opts.execTimeout, formatOpts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if opts.splitFiles != 0 {
+		var total uint64
+		if opts.splitMode == splitContiguous {
+			if total, err = countRecords(opts, args); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if format, err = newSplitFormatter(format, opts.splitFiles, opts.splitPrefix, total); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if opts.pipe != "" {
+		if format, err = newPipeFormatter(format, opts.pipe, opts.pipeEvery, opts.pipeJobs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return format, aggregate, nil
+}
+
+// newExpander returns the expander writing the records of the addresses
+// expanded with opts through format, with the filters and transformations
+// the options select. The caller sets up its output, error reporting and
+// progress.
+func newExpander(opts *expandOptions, format formatter, feeds feedCache) (*expander, error) {
+	var err error
+
+	// Determine IP address filtering based on flags
+	// If neither or both flags are set, include both IPv4 and IPv6
+	exp := &expander{
+		inputSettings: inputSettings{
+			includeIPv4:  opts.ipv4 || !opts.ipv4 && !opts.ipv6,
+			includeIPv6:  opts.ipv6 || !opts.ipv4 && !opts.ipv6,
+			strict:       opts.strict,
+			inputFormat:  opts.inputFormat,
+			xff:          opts.xff,
+			refang:       opts.refang,
+			maxLineBytes: opts.maxLineBytes,
+			mmap:         !opts.noMmap,
+			parser:       cidrex.ParseOptions{LenientIPv4: opts.lenientIPv4, Pedantic: opts.pedantic},
+			stripZone:    opts.stripZone,
+			follow:       opts.follow,
+			stdin:        os.Stdin,
+			stdinName:    stdinName,
+		},
+		outputSettings: outputSettings{
+			format:       format,
+			splitLarger:  opts.splitLarger,
+			passthrough:  opts.passthrough,
+			reverse:      opts.reverse,
+			keepPorts:    opts.keepPorts,
+			withSource:   opts.withFilename,
+			withHostname: opts.withHostname,
+		},
+		asns:    newASNResolver(feeds),
+		exclude: &rangeSet{},
+	}
+
+	if opts.stdin != nil {
+		exp.stdin, exp.stdinName = opts.stdin, opts.stdinName
+	}
+
+	if opts.ports != "" {
+		if exp.ports, err = parsePorts(opts.ports); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.groupBy != "" {
+		if exp.groups, err = parseGroupBy(opts.groupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	// The tree always has a group level between entries and addresses
+	if _, ok := format.(*treeFormatter); ok && exp.groups == nil {
+		exp.groups = &grouping{bits4: defaultGroupBits4, bits6: defaultGroupBits6}
+	}
+
+	if opts.anonymize != "" {
+		if exp.anonymize, err = parseGroupBy(opts.anonymize); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.expandUpTo != "" {
+		if exp.expandLimit, err = parseGroupBy(opts.expandUpTo); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.minPrefix != "" || opts.maxPrefix != "" {
+		if exp.window, err = parsePrefixWindow(opts.minPrefix, opts.maxPrefix, opts.prefixPolicy); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.shard != "" {
+		if exp.shard, err = parseShard(opts.shard); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.resolve {
+		if exp.dns, err = newDNSResolver(opts.resolvers, opts.dnsTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.where != "" {
+		if exp.where, err = newWhereFilter(opts.where); err != nil {
+			return nil, err
+		}
+	}
+
+	// PTR records are looked up with a resolver of their own, which does not
+	// make hostname entries resolve
+	if opts.ptrMatch != "" {
+		ptrDNS, err := newDNSResolver(opts.resolvers, opts.dnsTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if exp.ptr, err = newPTRFilter(opts.ptrMatch, opts.invertMatch, ptrDNS); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.cryptoPAn != "" {
+		if exp.pan, err = loadCryptoPAn(opts.cryptoPAn); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.histogram != "" {
+		histGroups, err := parseGroupBy(opts.histogram)
+		if err != nil {
+			return nil, err
+		}
+		exp.hist = newHistogram(histGroups, opts.histEntries)
+	}
+
+	if opts.annotate != "" {
+		if exp.annotate, err = newAnnotator(opts.annotate, feeds, opts.annotateEvery); err != nil {
+			return nil, err
+		}
+	}
+
+	return exp, nil
+}
+
+// newCollector returns the rangeCollector collecting the ranges expanded
+// with opts instead of printing their addresses, or nil if none is used.
+// aggregate is the format of the aggregated ranges, if any. The preflight is
+// also returned for --dry-run, to check its report.
+func newCollector(opts *expandOptions, aggregate rangeFormat) (rangeCollector, *preflight, error) {
+	switch {
+	case opts.countDups:
+		return &dupCounter{}, nil, nil
+	case opts.rollUp != "":
+		rollGroups, err := parseGroupBy(opts.rollUp)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &rollUp{groups: rollGroups}, nil, nil
+	case aggregate != nil:
+		return &aggregator{format: aggregate}, nil, nil
+	case opts.dryRun:
+		pre := &preflight{limit: opts.maxLineAddrs, json: opts.output == "json"}
+		return pre, pre, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// expander expands IP addresses and CIDR ranges and writes the resulting
+// addresses to a writer, keeping track of its progress through the input.
+type expander struct {
+	inputSettings
+	outputSettings
+
+	writer io.Writer
+
+	// logs extracts the addresses from the lines of the current input if it
+	// is in a log format
+	logs logParser
+
+	// asns resolves the ASNs found in the input, and dns its hostnames if
+	// set
+	asns *asnResolver
+	dns  *dnsResolver
+
+	// errors reports the entries that cannot be parsed
+	errors *errorReporter
+
+	// lastGroup is the group of the previous record
+	lastGroup netip.Prefix
+
+	// hist counts the addresses instead of printing them if set
+	hist *histogram
+
+	// shard drops the addresses of the other shards if set
+	shard *shard
+
+	// collector collects the ranges instead of printing their addresses if
+	// set
+	collector rangeCollector
+
+	// confirm asks before printing too many addresses to a terminal if set
+	confirm *confirmation
+
+	// probe only lets the addresses of live hosts through if set
+	probe *prober
+
+	// where, ptr and filter only let the addresses matching the --where
+	// expression, those matching --ptr-match and those kept by the
+	// --filter-cmd command through, if set
+	where  *whereFilter
+	ptr    *ptrFilter
+	filter *filterCmd
+
+	// annotate adds what is known about the network of each address to its
+	// record if set. pending holds the records awaiting a bulk annotation.
+	annotate annotator
+	pending  []record
+
+	// exclude holds the addresses removed from the output. scanned tells
+	// which inputs had their exclusions collected before processing.
+	exclude *rangeSet
+	scanned []bool
+
+	// digests hash each input as it is read, if set
+	digests []*digest
+
+	// source is the name of the input being processed. inputScanned is set
+	// if its exclusions were collected before processing. entry is the entry
+	// being expanded and entrySeq counts the entries expanded so far.
+	// hostname is the hostname the entry was resolved from, if any, and port
+	// the port it carries, if keepPorts is set.
+	source       string
+	inputScanned bool
+	entry        string
+	entrySeq     uint64
+	hostname     string
+	port         uint16
+
+	// stop is set asynchronously to abort processing at the next address
+	stop atomic.Bool
+
+	// pos is the line to process next and the number of addresses already
+	// emitted from it. expanded counts the valid entries processed.
+	pos        position
+	lastSource string
+	lastNum    int
+	lastLine   string
+	lastRaw    string
+	emitted    uint64
+	expanded   uint64
+
+	// resume is the position to resume from; everything before it is skipped
+	resume position
+	skip   uint64
+
+	// metrics, if set, counts the lines processed and the addresses emitted
+	metrics *throughput
+}
+
+// inputSettings are the options of an expander reading and parsing its
+// inputs.
+type inputSettings struct {
+	includeIPv4  bool
+	includeIPv6  bool
+	strict       bool
+	stripZone    bool
+	maxLineBytes int
+	mmap         bool
+	parser       cidrex.ParseOptions
+	follow       bool
+
+	// inputFormat is the format of the inputs
+	inputFormat string
+	xff         bool
+
+	// refang restores defanged entries before parsing them
+	refang bool
+
+	// stdin is read as the "-" input, reported as stdinName
+	stdin     io.Reader
+	stdinName string
+}
+
+// outputSettings are the options of an expander selecting the addresses it
+// writes and the records written for them.
+type outputSettings struct {
+	format      formatter
+	passthrough bool
+	reverse     bool
+	ports       []uint16
+	keepPorts   bool
+	withSource  bool
+
+	// withHostname adds the hostname to the records of the addresses
+	// resolved from one
+	withHostname bool
+
+	// expandLimit is the length of the largest prefixes expanded if set;
+	// larger ones are printed as CIDRs, split to that length if splitLarger
+	// is set
+	expandLimit *grouping
+	splitLarger bool
+
+	// window bounds the length of the prefixes expanded if set
+	window *prefixWindow
+
+	// groups assigns addresses to their group if grouping was requested
+	groups *grouping
+
+	// anonymize masks the host bits of the addresses written out if set, and
+	// pan replaces them with their pseudonym
+	anonymize *grouping
+	pan       *cidrex.CryptoPAn
+}
+
+// position identifies how far processing got in the inputs.
+type position struct {
+	Input  int    `json:"input"`
+	Line   int    `json:"line"`
+	Offset uint64 `json:"offset"`
+}
+
+// stdinName is the name under which standard input is reported.
+const stdinName = "(standard input)"
+
+// processInputs processes each named input in turn, skipping those completed
+// by the run being resumed. The name "-" stands for stdin.
+func (e *expander) processInputs(inputs []string, interrupted <-chan struct{}) error {
+	for i, name := range inputs {
+		if i < e.resume.Input {
+			continue
+		}
+
+		if err := e.processInput(i, name, interrupted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectExclusions adds the entries negated with "!" in the regular files
+// among inputs to the exclusion set, so that they apply to the whole input
+// regardless of where they appear. Other inputs, such as stdin, can only be
+// read once; their exclusions are collected as they are read and only apply
+// to the entries that follow them.
+func (e *expander) collectExclusions(inputs []string) error {
+	for i, name := range inputs {
+		if name == "-" {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if err := e.scanExclusions(name); err != nil {
+			return err
+		}
+
+		e.scanned[i] = true
+	}
+
+	return nil
+}
+
+// scanExclusions adds the exclusions found in the named file to the
+// exclusion set. Invalid entries are reported during processing.
+func (e *expander) scanExclusions(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner, release := newFileScanner(file, e.maxLineBytes, e.mmap, nil, nil)
+	defer release()
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if !e.strict {
+			line = normalizeLine(line)
+		}
+
+		// The entries are warned about when the file is processed
+		for _, entry := range splitEntries(line, e.strict, nil) {
+			if entry, ok := cutNegation(entry); ok {
+				if t, err := e.parseEntry(entry); err == nil {
+					e.addExclusion(t)
+				}
+			}
+		}
+	}
+
+	return scanError(scanner, name, lineNum+1, e.maxLineBytes)
+}
+
+// addExclusion adds the prefixes of a target to the exclusion set.
+func (e *expander) addExclusion(t target) {
+	for _, prefix := range t.prefixes {
+		e.exclude.addPrefix(prefix)
+	}
+}
+
+// processInput opens and processes a single input. Large input files are
+// memory-mapped unless followed, and their lines parsed ahead unless they are
+// logs.
+func (e *expander) processInput(index int, name string, interrupted <-chan struct{}) error {
+	var err error
+	if e.logs, err = newLogParser(e.inputFormat, e.xff); err != nil {
+		return err
+	}
+
+	stdin := e.stdin
+	if e.digests != nil {
+		stdin = io.TeeReader(stdin, e.digests[index])
+	}
+
+	var scanner lineScanner = newLineScanner(newCancelReader(stdin, interrupted), e.maxLineBytes)
+	e.source = e.stdinName
+
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		e.source = name
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case e.follow:
+			follower, err := newFollowReader(name, file)
+			if err != nil {
+				return err
+			}
+			defer follower.Close()
+
+			scanner = newLineScanner(newCancelReader(follower, interrupted), e.maxLineBytes)
+		case e.digests != nil && !info.Mode().IsRegular():
+			// Pipes can only be read once, so they are hashed as they are read
+			scanner = newLineScanner(newCancelReader(io.TeeReader(file, e.digests[index]), interrupted), e.maxLineBytes)
+		default:
+			// Regular files are hashed on their own, so that they can still be
+			// memory-mapped
+			if e.digests != nil {
+				if err := digestFile(e.digests[index], name); err != nil {
+					return err
+				}
+			}
+
+			var parse func(string) []aheadEntry
+			if e.logs == nil {
+				parse = e.parseAhead
+			}
+
+			var release func()
+			scanner, release = newFileScanner(file, e.maxLineBytes, e.mmap, parse, interrupted)
+			defer release()
+		}
+	}
+
+	e.pos = position{Input: index, Line: 1}
+	e.inputScanned = e.scanned[index]
+
+	return e.process(scanner)
+}
+
+// process reads the lines of the provided scanner and processes each line
+// to extract and print IP addresses based on the specified filters.
+func (e *expander) process(scanner lineScanner) error {
+	resuming := e.pos.Input == e.resume.Input
+	chunked, _ := scanner.(*chunkedScanner)
+
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := raw
+		if !e.strict {
+			line = normalizeLine(line)
+		}
+
+		// Skip lines already processed by a previous run, and blank lines
+		// unless in strict mode
+		if (!resuming || e.pos.Line >= e.resume.Line) && (line != "" || e.strict) {
+			if resuming && e.pos.Line == e.resume.Line {
+				e.skip = e.resume.Offset
+			}
+
+			e.lastSource, e.lastNum, e.lastLine, e.lastRaw = e.source, e.pos.Line, line, raw
+			if lines, ok := e.collector.(lineCollector); ok {
+				lines.startLine(e.source, e.pos.Line, line)
+			}
+			if chunked != nil {
+				if err := e.expandAhead(chunked.entries()); err != nil {
+					return err
+				}
+			} else if err := e.expandLine(line); err != nil {
+				return err
+			}
+		}
+
+		e.pos.Line++
+		e.pos.Offset = 0
+		if e.metrics != nil {
+			e.metrics.lines.Add(1)
+		}
+	}
+
+	return scanError(scanner, e.source, e.pos.Line, e.maxLineBytes)
+}
+
+// expandLine expands every entry found on a single line, or every address
+// field of a log line.
+func (e *expander) expandLine(line string) error {
+	entries := lineEntries(line, e.strict)
+	if e.logs != nil {
+		var err error
+		if entries, err = e.logs.entries(line); err != nil {
+			e.invalid(line, err)
+			return nil
+		}
+	}
+
+	for _, entry := range entries {
+		if err := e.expandEntry(aheadEntry{entry: entry}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAhead parses the entries of a raw line like process and expandLine
+// would, on a worker while earlier lines are still being expanded. Only the
+// entries that parse the same in any order are parsed.
+func (e *expander) parseAhead(raw string) []aheadEntry {
+	line := raw
+	if !e.strict {
+		line = normalizeLine(line)
+	}
+
+	entries := lineEntries(line, e.strict)
+	ahead := make([]aheadEntry, len(entries))
+	for i, entry := range entries {
+		ahead[i].entry = entry
+		if _, ok := cutNegation(entry); ok {
+			continue
+		}
+
+		if e.refang {
+			entry = refang(entry)
+		}
+		if _, ok := parseASN(entry); ok {
+			continue
+		}
+
+		t, err := parseEntryWith(e.parser, entry)
+		if err != nil && e.dns != nil && isHostname(entry) {
+			continue
+		}
+		ahead[i] = aheadEntry{entry: ahead[i].entry, parsed: true, t: t, err: err}
+	}
+
+	return ahead
+}
+
+// expandAhead expands the entries of a line parsed ahead.
+func (e *expander) expandAhead(entries []aheadEntry) error {
+	for _, entry := range entries {
+		if err := e.expandEntry(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandEntry parses a single entry, unless it was parsed ahead, and prints
+// the contained IP addresses based on the specified filters.
+func (e *expander) expandEntry(ahead aheadEntry) error {
+	entry := ahead.entry
+	if negated, ok := cutNegation(entry); ok {
+		return e.excludeEntry(negated)
+	}
+
+	e.entry = entry
+	e.entrySeq++
+
+	t, err := ahead.t, ahead.err
+	if !ahead.parsed {
+		t, err = e.parseEntry(entry)
+	}
+	if err != nil {
+		if e.passthrough {
+			return e.passThrough(entry)
+		}
+
+		// Report the entry but don't return an error to continue processing
+		e.invalid(entry, err)
+		return nil
+	}
+	e.expanded++
+	e.hostname = t.hostname
+	if e.keepPorts {
+		e.port = t.port
+	}
+
+	zone := t.zone
+	if e.stripZone {
+		zone = ""
+	}
+
+	prefixes := t.prefixes
+	if e.reverse {
+		prefixes = slices.Clone(prefixes)
+		slices.Reverse(prefixes)
+	}
+
+	for _, prefix := range prefixes {
+		// Prefixes outside of --min-prefix and --max-prefix are not expanded
+		if e.window != nil {
+			if outside := e.window.check(prefix); outside != nil {
+				if err := e.outsideWindow(entry, prefix, outside); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if err := e.expandPrefix(prefix, zone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// outsideWindow handles a prefix whose length is outside of the window, as
+// told by its policy: it is dropped, printed as CIDRs less the exclusions, or
+// reported as invalid. Passed single addresses are printed as such.
+func (e *expander) outsideWindow(entry string, prefix netip.Prefix, reason error) error {
+	switch e.window.policy {
+	case prefixPass:
+		parts := []addrRange{prefixRange(prefix)}
+		if !e.exclude.empty() {
+			parts = e.exclude.subtract(parts[0])
+		}
+
+		for _, part := range parts {
+			for _, p := range cidrex.RangePrefixes(part.first, part.last) {
+				var err error
+				if p.IsSingleIP() {
+					err = e.emit(p.Addr())
+				} else {
+					err = e.emitPrefix(p)
+				}
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case prefixReject:
+		e.invalid(entry, reason)
+	}
+
+	return nil
+}
+
+// parseEntry parses an entry with the parser options of the expander and
+// returns its target. ASNs such as AS13335 resolve to the prefixes they
+// announce, and defanged entries and hostnames are handled if requested. An
+// ASN whose prefixes cannot be fetched is an invalid entry.
+func (e *expander) parseEntry(entry string) (target, error) {
+	if e.refang {
+		entry = refang(entry)
+	}
+
+	asn, ok := parseASN(entry)
+	if !ok {
+		t, err := parseEntryWith(e.parser, entry)
+		if err != nil && e.dns != nil && isHostname(entry) {
+			return e.resolveHostname(entry)
+		}
+		return t, err
+	}
+
+	prefixes, err := e.asns.resolve(asn)
+	if err != nil {
+		return target{}, fmt.Errorf("unable to resolve ASN: %w", err)
+	}
+
+	// The prefixes of the AS need no lookup to be annotated with it
+	if r, ok := e.annotate.(*ripeStatAnnotator); ok {
+		r.announce(asn, prefixes)
+	}
+
+	return target{prefixes: prefixes}, nil
+}
+
+// resolveHostname resolves a hostname entry to its addresses. The error of
+// the resolver is returned when it fails.
+func (e *expander) resolveHostname(entry string) (target, error) {
+	addrs, err := e.dns.resolve(entry)
+	if err != nil {
+		return target{}, fmt.Errorf("unable to resolve hostname: %w", err)
+	}
+
+	t := target{hostname: entry}
+	for _, addr := range addrs {
+		t.prefixes = append(t.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return t, nil
+}
+
+// invalid reports an entry of the current line that cannot be parsed.
+func (e *expander) invalid(entry string, err error) {
+	e.errors.invalid(e.source, e.lastNum, e.lastRaw, entry, err)
+}
+
+// excludeEntry parses an entry negated with "!" and removes its addresses from
+// the output, unless it was already collected before processing.
+func (e *expander) excludeEntry(entry string) error {
+	t, err := e.parseEntry(entry)
+	if err != nil {
+		e.invalid("!"+entry, err)
+		return nil
+	}
+
+	if !e.inputScanned {
+		e.addExclusion(t)
+	}
+
+	return nil
+}
+
+// expandPrefix prints all IP addresses in the given prefix that are not
+// excluded, with the given IPv6 zone if not empty.
+func (e *expander) expandPrefix(prefix netip.Prefix, zone string) error {
+	r := prefixRange(prefix)
+	large := e.expandLimit != nil && prefix.Bits() < e.expandLimit.group(prefix.Addr()).Bits()
+	if e.exclude.empty() && !large {
+		return e.expandRange(r, zone)
+	}
+
+	parts := []addrRange{r}
+	if !e.exclude.empty() {
+		parts = e.exclude.subtract(r)
+	}
+	if e.reverse {
+		slices.Reverse(parts)
+	}
+
+	for _, part := range parts {
+		var err error
+		if large {
+			err = e.expandLargeRange(part, zone)
+		} else {
+			err = e.expandRange(part, zone)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandLargeRange prints the range as the minimal list of prefixes covering
+// it, expanding those of up to expandLimit addresses and printing the others as
+// CIDRs, split to expandLimit if splitLarger is set.
+func (e *expander) expandLargeRange(r addrRange, zone string) error {
+	prefixes := cidrex.RangePrefixes(r.first, r.last)
+	if e.reverse {
+		slices.Reverse(prefixes)
+	}
+
+	for _, prefix := range prefixes {
+		limit := e.expandLimit.group(prefix.Addr()).Bits()
+		if prefix.Bits() >= limit {
+			if err := e.expandRange(prefixRange(prefix), zone); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !e.splitLarger {
+			if err := e.emitPrefix(prefix); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for subnet := range cidrex.Subnets(prefix, limit) {
+			if err := e.emitPrefix(subnet); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandRange prints all IP addresses in the given range, with the given IPv6
+// zone if not empty, in descending order if reverse is set.
+func (e *expander) expandRange(r addrRange, zone string) error {
+	if e.collector != nil {
+		return e.collectRange(r)
+	}
+
+	if first := r.first.Unmap(); e.confirm != nil && (e.includeIPv4 && first.Is4() || e.includeIPv6 && first.Is6()) {
+		if err := e.confirm.check(r); err != nil {
+			return err
+		}
+	}
+
+	first, last, next := r.first, r.last, netip.Addr.Next
+	if e.reverse {
+		first, last, next = r.last, r.first, netip.Addr.Prev
+	}
+
+	for addr := first; ; addr = next(addr) {
+		var err error
+		if zone != "" {
+			err = e.emit(addr.WithZone(zone))
+		} else {
+			err = e.emit(addr)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if addr == last {
+			return nil
+		}
+	}
+}
+
+// collectRange adds a range to the collector if its family is included. Zones
+// are ignored.
+func (e *expander) collectRange(r addrRange) error {
+	// IPv4-mapped IPv6 addresses are treated as IPv4
+	if r.first.Is4In6() && r.last.Is4In6() {
+		r = addrRange{first: r.first.Unmap(), last: r.last.Unmap()}
+	}
+
+	if !(e.includeIPv4 && r.first.Is4()) && !(e.includeIPv6 && r.first.Is6()) {
+		return nil
+	}
+
+	if e.stop.Load() {
+		return errInterrupted
+	}
+
+	e.collector.add(r)
+
+	return nil
+}
+
+// emit writes the given IP address to the output if it matches the inclusion
+// criteria specified by includeIPv4 and includeIPv6, and belongs to the shard.
+func (e *expander) emit(addr netip.Addr) error {
+	// IPv4-mapped IPv6 addresses are treated as IPv4
+	addr = addr.Unmap()
+
+	if !(e.includeIPv4 && addr.Is4()) && !(e.includeIPv6 && addr.Is6()) {
+		return nil
+	}
+
+	if e.shard != nil && !e.shard.contains(addr) {
+		return nil
+	}
+
+	if e.stop.Load() {
+		return errInterrupted
+	}
+
+	e.pos.Offset++
+
+	// Already emitted by the run that wrote the checkpoint
+	if e.skip > 0 {
+		e.skip--
+		return nil
+	}
+
+	if err := e.print(addr); err != nil {
+		return err
+	}
+
+	e.emitted++
+	if e.metrics != nil {
+		e.metrics.addresses.Add(1)
+	}
+
+	return nil
+}
+
+// emitPrefix writes a prefix that is too large to expand to the output in CIDR
+// notation, if it matches the inclusion criteria. It counts as a single
+// address toward the resume position.
+func (e *expander) emitPrefix(prefix netip.Prefix) error {
+	// IPv4-mapped IPv6 prefixes are treated as IPv4
+	addr := prefix.Addr()
+	if addr.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+
+	if !(e.includeIPv4 && prefix.Addr().Is4()) && !(e.includeIPv6 && prefix.Addr().Is6()) {
+		return nil
+	}
+
+	if e.stop.Load() {
+		return errInterrupted
+	}
+
+	e.pos.Offset++
+
+	if e.skip > 0 {
+		e.skip--
+		return nil
+	}
+
+	if _, err := fmt.Fprintln(e.writer, prefix); err != nil {
+		return err
+	}
+
+	e.emitted++
+	if e.metrics != nil {
+		e.metrics.addresses.Add(1)
+	}
+
+	return nil
+}
+
+// passThrough writes an entry that is not an IP address or range to the output
+// as is. It counts as a single address toward the resume position.
+func (e *expander) passThrough(entry string) error {
+	if e.stop.Load() {
+		return errInterrupted
+	}
+
+	e.pos.Offset++
+
+	if e.skip > 0 {
+		e.skip--
+		return nil
+	}
+
+	_, err := fmt.Fprintln(e.writer, entry)
+	return err
+}
+
+// print writes the given IP address to the output, once for each port if a
+// port list was given, after filtering or probing it if requested.
+func (e *expander) print(addr netip.Addr) error {
+	rec := record{addr: addr, port: e.port, entry: e.entry, seq: e.entrySeq}
+	if e.withSource {
+		rec.source = e.source
+	}
+	if e.withHostname {
+		rec.hostname = e.hostname
+	}
+
+	if e.where != nil {
+		if ok, err := e.where.match(rec, e.source); !ok || err != nil {
+			return err
+		}
+	}
+
+	if e.ptr != nil && !e.ptr.match(rec.addr) {
+		return nil
+	}
+
+	if e.filter != nil {
+		return e.filter.submit(rec)
+	}
+
+	if e.probe != nil {
+		return e.probe.submit(rec)
+	}
+
+	return e.deliver(rec)
+}
+
+// deliver annotates the record of an address if requested, and writes it out.
+// Records annotated in bulk are held back until enough of them are pending.
+func (e *expander) deliver(rec record) error {
+	if e.annotate == nil {
+		return e.write(rec)
+	}
+
+	if _, ok := e.annotate.(bulkAnnotator); ok {
+		e.pending = append(e.pending, rec)
+		if len(e.pending) < annotateBatch {
+			return nil
+		}
+		return e.flushAnnotations()
+	}
+
+	rec.annotation = e.annotate.annotate(rec.addr)
+	return e.write(rec)
+}
+
+// flushAnnotations annotates the records held back by deliver with a single
+// bulk lookup, and writes them out.
+func (e *expander) flushAnnotations() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	bulk := e.annotate.(bulkAnnotator)
+	addrs := make([]netip.Addr, len(e.pending))
+	for i, rec := range e.pending {
+		addrs[i] = rec.addr
+	}
+	bulk.prefetch(addrs)
+
+	for _, rec := range e.pending {
+		rec.annotation = bulk.annotate(rec.addr)
+		if err := e.write(rec); err != nil {
+			return err
+		}
+	}
+	e.pending = e.pending[:0]
+
+	return nil
+}
+
+// write writes the record of an address to the output, once for each port if
+// a port list was given, or counts it in the histogram. The address is
+// pseudonymized and anonymized first if requested.
+func (e *expander) write(rec record) error {
+	if e.pan != nil {
+		rec.addr = e.pan.Anonymize(rec.addr)
+	}
+
+	if e.anonymize != nil {
+		rec.addr = e.anonymize.group(rec.addr).Addr()
+	}
+
+	if e.hist != nil {
+		e.hist.add(rec.addr, rec.seq)
+		return nil
+	}
+
+	if e.groups != nil {
+		rec.group = e.groups.group(rec.addr)
+		if err := e.startGroup(rec.group); err != nil {
+			return err
+		}
+	}
+
+	if len(e.ports) == 0 {
+		return e.format.write(e.writer, rec)
+	}
+
+	for _, port := range e.ports {
+		rec.port = port
+		if err := e.format.write(e.writer, rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// logProgress logs how far processing got when interrupted.
+func (e *expander) logProgress() {
+	if e.lastNum == 0 {
+		slog.Warn("interrupted before any input was processed", "emitted", e.emitted)
+		return
+	}
+
+	slog.Warn("interrupted", "emitted", e.emitted, "source", e.lastSource, "line", e.lastNum, "entry", e.lastLine)
+}
+
+// startGroup writes a group header if the group changed since the previous
+// record and the output format has group headers.
+func (e *expander) startGroup(group netip.Prefix) error {
+	if group == e.lastGroup {
+		return nil
+	}
+	e.lastGroup = group
+
+	if gw, ok := e.format.(groupWriter); ok {
+		return gw.writeGroup(e.writer, group)
+	}
+
+	return nil
+}
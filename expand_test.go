@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestExpandOptionsValidate(t *testing.T) {
+	tests := []struct {
+		flags string
+		args  []string
+		err   string
+	}{
+		{flags: ""},
+		{flags: "--output nft"},
+		{flags: "--dry-run --output json"},
+		{flags: "--roll-up 24 --count-duplicates", err: "--roll-up cannot be combined with --count-duplicates"},
+		{flags: "--output nft --roll-up 24", err: "--output nft cannot be combined with --roll-up"},
+		{flags: "--output nft --dry-run", err: "--dry-run cannot be combined with --output nft"},
+		{flags: "--roll-up 24 --output csv", err: "--roll-up requires --output text"},
+		{flags: "--roll-up 24 --ports 80", err: "--roll-up cannot be combined with --ports"},
+		{flags: "--output tree --resume state.json", err: "--resume is not supported with --output tree"},
+		{flags: "--invert-match", err: "--invert-match requires --ptr-match"},
+		{flags: "--with-hostname", err: "--with-hostname requires --resolve"},
+		{flags: "--prefix-policy pass", err: "--prefix-policy requires --min-prefix or --max-prefix"},
+		{flags: "--min-prefix 24 --prefix-policy pass --ports 80", err: "--prefix-policy pass cannot be combined with --ports"},
+		{flags: "--follow", args: []string{"a.txt", "b.txt"}, err: "--follow requires a single input file"},
+		{flags: "--split-files 2 --split-mode contiguous", err: "--split-mode contiguous requires input files"},
+		{flags: "--split-files 2 --split-mode other", args: []string{"a.txt"}, err: "unknown split mode: other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flags, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			opts := &expandOptions{}
+			addExpandFlags(cmd, opts)
+			if err := cmd.Flags().Parse(strings.Fields(tt.flags)); err != nil {
+				t.Fatal(err)
+			}
+
+			err := opts.validate(tt.args)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validate() error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("validate() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
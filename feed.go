@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFeedTTL is how long a downloaded feed is used before it is fetched
+// again.
+const defaultFeedTTL = 24 * time.Hour
+
+// feedTimeout bounds the time spent downloading a single feed.
+const feedTimeout = 60 * time.Second
+
+// errNotCached is returned for the feeds with no cached copy in offline mode.
+var errNotCached = errors.New("not cached and --offline was given")
+
+// feedCache tells how the cached copies of feeds are used: they are fetched
+// again once older than ttl, unless offline is set, in which case only cached
+// copies are used, whatever their age.
+type feedCache struct {
+	ttl     time.Duration
+	offline bool
+}
+
+// loadFeeds downloads the given blocklist feeds, or reads them from the cache
+// when fresh enough, and returns the set of addresses they contain. Sources
+// without a URL scheme are read as local files, unless there is no such file
+// and they are named after a dataset, such as bogons, which is read from the
+// data directory.
+func loadFeeds(sources []string, cache feedCache) (*rangeSet, error) {
+	set := &rangeSet{}
+
+	for _, source := range sources {
+		var data []byte
+		var err error
+		if d, ok := feedDataset(source); ok {
+			data, err = d.load(cache.offline)
+		} else {
+			data, err = readFeed(source, cache)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := parseFeed(bytes.NewReader(data), set); err != nil {
+			return nil, fmt.Errorf("unable to parse feed %s: %w", source, err)
+		}
+	}
+
+	set.normalize()
+
+	return set, nil
+}
+
+// feedDataset returns the dataset a feed source is named after, and whether
+// there is one. Local files take precedence over the datasets of the same
+// name.
+func feedDataset(source string) (dataset, bool) {
+	d, ok := findDataset(source)
+	if !ok {
+		return dataset{}, false
+	}
+
+	if _, err := os.Stat(source); !errors.Is(err, fs.ErrNotExist) {
+		return dataset{}, false
+	}
+
+	return d, true
+}
+
+// readFeed returns the contents of a feed.
+func readFeed(source string, cache feedCache) ([]byte, error) {
+	return readFeedWith(source, cache, downloadFeed)
+}
+
+// readFeedWith returns the contents of a feed like readFeed, fetching it with
+// download when the cache holds no fresh copy.
+func readFeedWith(source string, cache feedCache, download func(url string) ([]byte, error)) ([]byte, error) {
+	if !strings.Contains(source, "://") {
+		return os.ReadFile(source)
+	}
+
+	cacheFile, err := feedCachePath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache.offline {
+		data, err := os.ReadFile(cacheFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%s is %w", source, errNotCached)
+		}
+		return data, err
+	}
+
+	// Use the cached copy if it is recent enough
+	if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < cache.ttl {
+		slog.Debug("using cached copy of feed", "feed", source, "cache", cacheFile)
+		return os.ReadFile(cacheFile)
+	}
+
+	data, err := download(source)
+	if err != nil {
+		// A stale copy is better than no copy at all
+		if cached, cacheErr := os.ReadFile(cacheFile); cacheErr == nil {
+			slog.Warn("unable to refresh feed, using cached copy", "feed", source, "error", err)
+			return cached, nil
+		}
+
+		return nil, err
+	}
+
+	if err := writeFileAtomic(cacheFile, data); err != nil {
+		slog.Warn("unable to cache feed", "feed", source, "error", err)
+	}
+
+	return data, nil
+}
+
+// downloadFeed fetches a feed over HTTP.
+func downloadFeed(url string) ([]byte, error) {
+	client := &http.Client{Timeout: feedTimeout}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "cidrex")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download feed %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download feed %s: %w", url, err)
+	}
+
+	return data, nil
+}
+
+// feedCachePath returns the file in which a feed downloaded from url is cached.
+func feedCachePath(url string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to locate cache directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "cidrex", "feeds", hex.EncodeToString(sum[:])+".txt"), nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over filename,
+// so that concurrent readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// parseFeed adds the addresses listed in a feed to set. Feeds list one or more
+// IP addresses or CIDR ranges per line. Comments starting with "#" or ";" are
+// ignored, as are entries that cannot be parsed.
+func parseFeed(r io.Reader, set *rangeSet) error {
+	scanner := newLineScanner(r, defaultMaxLineBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+
+		for _, token := range lineEntries(normalizeLine(line), false) {
+			t, err := parseEntry(token)
+			if err != nil {
+				continue
+			}
+
+			for _, prefix := range t.prefixes {
+				set.addPrefix(prefix)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultFilterBatch is the number of addresses written to the --filter-cmd
+// command before they are flushed to it by default.
+const defaultFilterBatch = 1024
+
+// filterWindow is the number of addresses that can be written to the
+// --filter-cmd command before it answers. Once reached, writing blocks until
+// the command catches up.
+const filterWindow = 1 << 18
+
+// filterStallWarning is how long writing to the --filter-cmd command can block
+// on a full window before a warning is logged, since commands that buffer
+// their output may never answer.
+const filterStallWarning = 10 * time.Second
+
+// errFilterOrder is returned when the --filter-cmd command prints an address
+// it was not given, or not in the order it was given.
+var errFilterOrder = errors.New("not one of the pending addresses, filters must keep their input order")
+
+// filterCmd filters records through a long-running shell command. The address
+// of each record is written on a line of the command's stdin, and the command
+// keeps a record by printing its address back on stdout, in the same order,
+// optionally followed by a space and an annotation. Records whose addresses
+// are skipped are dropped. Kept records are passed to deliver from a
+// background goroutine.
+type filterCmd struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writer  *bufio.Writer
+	batch   int
+	written int
+
+	// pending holds the records written to the command that it has not
+	// answered yet
+	pending chan record
+
+	deliver func(rec record) error
+	done    chan struct{}
+
+	// mu guards err, the first error of the command or of a delivery
+	mu  sync.Mutex
+	err error
+}
+
+// newFilterCmd starts command, flushing the addresses written to it every
+// batch addresses. The command inherits stderr.
+func newFilterCmd(command string, batch int, deliver func(rec record) error) (*filterCmd, error) {
+	if batch < 1 {
+		return nil, fmt.Errorf("invalid filter batch size: %d", batch)
+	}
+
+	cmd := shellCommand(context.Background(), command)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start filter command: %w", err)
+	}
+
+	f := &filterCmd{
+		cmd:     cmd,
+		stdin:   stdin,
+		writer:  bufio.NewWriter(stdin),
+		batch:   batch,
+		pending: make(chan record, filterWindow),
+		deliver: deliver,
+		done:    make(chan struct{}),
+	}
+
+	go f.readAnswers(stdout)
+
+	return f, nil
+}
+
+// submit writes the address of rec to the command. It returns the error of a
+// previous delivery, if any.
+func (f *filterCmd) submit(rec record) error {
+	if err := f.failed(); err != nil {
+		return err
+	}
+
+	select {
+	case f.pending <- rec:
+	default:
+		// Let the command see everything it was given before waiting for it
+		if err := f.flush(); err != nil {
+			return err
+		}
+
+		stalled := time.NewTimer(filterStallWarning)
+		select {
+		case f.pending <- rec:
+		case <-stalled.C:
+			slog.Warn("filter command is not answering; filters must print their answers as they go, e.g. with grep --line-buffered", "pending", cap(f.pending), "waited", filterStallWarning)
+			f.pending <- rec
+		}
+		stalled.Stop()
+	}
+
+	line := appendAddr(f.writer.AvailableBuffer(), rec.addr)
+	if _, err := f.writer.Write(append(line, '\n')); err != nil {
+		return f.writeError(err)
+	}
+
+	f.written++
+	if f.written >= f.batch {
+		return f.flush()
+	}
+
+	return nil
+}
+
+// flush sends the addresses written so far to the command.
+func (f *filterCmd) flush() error {
+	f.written = 0
+	if err := f.writer.Flush(); err != nil {
+		return f.writeError(err)
+	}
+
+	return nil
+}
+
+// writeError describes an error writing to the command. The command closing
+// its stdin early is reported as such, unless its answers were found wrong.
+func (f *filterCmd) writeError(err error) error {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) {
+		if err := f.failed(); err != nil {
+			return err
+		}
+		return fmt.Errorf("filter command stopped reading its input")
+	}
+
+	return fmt.Errorf("unable to write to filter command: %w", err)
+}
+
+// readAnswers reads the lines printed by the command and delivers the records
+// they keep, until the command closes its stdout or fails. The remaining
+// records are then dropped as they come, so that submit never blocks on a
+// command that can no longer answer.
+func (f *filterCmd) readAnswers(stdout io.Reader) {
+	defer close(f.done)
+	defer func() {
+		for range f.pending {
+		}
+	}()
+
+	scanner := newLineScanner(stdout, defaultMaxLineBytes)
+	for scanner.Scan() {
+		field, annotation, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if field == "" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			f.fail(fmt.Errorf("invalid address printed by filter command: %s", field))
+			return
+		}
+
+		rec, ok := f.match(addr)
+		if !ok {
+			f.fail(fmt.Errorf("address printed by filter command: %s: %w", field, errFilterOrder))
+			return
+		}
+
+		rec.annotation = strings.TrimSpace(annotation)
+		if err := f.deliver(rec); err != nil {
+			f.fail(err)
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		f.fail(fmt.Errorf("unable to read from filter command: %w", err))
+	}
+}
+
+// match drops the pending records up to the first one of addr, which it
+// returns, waiting for more records if needed. It returns false once no more
+// records can come.
+func (f *filterCmd) match(addr netip.Addr) (record, bool) {
+	for rec := range f.pending {
+		if rec.addr == addr {
+			return rec, true
+		}
+	}
+
+	return record{}, false
+}
+
+// fail records the first error of the command or of a delivery.
+func (f *filterCmd) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// failed returns the first error of the command or of a delivery, if any.
+func (f *filterCmd) failed() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// wait closes the command's stdin, waits for it to answer and exit, and
+// returns the first error.
+func (f *filterCmd) wait() error {
+	flushErr := f.writer.Flush()
+	f.stdin.Close()
+	close(f.pending)
+	<-f.done
+
+	waitErr := f.cmd.Wait()
+	if err := f.failed(); err != nil {
+		return err
+	}
+
+	if waitErr != nil {
+		return fmt.Errorf("filter command failed: %w", waitErr)
+	}
+
+	if flushErr != nil {
+		return f.writeError(flushErr)
+	}
+
+	return nil
+}
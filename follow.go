@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// followPollInterval is how often a followed file is checked for new data.
+const followPollInterval = 250 * time.Millisecond
+
+// followFlushInterval is the flush interval used when following files without
+// an explicit --flush-interval, so that new addresses are not held back in
+// the output buffer.
+const followFlushInterval = 200 * time.Millisecond
+
+// followReader reads a file like tail -F: at the end of the file, it waits for
+// more data instead of returning io.EOF. If the file is replaced, as when a
+// log is rotated, the new file is opened and read from the start; if it is
+// truncated, it is read again from the start.
+type followReader struct {
+	name   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+// newFollowReader creates a followReader reading the already opened file
+// with the given name.
+func newFollowReader(name string, file *os.File) (*followReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &followReader{name: name, file: file, info: info}, nil
+}
+
+// Read implements io.Reader. It only returns once data is available or an
+// error other than io.EOF occurs.
+func (f *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.file.Read(p)
+		f.offset += int64(n)
+
+		if n > 0 {
+			return n, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		reopened, err := f.checkFile()
+		if err != nil {
+			return 0, err
+		}
+
+		if !reopened {
+			time.Sleep(followPollInterval)
+		}
+	}
+}
+
+// checkFile reopens the file if it was replaced, or rewinds it if it was
+// truncated, and reports whether there may be new data to read right away.
+func (f *followReader) checkFile() (bool, error) {
+	info, err := os.Stat(f.name)
+	if err != nil {
+		// The file may be briefly missing while it is being rotated
+		return false, nil
+	}
+
+	if !os.SameFile(info, f.info) {
+		file, err := os.Open(f.name)
+		if err != nil {
+			return false, nil
+		}
+
+		f.file.Close()
+		f.file, f.info, f.offset = file, info, 0
+		return true, nil
+	}
+
+	if info.Size() < f.offset {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// Close closes the file currently being read.
+func (f *followReader) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// record is a single expanded address to write to the output. A port of 0
+// means that no port was requested, an empty source that the input name was
+// not requested, and an invalid group that grouping was not requested. The
+// entry is the input entry the address was expanded from, and seq its
+// sequence number.
+type record struct {
+	addr   netip.Addr
+	port   uint16
+	source string
+	group  netip.Prefix
+	entry  string
+	seq    uint64
+
+	// annotation is the text added by the --filter-cmd command or by
+	// --annotate, if any
+	annotation string
+
+	// hostname is the hostname the address was resolved from, if requested
+	hostname string
+}
+
+// formatter writes records to the output in a specific format.
+type formatter interface {
+	write(w io.Writer, rec record) error
+}
+
+// headerWriter is implemented by formatters that write a header before the
+// first record.
+type headerWriter interface {
+	writeHeader(w io.Writer) error
+}
+
+// footerWriter is implemented by formatters that write something after the
+// last record, such as formats that can only be printed once complete.
+type footerWriter interface {
+	writeFooter(w io.Writer) error
+}
+
+// groupWriter is implemented by formatters that write a header line before
+// the records of each group, instead of a group field in every record.
+type groupWriter interface {
+	writeGroup(w io.Writer, group netip.Prefix) error
+}
+
+// formatOptions holds the settings shared by the output formats.
+type formatOptions struct {
+	// schemes are the URL schemes used by the urls format
+	schemes []string
+
+	// tag is a constant label added to every record, if not empty
+	tag string
+
+	// ports is set when records carry a port
+	ports bool
+
+	// source is set when records carry the name of their input
+	source bool
+
+	// hostnames is set when records carry the hostname they were resolved
+	// from
+	hostnames bool
+
+	// group is set when records carry their enclosing prefix
+	group bool
+
+	// annotations is set when records may carry an annotation
+	annotations bool
+
+	// table is the table used by the database outputs and the pf format
+	table string
+
+	// hostname is the hostname template of the hosts, dnsmasq, hosts-csv and
+	// ansible formats, if set
+	hostname string
+
+	// ansibleGroup and ansibleVars are the group of the ansible formats and
+	// its variables, written as name=value
+	ansibleGroup string
+	ansibleVars  []string
+
+	// defang defangs the addresses of the text and urls formats
+	defang bool
+
+	// setName is the name of the set written by the firewall formats, and
+	// nftTable the family and name of the table holding it in nft output
+	setName  string
+	nftTable string
+
+	// chunkSize is the number of CIDRs per chunk of the cloud formats
+	chunkSize int
+}
+
+// newFormatter returns the formatter for the named output format. Database and
+// file outputs are written as "sqlite:PATH" and "parquet:PATH".
+func newFormatter(name string, opts formatOptions) (formatter, error) {
+	if path, ok := strings.CutPrefix(name, "sqlite:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("missing database path in output format: %s", name)
+		}
+		return newSQLiteFormatter(path, opts)
+	}
+
+	if path, ok := strings.CutPrefix(name, "parquet:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("missing file path in output format: %s", name)
+		}
+		return newParquetFormatter(path, opts)
+	}
+
+	switch name {
+	case "", "text":
+		return textFormatter{tag: opts.tag, defang: opts.defang}, nil
+	case "urls":
+		schemes, err := parseSchemes(opts.schemes)
+		if err != nil {
+			return nil, err
+		}
+		return urlFormatter{schemes: schemes, tag: opts.tag, defang: opts.defang}, nil
+	case "csv":
+		return newCSVFormatter(opts), nil
+	case "json":
+		return newJSONFormatter(opts), nil
+	case "tree":
+		return newTreeFormatter(opts), nil
+	case "hosts":
+		return newHostsFormatter(opts, false)
+	case "dnsmasq":
+		return newHostsFormatter(opts, true)
+	case "hosts-csv":
+		return newHostsCSVFormatter(opts)
+	case "ansible":
+		return newAnsibleFormatter(opts, false)
+	case "ansible-yaml":
+		return newAnsibleFormatter(opts, true)
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", name)
+	}
+}
+
+// textFormatter prints one address, or ip:port pair, per line. The source, if
+// any, precedes the address followed by a colon, like grep -H, and the
+// hostname, if any, followed by a comma. The tag, if any,
+// follows the address separated by a space, and so does the annotation, if
+// any. Addresses are defanged if defang is set.
+type textFormatter struct {
+	tag    string
+	defang bool
+}
+
+func (f textFormatter) write(w io.Writer, rec record) error {
+	// The line is appended to the free space of the output buffer where
+	// possible, since this is the hottest path of large expansions
+	line := availableBuffer(w)
+	if rec.source != "" {
+		line = append(line, rec.source...)
+		line = append(line, ':')
+	}
+	if rec.hostname != "" {
+		line = append(line, rec.hostname...)
+		line = append(line, ',')
+	}
+
+	switch {
+	case f.defang:
+		line = append(line, defangHost(rec.addr, rec.port)...)
+	case rec.port != 0:
+		line = appendAddrPort(line, rec.addr, rec.port)
+	default:
+		line = appendAddr(line, rec.addr)
+	}
+
+	if f.tag != "" {
+		line = append(line, ' ')
+		line = append(line, f.tag...)
+	}
+	if rec.annotation != "" {
+		line = append(line, ' ')
+		line = append(line, rec.annotation...)
+	}
+
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
+
+// writeGroup prints the group as a comment line, such as "# 192.0.2.0/24".
+func (f textFormatter) writeGroup(w io.Writer, group netip.Prefix) error {
+	_, err := fmt.Fprintln(w, "#", group)
+	return err
+}
+
+// urlFormatter prints one URL per address and scheme, such as
+// http://192.0.2.1:8080/ or https://[2001:db8::1]/. The source, the tag and
+// the annotation are added like in the text format. The scheme and the address are defanged
+// if defang is set, as in hxxps://[2001[:]db8[:][:]1]/.
+type urlFormatter struct {
+	schemes []string
+	tag     string
+	defang  bool
+}
+
+// defaultPorts maps URL schemes to the port implied when none is given.
+var defaultPorts = map[string]uint16{
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+	"ftp":   21,
+}
+
+func (f urlFormatter) write(w io.Writer, rec record) error {
+	var host string
+	if f.defang {
+		host = defang(urlHost(rec.addr))
+	}
+
+	prefix := ""
+	if rec.source != "" {
+		prefix = rec.source + ":"
+	}
+
+	for _, scheme := range f.schemes {
+		written := scheme
+		if f.defang {
+			written = defangScheme(scheme)
+		}
+
+		line := availableBuffer(w)
+		line = append(line, prefix...)
+		line = append(line, written...)
+		line = append(line, "://"...)
+		if f.defang {
+			line = append(line, host...)
+		} else {
+			line = appendURLHost(line, rec.addr)
+		}
+		if rec.port != 0 && defaultPorts[scheme] != rec.port {
+			line = append(line, ':')
+			line = strconv.AppendUint(line, uint64(rec.port), 10)
+		}
+		line = append(line, '/')
+
+		if f.tag != "" {
+			line = append(line, ' ')
+			line = append(line, f.tag...)
+		}
+		if rec.annotation != "" {
+			line = append(line, ' ')
+			line = append(line, rec.annotation...)
+		}
+
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeGroup prints the group as a comment line, like the text format.
+func (f urlFormatter) writeGroup(w io.Writer, group netip.Prefix) error {
+	_, err := fmt.Fprintln(w, "#", group)
+	return err
+}
+
+// urlHost formats an address for the host part of a URL. IPv6 addresses are
+// enclosed in brackets, and the "%" introducing a zone is escaped as required
+// by RFC 6874.
+func urlHost(addr netip.Addr) string {
+	return string(appendURLHost(nil, addr))
+}
+
+// appendURLHost appends an address to b as formatted by urlHost.
+func appendURLHost(b []byte, addr netip.Addr) []byte {
+	if addr.Is4() {
+		return appendIPv4(b, addr.As4())
+	}
+
+	b = append(b, '[')
+	b = appendAddr(b, addr.WithZone(""))
+	if zone := addr.Zone(); zone != "" {
+		b = append(b, "%25"...)
+		b = append(b, zone...)
+	}
+
+	return append(b, ']')
+}
+
+// parseSchemes validates a list of URL schemes and normalizes them to
+// lowercase.
+func parseSchemes(schemes []string) ([]string, error) {
+	if len(schemes) == 0 {
+		return nil, fmt.Errorf("no URL scheme specified")
+	}
+
+	normalized := make([]string, 0, len(schemes))
+
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(scheme), "://"))
+		if !isValidScheme(scheme) {
+			return nil, fmt.Errorf("invalid URL scheme: %q", scheme)
+		}
+		normalized = append(normalized, scheme)
+	}
+
+	return normalized, nil
+}
+
+// isValidScheme reports whether s is a syntactically valid URL scheme as
+// defined by RFC 3986.
+func isValidScheme(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return false
+	}
+
+	for _, c := range s[1:] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// csvFormatter prints records as CSV with a header row. The source, hostname,
+// group, port, tag and annotation columns are only present when requested.
+type csvFormatter struct {
+	source      bool
+	hostnames   bool
+	group       bool
+	ports       bool
+	tag         string
+	annotations bool
+}
+
+// newCSVFormatter creates a csvFormatter. The tag is quoted once up front.
+func newCSVFormatter(opts formatOptions) csvFormatter {
+	return csvFormatter{source: opts.source, hostnames: opts.hostnames, group: opts.group, ports: opts.ports, tag: csvField(opts.tag), annotations: opts.annotations}
+}
+
+func (f csvFormatter) writeHeader(w io.Writer) error {
+	header := "ip"
+	if f.group {
+		header = "group," + header
+	}
+	if f.hostnames {
+		header = "hostname," + header
+	}
+	if f.source {
+		header = "source," + header
+	}
+	if f.ports {
+		header += ",port"
+	}
+	if f.tag != "" {
+		header += ",tag"
+	}
+	if f.annotations {
+		header += ",annotation"
+	}
+
+	_, err := fmt.Fprintln(w, header)
+	return err
+}
+
+func (f csvFormatter) write(w io.Writer, rec record) error {
+	line := availableBuffer(w)
+	if f.source {
+		line = append(line, csvField(rec.source)...)
+		line = append(line, ',')
+	}
+	if f.hostnames {
+		line = append(line, rec.hostname...)
+		line = append(line, ',')
+	}
+	if f.group {
+		line = rec.group.AppendTo(line)
+		line = append(line, ',')
+	}
+	if rec.addr.Zone() != "" {
+		line = append(line, csvField(rec.addr.String())...)
+	} else {
+		line = appendAddr(line, rec.addr)
+	}
+	if f.ports {
+		line = append(line, ',')
+		line = strconv.AppendUint(line, uint64(rec.port), 10)
+	}
+	if f.tag != "" {
+		line = append(line, ',')
+		line = append(line, f.tag...)
+	}
+	if f.annotations {
+		line = append(line, ',')
+		line = append(line, csvField(rec.annotation)...)
+	}
+
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
+
+// csvField quotes s for use as a CSV field if needed, as defined by RFC 4180.
+func csvField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// jsonFormatter prints one JSON object per line (JSON Lines), such as
+// {"ip":"192.0.2.1","port":443,"tag":"engagement-42"}. The source, the
+// hostname, the group and the annotation, if any, are added under the
+// "source", "hostname", "group" and "annotation" keys.
+type jsonFormatter struct {
+	ports bool
+	tag   string
+}
+
+// newJSONFormatter creates a jsonFormatter. The tag is encoded once up front.
+func newJSONFormatter(opts formatOptions) jsonFormatter {
+	f := jsonFormatter{ports: opts.ports}
+
+	if opts.tag != "" {
+		tag, _ := json.Marshal(opts.tag)
+		f.tag = string(tag)
+	}
+
+	return f
+}
+
+func (f jsonFormatter) write(w io.Writer, rec record) error {
+	line := append(availableBuffer(w), `{"ip":`...)
+	line = appendJSONAddr(line, rec.addr)
+	if f.ports {
+		line = append(line, `,"port":`...)
+		line = strconv.AppendUint(line, uint64(rec.port), 10)
+	}
+	if f.tag != "" {
+		line = append(line, `,"tag":`...)
+		line = append(line, f.tag...)
+	}
+	if rec.source != "" {
+		line = append(line, `,"source":`...)
+		line = appendJSONString(line, rec.source)
+	}
+	if rec.hostname != "" {
+		line = append(line, `,"hostname":`...)
+		line = appendJSONString(line, rec.hostname)
+	}
+	if rec.group.IsValid() {
+		line = append(line, `,"group":"`...)
+		line = rec.group.AppendTo(line)
+		line = append(line, '"')
+	}
+	if rec.annotation != "" {
+		line = append(line, `,"annotation":`...)
+		line = appendJSONString(line, rec.annotation)
+	}
+
+	_, err := w.Write(append(line, '}', '\n'))
+	return err
+}
+
+// appendJSONAddr appends an address to b as a JSON string. Only zones can
+// contain characters that need escaping.
+func appendJSONAddr(b []byte, addr netip.Addr) []byte {
+	if addr.Zone() != "" {
+		return appendJSONString(b, addr.String())
+	}
+
+	b = append(b, '"')
+	b = appendAddr(b, addr)
+	return append(b, '"')
+}
+
+// appendJSONString appends s to b as a JSON string. Strings of printable ASCII
+// characters that need no escaping, such as most file names, are appended
+// as is.
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			encoded, _ := json.Marshal(s)
+			return append(b, encoded...)
+		}
+	}
+
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
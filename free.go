@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// newFreeCmd creates the free subcommand.
+func newFreeCmd() *cobra.Command {
+	var within []string
+	var minSize string
+
+	cmd := &cobra.Command{
+		Use:   "free --within CIDR [filename...]",
+		Short: "Print the unallocated space within supernets",
+		Long: "Print the space within the given supernets that is not used by the IP addresses\n" +
+			"and CIDR ranges listed in the given files, or in stdin if no file is given, as\n" +
+			"a minimal list of CIDRs.\n\n" +
+			"With --min-size, only free blocks at least as large as the given prefix length\n" +
+			"are printed.",
+		Example: "  cidrex free --within 10.0.0.0/16 allocations.txt\n" +
+			"  cidrex free --within 10.0.0.0/16 --min-size /24 allocations.txt",
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(within) == 0 {
+				return fmt.Errorf("at least one --within is required")
+			}
+
+			return runFree(within, minSize, args)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&within, "within", "w", nil, "Supernet in which to look for free space (can be repeated)")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "Only print free blocks at least this large, as a prefix length such as /24")
+
+	return cmd
+}
+
+// runFree prints the free blocks of each supernet.
+func runFree(within []string, minSize string, files []string) error {
+	supernets, err := parseSupernets(within)
+	if err != nil {
+		return err
+	}
+
+	// Blocks are kept down to the size of single addresses by default
+	maxBits := -1
+	if minSize != "" {
+		if maxBits, err = parseBlockSize(minSize, supernets); err != nil {
+			return err
+		}
+	}
+
+	errs := newTextReporter()
+	set, err := readRangeSet(files, errs)
+	if err != nil {
+		return err
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	for _, supernet := range supernets {
+		bits := maxBits
+		if bits < 0 {
+			bits = supernet.Addr().BitLen()
+		}
+
+		for _, prefix := range freePrefixes(set, supernet, bits) {
+			if _, err := fmt.Fprintln(writer, prefix); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return errs.status()
+}
+
+// parseSupernets parses the prefixes given to --within or --target.
+func parseSupernets(entries []string) ([]netip.Prefix, error) {
+	var supernets []netip.Prefix
+
+	for _, entry := range entries {
+		t, err := parseEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %s", entry)
+		}
+
+		for _, prefix := range t.prefixes {
+			supernets = append(supernets, prefix.Masked())
+		}
+	}
+
+	return supernets, nil
+}
+
+// parseBlockSize parses a block size given as a prefix length, with or
+// without a leading slash, and checks that it fits in every supernet's
+// address family.
+func parseBlockSize(s string, supernets []netip.Prefix) (int, error) {
+	bits, err := strconv.Atoi(strings.TrimPrefix(s, "/"))
+	if err != nil || bits < 0 {
+		return 0, fmt.Errorf("invalid block size: %s", s)
+	}
+
+	for _, supernet := range supernets {
+		if bits > supernet.Addr().BitLen() {
+			return 0, fmt.Errorf("block size /%d is too small for %s", bits, supernet)
+		}
+	}
+
+	return bits, nil
+}
+
+// freePrefixes returns the parts of supernet that are not in set as a minimal
+// list of CIDRs in ascending order. Blocks with a prefix length greater than
+// maxBits, that is smaller blocks, are left out.
+func freePrefixes(set *rangeSet, supernet netip.Prefix, maxBits int) []netip.Prefix {
+	var free []netip.Prefix
+
+	for _, gap := range set.subtract(prefixRange(supernet)) {
+		for _, prefix := range cidrex.RangePrefixes(gap.first, gap.last) {
+			if prefix.Bits() <= maxBits {
+				free = append(free, prefix)
+			}
+		}
+	}
+
+	return free
+}
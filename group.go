@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Default prefix lengths of the groups when the group-by option only gives
+// one of them.
+const (
+	defaultGroupBits4 = 24
+	defaultGroupBits6 = 64
+)
+
+// grouping assigns addresses to their enclosing prefix of a fixed length,
+// one per address family.
+type grouping struct {
+	bits4 int
+	bits6 int
+}
+
+// parseGroupBy parses a group-by specification of the form LEN[,LEN6], where
+// LEN applies to IPv4 addresses and LEN6 to IPv6 addresses. Either length may
+// be left empty to use its default, as in ",48".
+func parseGroupBy(spec string) (*grouping, error) {
+	g := &grouping{bits4: defaultGroupBits4, bits6: defaultGroupBits6}
+
+	part4, part6, _ := strings.Cut(spec, ",")
+
+	var err error
+	if g.bits4, err = parseGroupBits(part4, 32, g.bits4); err != nil {
+		return nil, fmt.Errorf("invalid group-by: %s", spec)
+	}
+
+	if g.bits6, err = parseGroupBits(part6, 128, g.bits6); err != nil {
+		return nil, fmt.Errorf("invalid group-by: %s", spec)
+	}
+
+	return g, nil
+}
+
+// parseGroupBits parses a single prefix length, with or without a leading
+// slash, up to max. An empty string yields def.
+func parseGroupBits(s string, max, def int) (int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "/")
+	if s == "" {
+		return def, nil
+	}
+
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 0 || bits > max {
+		return 0, fmt.Errorf("invalid prefix length: %s", s)
+	}
+
+	return bits, nil
+}
+
+// group returns the prefix enclosing addr.
+func (g *grouping) group(addr netip.Addr) netip.Prefix {
+	bits := g.bits4
+	if addr.Is6() {
+		bits = g.bits6
+	}
+
+	prefix, _ := addr.WithZone("").Prefix(bits)
+	return prefix
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"sort"
+	"text/tabwriter"
+)
+
+// histogram counts the expanded addresses, or the input entries, falling into
+// each group.
+type histogram struct {
+	groups  *grouping
+	entries bool
+	counts  map[netip.Prefix]uint64
+
+	// seen holds the groups already counted for the entry with sequence
+	// number lastSeq when counting entries
+	seen    map[netip.Prefix]bool
+	lastSeq uint64
+}
+
+// newHistogram creates a histogram over the given groups. If entries is set,
+// each entry is counted once in every group it has addresses in; otherwise
+// every address is counted.
+func newHistogram(groups *grouping, entries bool) *histogram {
+	return &histogram{
+		groups:  groups,
+		entries: entries,
+		counts:  make(map[netip.Prefix]uint64),
+		seen:    make(map[netip.Prefix]bool),
+	}
+}
+
+// add counts an address expanded from the entry with the given sequence
+// number. Sequence numbers start at 1.
+func (h *histogram) add(addr netip.Addr, seq uint64) {
+	group := h.groups.group(addr)
+
+	if h.entries {
+		if seq != h.lastSeq {
+			clear(h.seen)
+			h.lastSeq = seq
+		}
+
+		if h.seen[group] {
+			return
+		}
+		h.seen[group] = true
+	}
+
+	h.counts[group]++
+}
+
+// addCount adds n to the count of a group. The count saturates instead of
+// overflowing.
+func (h *histogram) addCount(group netip.Prefix, n uint64) {
+	h.counts[group] += min(n, math.MaxUint64-h.counts[group])
+}
+
+// write prints the histogram as a table sorted by decreasing count, then by
+// prefix.
+func (h *histogram) write(w io.Writer) error {
+	return h.writeTop(w, 0)
+}
+
+// writeTop prints the limit groups with the highest counts like write, or all
+// of them if limit is 0.
+func (h *histogram) writeTop(w io.Writer, limit int) error {
+	prefixes := make([]netip.Prefix, 0, len(h.counts))
+	for prefix := range h.counts {
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		a, b := prefixes[i], prefixes[j]
+		if h.counts[a] != h.counts[b] {
+			return h.counts[a] > h.counts[b]
+		}
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+
+	if limit > 0 && len(prefixes) > limit {
+		prefixes = prefixes[:limit]
+	}
+
+	column := "ADDRESSES"
+	if h.entries {
+		column = "ENTRIES"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PREFIX\t%s\n", column)
+	for _, prefix := range prefixes {
+		fmt.Fprintf(tw, "%s\t%d\n", prefix, h.counts[prefix])
+	}
+
+	return tw.Flush()
+}
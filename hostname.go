@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hostnamePlaceholderRegex matches the placeholders replaced in hostname
+// templates, optionally followed by the width of numbers padded with zeros,
+// as in {index:3}.
+var hostnamePlaceholderRegex = regexp.MustCompile(`\{(index|subnet_index|dashed|last_octet)(?::([0-9]+))?\}`)
+
+// hostnameTemplate generates a hostname for an address from a template in
+// which {index} is replaced by the number of the address, {subnet_index} by its
+// number within its subnet, {dashed} by the address with its dots or colons
+// replaced by dashes, and {last_octet} by the last byte of the address in
+// decimal. Numbers can be padded with zeros to a width, as in {index:3}. IPv6
+// addresses are written in full in {dashed}, so that the labels never start or
+// end with a dash.
+type hostnameTemplate string
+
+// newHostnameTemplate creates a hostnameTemplate, which must contain at least
+// one placeholder for the hostnames to differ.
+func newHostnameTemplate(s string) (hostnameTemplate, error) {
+	matches := hostnamePlaceholderRegex.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("hostname template has no {index}, {subnet_index}, {dashed} or {last_octet} placeholder: %s", s)
+	}
+
+	for _, m := range matches {
+		if m[1] == "dashed" && m[2] != "" {
+			return "", fmt.Errorf("hostname template pads {dashed}, which is not a number: %s", s)
+		}
+	}
+
+	return hostnameTemplate(s), nil
+}
+
+// name returns the hostname of addr, the index-th address and the
+// subnetIndex-th of its subnet.
+func (t hostnameTemplate) name(addr netip.Addr, index, subnetIndex uint64) string {
+	return hostnamePlaceholderRegex.ReplaceAllStringFunc(string(t), func(placeholder string) string {
+		m := hostnamePlaceholderRegex.FindStringSubmatch(placeholder)
+
+		var n uint64
+		switch m[1] {
+		case "index":
+			n = index
+		case "subnet_index":
+			n = subnetIndex
+		case "last_octet":
+			n = uint64(addr.As16()[15])
+		default:
+			return dashedAddr(addr)
+		}
+
+		width, _ := strconv.Atoi(m[2])
+		return fmt.Sprintf("%0*d", width, n)
+	})
+}
+
+// unique reports whether the template gives different addresses different
+// hostnames, which {index} and {dashed} guarantee.
+func (t hostnameTemplate) unique() bool {
+	for _, m := range hostnamePlaceholderRegex.FindAllStringSubmatch(string(t), -1) {
+		if m[1] == "index" || m[1] == "dashed" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hostnameGenerator generates the hostnames of the records written by an
+// output format, {index} counting the records from 0, and {subnet_index} the
+// records of each --group-by group, or of each input entry without grouping.
+// Hostnames are kept unique: when a template such as node-{last_octet} gives
+// an address the hostname of a previous one, it is followed by -2, -3 and so
+// on.
+type hostnameGenerator struct {
+	template    hostnameTemplate
+	index       uint64
+	subnetIndex uint64
+	group       netip.Prefix
+	entry       string
+
+	// seen holds the hostnames generated so far, if the template can give
+	// the same one twice, and collided is set once that happened
+	seen     map[string]bool
+	collided bool
+}
+
+// newHostnameGenerator creates a hostnameGenerator for the template.
+func newHostnameGenerator(template hostnameTemplate) *hostnameGenerator {
+	g := &hostnameGenerator{template: template}
+	if !template.unique() {
+		g.seen = make(map[string]bool)
+	}
+
+	return g
+}
+
+// next returns the hostname of rec, the next record written.
+func (g *hostnameGenerator) next(rec record) string {
+	if rec.group != g.group || !rec.group.IsValid() && rec.entry != g.entry {
+		g.group, g.entry, g.subnetIndex = rec.group, rec.entry, 0
+	}
+
+	addr := rec.addr
+	name := g.template.name(addr, g.index, g.subnetIndex)
+	g.index++
+	g.subnetIndex++
+
+	if g.seen == nil {
+		return name
+	}
+
+	unique := name
+	for n := 2; g.seen[unique]; n++ {
+		unique = name + "-" + strconv.Itoa(n)
+	}
+	g.seen[unique] = true
+
+	if unique != name && !g.collided {
+		g.collided = true
+		slog.Warn("hostname already taken, renaming it; hostnames that collide are followed by -2, -3 and so on", "hostname", name, "addr", addr, "renamed", unique)
+	}
+
+	return unique
+}
+
+// dashedAddr returns addr with its dots or colons replaced by dashes, in full
+// for IPv6, as in 203-0-113-1 or 2001-0db8-0000-0000-0000-0000-0000-0001.
+func dashedAddr(addr netip.Addr) string {
+	addr = addr.WithZone("")
+	if addr.Is4() {
+		return strings.ReplaceAll(addr.String(), ".", "-")
+	}
+
+	return strings.ReplaceAll(addr.StringExpanded(), ":", "-")
+}
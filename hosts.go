@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// defaultHostnameTemplate is the template of the hostnames generated by the
+// hosts, dnsmasq and hosts-csv output formats.
+const defaultHostnameTemplate = "host-{dashed}"
+
+// hostsFormatter pairs each address with a hostname generated from a
+// template. It prints /etc/hosts lines, such as "192.0.2.1 host-192-0-2-1",
+// or dnsmasq address lines, such as "address=/host-192-0-2-1/192.0.2.1".
+type hostsFormatter struct {
+	names   *hostnameGenerator
+	dnsmasq bool
+}
+
+// newHostsFormatter creates a hostsFormatter, printing dnsmasq lines if
+// dnsmasq is set.
+func newHostsFormatter(opts formatOptions, dnsmasq bool) (*hostsFormatter, error) {
+	if opts.ports {
+		return nil, fmt.Errorf("hosts and dnsmasq output cannot be combined with --ports")
+	}
+
+	hostname := opts.hostname
+	if hostname == "" {
+		hostname = defaultHostnameTemplate
+	}
+
+	template, err := newHostnameTemplate(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostsFormatter{names: newHostnameGenerator(template), dnsmasq: dnsmasq}, nil
+}
+
+func (f *hostsFormatter) write(w io.Writer, rec record) error {
+	name := f.names.next(rec)
+
+	if f.dnsmasq {
+		_, err := fmt.Fprintf(w, "address=/%s/%s\n", name, rec.addr)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s\t%s\n", rec.addr, name)
+	return err
+}
+
+// writeGroup prints the group as a comment line, which both formats accept.
+func (f *hostsFormatter) writeGroup(w io.Writer, group netip.Prefix) error {
+	_, err := fmt.Fprintln(w, "#", group)
+	return err
+}
+
+// hostsCSVFormatter prints the address and generated hostname of each record
+// as CSV with a header row, as in "192.0.2.1,host-192-0-2-1", for the DNS and
+// DHCP provisioning tools that import such mappings. The group column is only
+// present when requested.
+type hostsCSVFormatter struct {
+	names *hostnameGenerator
+	group bool
+}
+
+// newHostsCSVFormatter creates a hostsCSVFormatter.
+func newHostsCSVFormatter(opts formatOptions) (*hostsCSVFormatter, error) {
+	if opts.ports {
+		return nil, fmt.Errorf("hosts-csv output cannot be combined with --ports")
+	}
+
+	hostname := opts.hostname
+	if hostname == "" {
+		hostname = defaultHostnameTemplate
+	}
+
+	template, err := newHostnameTemplate(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostsCSVFormatter{names: newHostnameGenerator(template), group: opts.group}, nil
+}
+
+func (f *hostsCSVFormatter) writeHeader(w io.Writer) error {
+	header := "ip,hostname"
+	if f.group {
+		header = "group," + header
+	}
+
+	_, err := fmt.Fprintln(w, header)
+	return err
+}
+
+func (f *hostsCSVFormatter) write(w io.Writer, rec record) error {
+	line := availableBuffer(w)
+	if f.group {
+		line = rec.group.AppendTo(line)
+		line = append(line, ',')
+	}
+	line = appendAddr(line, rec.addr)
+	line = append(line, ',')
+	line = append(line, csvField(f.names.next(rec))...)
+
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// defaultMaxLineBytes is the default length limit of an input line, large
+// enough for comma-joined dumps of many thousand ranges.
+const defaultMaxLineBytes = 64 << 20
+
+// initialLineBuffer is the initial size of the line buffer, which grows as
+// needed up to the length limit.
+const initialLineBuffer = 64 << 10
+
+// newLineScanner creates a scanner reading lines of up to maxLineBytes bytes
+// from r, or of any length if maxLineBytes is 0.
+func newLineScanner(r io.Reader, maxLineBytes int) *bufio.Scanner {
+	if maxLineBytes == 0 {
+		maxLineBytes = math.MaxInt
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(initialLineBuffer, maxLineBytes)), maxLineBytes)
+
+	return scanner
+}
+
+// scanError returns the error of a scanner, describing a line over the length
+// limit as such. line is the number of the line being read from source.
+func scanError(scanner lineScanner, source string, line, maxLineBytes int) error {
+	err := scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("line %d of %s is longer than %d bytes, see --max-line-bytes", line, source, maxLineBytes)
+	}
+
+	return err
+}
+
+// forEachEntry calls fn for every entry given on the command line, or, if
+// args is empty, for every entry read from stdin. Each argument is treated
+// like an input line and may hold several entries.
+func forEachEntry(args []string, stdin io.Reader, fn func(entry string) error) error {
+	if len(args) > 0 {
+		for _, arg := range args {
+			for _, entry := range lineEntries(normalizeLine(arg), false) {
+				if err := fn(entry); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	scanner := newLineScanner(stdin, defaultMaxLineBytes)
+	for scanner.Scan() {
+		for _, entry := range lineEntries(normalizeLine(scanner.Text()), false) {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readRangeSet reads the IP addresses and CIDR ranges listed in the named
+// files, or in stdin if no file is given, into a normalized set. Invalid
+// entries are reported to errs and skipped.
+func readRangeSet(files []string, errs *errorReporter) (*rangeSet, error) {
+	set := &rangeSet{}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	err := forEachFileTarget(files, errs, func(t target) error {
+		for _, prefix := range t.prefixes {
+			set.addPrefix(prefix)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	set.normalize()
+
+	return set, nil
+}
+
+// forEachFileTarget calls fn for every valid entry listed in the named files,
+// or in stdin for "-". Invalid entries are reported to errs and skipped.
+func forEachFileTarget(files []string, errs *errorReporter, fn func(t target) error) error {
+	for _, name := range files {
+		if err := readFileTargets(name, errs, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readFileTargets calls fn for every valid entry of a single file, or stdin
+// for "-". Invalid entries are reported to errs with the line they are on.
+func readFileTargets(name string, errs *errorReporter, fn func(t target) error) error {
+	var reader io.Reader = os.Stdin
+	source := stdinName
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader, source = file, name
+	}
+
+	scanner := newLineScanner(reader, defaultMaxLineBytes)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		raw := scanner.Text()
+
+		for _, entry := range lineEntries(normalizeLine(raw), false) {
+			t, err := parseEntry(entry)
+			if err != nil {
+				errs.invalid(source, lineNum, raw, entry, err)
+				continue
+			}
+
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanError(scanner, source, lineNum+1, defaultMaxLineBytes)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// errInterrupted is returned when processing was stopped by a signal.
+var errInterrupted = errors.New("interrupted")
+
+// notifyInterrupt stops the expander when SIGINT or SIGTERM is received. The
+// returned channel is closed at that point. After the first signal, the default
+// behavior is restored so that a second Ctrl-C terminates immediately. The
+// returned function stops listening for signals.
+func notifyInterrupt(exp *expander) (<-chan struct{}, func()) {
+	done := make(chan struct{})
+	quit := make(chan struct{})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			exp.stop.Store(true)
+			close(done)
+		case <-quit:
+			signal.Stop(signals)
+		}
+	}()
+
+	var once sync.Once
+	return done, func() { once.Do(func() { close(quit) }) }
+}
+
+// cancelReader wraps a reader so that a pending Read returns errInterrupted as
+// soon as the done channel is closed, instead of blocking until input arrives.
+type cancelReader struct {
+	reader  io.Reader
+	done    <-chan struct{}
+	buf     []byte
+	results chan readResult
+	pending bool
+}
+
+// readResult is the outcome of a Read performed in the background.
+type readResult struct {
+	n   int
+	err error
+}
+
+// newCancelReader creates a cancelReader reading from r until done is closed.
+func newCancelReader(r io.Reader, done <-chan struct{}) *cancelReader {
+	return &cancelReader{
+		reader:  r,
+		done:    done,
+		results: make(chan readResult, 1),
+	}
+}
+
+// Read implements io.Reader.
+func (c *cancelReader) Read(p []byte) (int, error) {
+	// Read into a private buffer, since the background read may still be
+	// running after we have returned to the caller
+	if !c.pending {
+		if cap(c.buf) < len(p) {
+			c.buf = make([]byte, len(p))
+		}
+		buf := c.buf[:len(p)]
+
+		c.pending = true
+		go func() {
+			n, err := c.reader.Read(buf)
+			c.results <- readResult{n, err}
+		}()
+	}
+
+	select {
+	case res := <-c.results:
+		c.pending = false
+		n := copy(p, c.buf[:res.n])
+		return n, res.err
+	case <-c.done:
+		return 0, errInterrupted
+	}
+}
+
+// checkpoint records how far an interrupted run got so it can be resumed.
+type checkpoint struct {
+	Inputs   []string `json:"inputs"`
+	Position position `json:"position"`
+}
+
+// writeCheckpoint saves a checkpoint to the named file.
+func writeCheckpoint(filename string, cp checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// readCheckpoint loads a checkpoint from the named file.
+func readCheckpoint(filename string) (checkpoint, error) {
+	var cp checkpoint
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cp, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("invalid checkpoint %s: %w", filename, err)
+	}
+
+	return cp, nil
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Resources listed by the cloud command.
+const (
+	resourceNetworks      = "networks"
+	resourceSubnets       = "subnets"
+	resourceAddresses     = "addresses"
+	resourceLoadBalancers = "load-balancers"
+)
+
+// cloudOptions holds the command-line options of the cloud command and its
+// provider subcommands.
+type cloudOptions struct {
+	ipv4      bool
+	ipv6      bool
+	expand    bool
+	resources []string
+
+	// profile and regions select the AWS account and regions, project the
+	// GCP project and subscription the Azure subscription
+	profile      string
+	regions      []string
+	project      string
+	subscription string
+}
+
+// cloudQuery is a command of a provider CLI listing one kind of resource,
+// whose JSON output is read by parse.
+type cloudQuery struct {
+	resource string
+	args     []string
+	parse    func(data []byte, inv *cloudInventory) error
+}
+
+// newCloudCmd creates the cloud subcommand and its provider subcommands.
+func newCloudCmd() *cobra.Command {
+	opts := &cloudOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cloud",
+		Short: "Print the address space of cloud accounts",
+		Long: "Print the address space of cloud accounts: the ranges of their networks and\n" +
+			"subnets, and the addresses of their static IPs and load balancers.\n\n" +
+			"Resources are listed with the CLI of each provider, aws, gcloud or az, which\n" +
+			"must be installed and logged in.",
+		Example: "  cidrex cloud aws --profile prod --region us-east-1,eu-west-1\n" +
+			"  cidrex cloud gcp --project my-project --resources addresses,load-balancers\n" +
+			"  cidrex cloud azure -4 | cidrex --probe tcp:443",
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 ranges")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 ranges")
+	flags.BoolVarP(&opts.expand, "expand", "e", false, "Print every address instead of the ranges")
+	flags.StringSliceVar(&opts.resources, "resources", []string{resourceNetworks, resourceSubnets, resourceAddresses, resourceLoadBalancers}, "Resources to list: networks, subnets, addresses or load-balancers")
+
+	aws := &cobra.Command{
+		Use:   "aws",
+		Short: "Print the address space of an AWS account",
+		Long: "Print the CIDR blocks of the VPCs and subnets, the elastic IPs and the\n" +
+			"addresses of the load balancers of an AWS account, using the aws CLI.\n\n" +
+			"The addresses of load balancers are resolved from their DNS names, and change\n" +
+			"over time unless they are assigned elastic IPs.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCloud(opts, "aws", awsQueries(opts))
+		},
+	}
+	aws.Flags().StringVar(&opts.profile, "profile", "", "Named profile of the aws CLI to use")
+	aws.Flags().StringSliceVar(&opts.regions, "region", nil, "Regions to list, e.g. us-east-1,eu-west-1 (default: the region of the profile)")
+
+	gcp := &cobra.Command{
+		Use:   "gcp",
+		Short: "Print the address space of a GCP project",
+		Long: "Print the ranges of the legacy networks and subnets, the reserved addresses\n" +
+			"and the addresses of the forwarding rules of a GCP project, using the gcloud CLI.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCloud(opts, "gcloud", gcpQueries(opts))
+		},
+	}
+	gcp.Flags().StringVar(&opts.project, "project", "", "Project to list (default: the project of the gcloud configuration)")
+
+	azure := &cobra.Command{
+		Use:   "azure",
+		Short: "Print the address space of an Azure subscription",
+		Long: "Print the address spaces of the virtual networks and subnets, the public IPs\n" +
+			"and the private frontend addresses of the load balancers of an Azure\n" +
+			"subscription, using the az CLI.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runCloud(opts, "az", azureQueries(opts))
+		},
+	}
+	azure.Flags().StringVar(&opts.subscription, "subscription", "", "Subscription to list (default: the subscription of the az CLI)")
+
+	cmd.AddCommand(aws, gcp, azure)
+
+	return cmd
+}
+
+// runCloud runs the queries of the requested resources with the named provider
+// CLI, and prints the ranges found, once each.
+func runCloud(opts *cloudOptions, cli string, queries []cloudQuery) error {
+	for _, resource := range opts.resources {
+		switch resource {
+		case resourceNetworks, resourceSubnets, resourceAddresses, resourceLoadBalancers:
+		default:
+			return fmt.Errorf("unknown resource: %s", resource)
+		}
+	}
+
+	dns, err := newDNSResolver(nil, defaultDNSTimeout)
+	if err != nil {
+		return err
+	}
+
+	// Several resources can be read from the output of a single command
+	outputs := make(map[string][]byte)
+
+	inv := &cloudInventory{dns: dns, seen: make(map[netip.Prefix]bool)}
+	for _, query := range queries {
+		if !slices.Contains(opts.resources, query.resource) {
+			continue
+		}
+
+		key := strings.Join(query.args, "\x00")
+		data, ok := outputs[key]
+		if !ok {
+			if data, err = runCloudCLI(cli, query.args); err != nil {
+				return err
+			}
+			outputs[key] = data
+		}
+
+		if err := query.parse(data, inv); err != nil {
+			return fmt.Errorf("invalid output of %s %s: %w", cli, cloudCommand(query.args), err)
+		}
+	}
+
+	includeIPv4 := opts.ipv4 || !opts.ipv4 && !opts.ipv6
+	includeIPv6 := opts.ipv6 || !opts.ipv4 && !opts.ipv6
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+	for _, prefix := range inv.prefixes {
+		if !(includeIPv4 && prefix.Addr().Is4()) && !(includeIPv6 && prefix.Addr().Is6()) {
+			continue
+		}
+
+		var err error
+		if opts.expand {
+			err = printAddrs(writer, prefix)
+		} else {
+			err = printPrefix(writer, prefix, "")
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// runCloudCLI runs a provider CLI and returns its output. The CLI inherits
+// stderr, so that its own errors, such as expired credentials, are shown.
+func runCloudCLI(cli string, args []string) ([]byte, error) {
+	cmd := exec.Command(cli, args...)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("%s not found, the %s CLI must be installed", cli, cli)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", cli, cloudCommand(args), err)
+	}
+
+	return out, nil
+}
+
+// cloudCommand returns the command of the arguments of a provider CLI, such as
+// "ec2 describe-vpcs", without its flags.
+func cloudCommand(args []string) string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return strings.Join(args[:i], " ")
+		}
+	}
+
+	return strings.Join(args, " ")
+}
+
+// cloudInventory collects the ranges of cloud resources, in the order they
+// are listed and without duplicates.
+type cloudInventory struct {
+	dns      *dnsResolver
+	prefixes []netip.Prefix
+	seen     map[netip.Prefix]bool
+}
+
+// add collects the ranges or addresses listed by a provider. Empty values,
+// for resources without an address, are skipped.
+func (inv *cloudInventory) add(values ...string) error {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		var prefix netip.Prefix
+		if strings.Contains(value, "/") {
+			p, err := netip.ParsePrefix(value)
+			if err != nil {
+				return fmt.Errorf("invalid range: %s", value)
+			}
+			prefix = p.Masked()
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return fmt.Errorf("invalid address: %s", value)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		if !inv.seen[prefix] {
+			inv.seen[prefix] = true
+			inv.prefixes = append(inv.prefixes, prefix)
+		}
+	}
+
+	return nil
+}
+
+// addHost collects the addresses of a hostname, reporting on stderr those
+// that cannot be resolved.
+func (inv *cloudInventory) addHost(host string) {
+	addrs, err := inv.dns.resolve(host)
+	if err != nil {
+		slog.Warn("unable to resolve host", "host", host, "error", err)
+	}
+
+	for _, addr := range addrs {
+		inv.add(addr.String())
+	}
+}
+
+// awsQueries returns the queries listing the resources of an AWS account, in
+// every requested region.
+func awsQueries(opts *cloudOptions) []cloudQuery {
+	regions := opts.regions
+	if len(regions) == 0 {
+		regions = []string{""}
+	}
+
+	var queries []cloudQuery
+	for _, region := range regions {
+		args := func(service, operation string) []string {
+			args := []string{service, operation, "--output", "json"}
+			if opts.profile != "" {
+				args = append(args, "--profile", opts.profile)
+			}
+			if region != "" {
+				args = append(args, "--region", region)
+			}
+			return args
+		}
+
+		queries = append(queries,
+			cloudQuery{resourceNetworks, args("ec2", "describe-vpcs"), parseAWSVPCs},
+			cloudQuery{resourceSubnets, args("ec2", "describe-subnets"), parseAWSSubnets},
+			cloudQuery{resourceAddresses, args("ec2", "describe-addresses"), parseAWSAddresses},
+			cloudQuery{resourceLoadBalancers, args("elbv2", "describe-load-balancers"), parseAWSLoadBalancers},
+		)
+	}
+
+	return queries
+}
+
+// parseAWSVPCs reads the output of aws ec2 describe-vpcs.
+func parseAWSVPCs(data []byte, inv *cloudInventory) error {
+	var resp struct {
+		Vpcs []struct {
+			CidrBlockAssociationSet []struct {
+				CidrBlock string
+			}
+			Ipv6CidrBlockAssociationSet []struct {
+				Ipv6CidrBlock string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, vpc := range resp.Vpcs {
+		for _, block := range vpc.CidrBlockAssociationSet {
+			if err := inv.add(block.CidrBlock); err != nil {
+				return err
+			}
+		}
+		for _, block := range vpc.Ipv6CidrBlockAssociationSet {
+			if err := inv.add(block.Ipv6CidrBlock); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseAWSSubnets reads the output of aws ec2 describe-subnets.
+func parseAWSSubnets(data []byte, inv *cloudInventory) error {
+	var resp struct {
+		Subnets []struct {
+			CidrBlock                   string
+			Ipv6CidrBlockAssociationSet []struct {
+				Ipv6CidrBlock string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, subnet := range resp.Subnets {
+		if err := inv.add(subnet.CidrBlock); err != nil {
+			return err
+		}
+		for _, block := range subnet.Ipv6CidrBlockAssociationSet {
+			if err := inv.add(block.Ipv6CidrBlock); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseAWSAddresses reads the elastic IPs listed by aws ec2
+// describe-addresses.
+func parseAWSAddresses(data []byte, inv *cloudInventory) error {
+	var resp struct {
+		Addresses []struct {
+			PublicIp string
+		}
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, address := range resp.Addresses {
+		if err := inv.add(address.PublicIp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAWSLoadBalancers reads the output of aws elbv2
+// describe-load-balancers. The addresses assigned to network load balancers
+// are listed, and the DNS names of all of them resolved.
+func parseAWSLoadBalancers(data []byte, inv *cloudInventory) error {
+	var resp struct {
+		LoadBalancers []struct {
+			DNSName           string
+			AvailabilityZones []struct {
+				LoadBalancerAddresses []struct {
+					IpAddress          string
+					PrivateIPv4Address string
+					IPv6Address        string
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, lb := range resp.LoadBalancers {
+		for _, zone := range lb.AvailabilityZones {
+			for _, address := range zone.LoadBalancerAddresses {
+				if err := inv.add(address.IpAddress, address.PrivateIPv4Address, address.IPv6Address); err != nil {
+					return err
+				}
+			}
+		}
+
+		if lb.DNSName != "" {
+			inv.addHost(lb.DNSName)
+		}
+	}
+
+	return nil
+}
+
+// gcpQueries returns the queries listing the resources of a GCP project.
+func gcpQueries(opts *cloudOptions) []cloudQuery {
+	args := func(command ...string) []string {
+		args := append([]string{"compute"}, command...)
+		args = append(args, "--format", "json")
+		if opts.project != "" {
+			args = append(args, "--project", opts.project)
+		}
+		return args
+	}
+
+	return []cloudQuery{
+		{resourceNetworks, args("networks", "list"), parseGCPNetworks},
+		{resourceSubnets, args("networks", "subnets", "list"), parseGCPSubnets},
+		{resourceAddresses, args("addresses", "list"), parseGCPAddresses},
+		{resourceLoadBalancers, args("forwarding-rules", "list"), parseGCPForwardingRules},
+	}
+}
+
+// parseGCPNetworks reads the ranges of the legacy networks listed by gcloud
+// compute networks list. Other networks only have ranges in their subnets.
+func parseGCPNetworks(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		IPv4Range string `json:"IPv4Range"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, network := range resp {
+		if err := inv.add(network.IPv4Range); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseGCPSubnets reads the output of gcloud compute networks subnets list.
+func parseGCPSubnets(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		IPCidrRange        string `json:"ipCidrRange"`
+		IPv6CidrRange      string `json:"ipv6CidrRange"`
+		ExternalIPv6Prefix string `json:"externalIpv6Prefix"`
+		SecondaryIPRanges  []struct {
+			IPCidrRange string `json:"ipCidrRange"`
+		} `json:"secondaryIpRanges"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, subnet := range resp {
+		if err := inv.add(subnet.IPCidrRange, subnet.IPv6CidrRange, subnet.ExternalIPv6Prefix); err != nil {
+			return err
+		}
+		for _, secondary := range subnet.SecondaryIPRanges {
+			if err := inv.add(secondary.IPCidrRange); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseGCPAddresses reads the output of gcloud compute addresses list.
+func parseGCPAddresses(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, address := range resp {
+		if err := inv.add(address.Address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseGCPForwardingRules reads the output of gcloud compute forwarding-rules
+// list, the rules being the frontends of load balancers.
+func parseGCPForwardingRules(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		IPAddress string `json:"IPAddress"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, rule := range resp {
+		if err := inv.add(rule.IPAddress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// azureQueries returns the queries listing the resources of an Azure
+// subscription.
+func azureQueries(opts *cloudOptions) []cloudQuery {
+	args := func(command ...string) []string {
+		args := append([]string{"network"}, command...)
+		args = append(args, "--output", "json")
+		if opts.subscription != "" {
+			args = append(args, "--subscription", opts.subscription)
+		}
+		return args
+	}
+
+	return []cloudQuery{
+		{resourceNetworks, args("vnet", "list"), parseAzureVNets},
+		{resourceSubnets, args("vnet", "list"), parseAzureSubnets},
+		{resourceAddresses, args("public-ip", "list"), parseAzurePublicIPs},
+		{resourceLoadBalancers, args("lb", "list"), parseAzureLoadBalancers},
+	}
+}
+
+// azureVNets is the output of az network vnet list.
+type azureVNets []struct {
+	AddressSpace struct {
+		AddressPrefixes []string `json:"addressPrefixes"`
+	} `json:"addressSpace"`
+	Subnets []struct {
+		AddressPrefix   string   `json:"addressPrefix"`
+		AddressPrefixes []string `json:"addressPrefixes"`
+	} `json:"subnets"`
+}
+
+// parseAzureVNets reads the address spaces of the virtual networks listed by
+// az network vnet list.
+func parseAzureVNets(data []byte, inv *cloudInventory) error {
+	var resp azureVNets
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, vnet := range resp {
+		if err := inv.add(vnet.AddressSpace.AddressPrefixes...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAzureSubnets reads the subnets of the virtual networks listed by az
+// network vnet list.
+func parseAzureSubnets(data []byte, inv *cloudInventory) error {
+	var resp azureVNets
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, vnet := range resp {
+		for _, subnet := range vnet.Subnets {
+			if err := inv.add(subnet.AddressPrefix); err != nil {
+				return err
+			}
+			if err := inv.add(subnet.AddressPrefixes...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseAzurePublicIPs reads the output of az network public-ip list. Public
+// IPs allocated dynamically have no address until they are in use.
+func parseAzurePublicIPs(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		IPAddress string `json:"ipAddress"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, ip := range resp {
+		if err := inv.add(ip.IPAddress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAzureLoadBalancers reads the private frontend addresses of the load
+// balancers listed by az network lb list. Public frontends are public IPs.
+func parseAzureLoadBalancers(data []byte, inv *cloudInventory) error {
+	var resp []struct {
+		FrontendIPConfigurations []struct {
+			PrivateIPAddress string `json:"privateIPAddress"`
+		} `json:"frontendIPConfigurations"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	for _, lb := range resp {
+		for _, frontend := range lb.FrontendIPConfigurations {
+			if err := inv.add(frontend.PrivateIPAddress); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
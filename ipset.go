@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// defaultSetName is the name of the sets written by the firewall output
+// formats.
+const defaultSetName = "cidrex"
+
+// ipsetDefaultMaxElem is the default maximum number of elements of an ipset
+// set, above which maxelem must be given when it is created.
+const ipsetDefaultMaxElem = 65536
+
+// ipsetFormat writes an ipset restore script creating and filling a set with
+// the prefixes, as in "ipset restore < blocklist.ipset". IPv6 prefixes go into
+// a second set whose name ends with "-v6", since ipset sets hold a single
+// family. Sets holding only addresses are of type hash:ip, and the others of
+// type hash:net. Sets are flushed before being filled, so that running the
+// script again replaces their contents.
+type ipsetFormat struct {
+	name string
+}
+
+// newIPSetFormat creates an ipsetFormat for the set named in opts.
+func newIPSetFormat(opts formatOptions) (*ipsetFormat, error) {
+	if opts.setName == "" {
+		return nil, fmt.Errorf("missing set name for --output ipset")
+	}
+
+	return &ipsetFormat{name: opts.setName}, nil
+}
+
+func (f *ipsetFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	v4, v6 := splitFamilies(prefixes)
+
+	if err := f.writeSet(w, f.name, "inet", v4); err != nil {
+		return err
+	}
+
+	return f.writeSet(w, f.name+"-v6", "inet6", v6)
+}
+
+// writeSet writes the commands creating and filling a single set. Nothing is
+// written for empty sets.
+func (f *ipsetFormat) writeSet(w io.Writer, name, family string, prefixes []netip.Prefix) error {
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	typ := "hash:ip"
+	for _, prefix := range prefixes {
+		if !prefix.IsSingleIP() {
+			typ = "hash:net"
+			break
+		}
+	}
+
+	create := fmt.Sprintf("create %s %s family %s", name, typ, family)
+	if len(prefixes) > ipsetDefaultMaxElem {
+		create += fmt.Sprintf(" maxelem %d", len(prefixes))
+	}
+
+	if _, err := fmt.Fprintf(w, "%s -exist\nflush %s\n", create, name); err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		if err := printSetElement(w, "add "+name+" ", prefix, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printSetElement prints a prefix between the given text, in CIDR notation or
+// as a plain address if it holds a single address.
+func printSetElement(w io.Writer, before string, prefix netip.Prefix, after string) error {
+	if prefix.IsSingleIP() {
+		_, err := fmt.Fprintf(w, "%s%s%s\n", before, prefix.Addr(), after)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s%s%s\n", before, prefix, after)
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// jobPool runs jobs in the background, up to a fixed number at once, and
+// counts those that fail.
+type jobPool struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	total  int
+	failed int
+}
+
+// newJobPool creates a jobPool running up to jobs jobs at once.
+func newJobPool(jobs int) (*jobPool, error) {
+	if jobs < 1 {
+		return nil, fmt.Errorf("invalid number of jobs: %d", jobs)
+	}
+
+	return &jobPool{sem: make(chan struct{}, jobs)}, nil
+}
+
+// start runs fn in the background once a slot is free. If fn fails, its error
+// is reported on stderr prefixed with name.
+func (p *jobPool) start(name string, fn func() error) {
+	p.sem <- struct{}{}
+	p.wg.Add(1)
+
+	p.mu.Lock()
+	p.total++
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+
+		if err := fn(); err != nil {
+			slog.Error("job failed", "job", name, "error", err)
+
+			p.mu.Lock()
+			p.failed++
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// wait waits for all jobs to finish and returns how many were started and how
+// many failed.
+func (p *jobPool) wait() (total, failed int) {
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.total, p.failed
+}
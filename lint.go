@@ -0,0 +1,453 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// Severities of the problems found by the lint command.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// defaultLargePrefix is the length of the prefixes above which the lint
+// command flags entries as suspiciously large, for IPv4 and IPv6.
+const defaultLargePrefix = "16,32"
+
+// reservedPrefix is a block of the IANA special-purpose address registries.
+type reservedPrefix struct {
+	prefix netip.Prefix
+	name   string
+}
+
+// reservedPrefixes are the special-purpose blocks flagged by the lint command,
+// which should seldom be in scope.
+var reservedPrefixes = []reservedPrefix{
+	{netip.MustParsePrefix("0.0.0.0/8"), "this network, RFC 791"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "private-use, RFC 1918"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "shared address space, RFC 6598"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback, RFC 1122"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link-local, RFC 3927"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "private-use, RFC 1918"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF protocol assignments, RFC 6890"},
+	{netip.MustParsePrefix("192.0.2.0/24"), "documentation, RFC 5737"},
+	{netip.MustParsePrefix("192.88.99.0/24"), "6to4 relay anycast, RFC 7526"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "private-use, RFC 1918"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking, RFC 2544"},
+	{netip.MustParsePrefix("198.51.100.0/24"), "documentation, RFC 5737"},
+	{netip.MustParsePrefix("203.0.113.0/24"), "documentation, RFC 5737"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "multicast, RFC 5771"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved, RFC 1112"},
+	{netip.MustParsePrefix("::/128"), "unspecified, RFC 4291"},
+	{netip.MustParsePrefix("::1/128"), "loopback, RFC 4291"},
+	{netip.MustParsePrefix("::ffff:0:0/96"), "IPv4-mapped, RFC 4291"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "local-use translation, RFC 8215"},
+	{netip.MustParsePrefix("100::/64"), "discard-only, RFC 6666"},
+	{netip.MustParsePrefix("2001::/23"), "IETF protocol assignments, RFC 2928"},
+	{netip.MustParsePrefix("2001:db8::/32"), "documentation, RFC 3849"},
+	{netip.MustParsePrefix("3fff::/20"), "documentation, RFC 9637"},
+	{netip.MustParsePrefix("fc00::/7"), "unique local, RFC 4193"},
+	{netip.MustParsePrefix("fe80::/10"), "link-local, RFC 4291"},
+	{netip.MustParsePrefix("ff00::/8"), "multicast, RFC 4291"},
+}
+
+// lintOptions holds the command-line options of the lint command.
+type lintOptions struct {
+	output string
+	large  string
+	failOn string
+}
+
+// lintProblem is a problem found in a scope file by the lint command. Check
+// names the kind of problem, such as host-bits.
+type lintProblem struct {
+	Source   string `json:"source"`
+	Line     int    `json:"line"`
+	Entry    string `json:"entry"`
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+
+	// file is the index of the source among the inputs
+	file int
+}
+
+// lintEntry is a valid entry of a scope file, with the ranges it stands for.
+type lintEntry struct {
+	file   int
+	source string
+	line   int
+	entry  string
+	ranges []addrRange
+}
+
+// name returns where the entry was found, such as scope.txt:3.
+func (e lintEntry) name() string {
+	return fmt.Sprintf("%s:%d", e.source, e.line)
+}
+
+// entryRange is a range of the included entry of index entry.
+type entryRange struct {
+	addrRange
+	entry int
+}
+
+// linter checks the entries of scope files. Included entries are kept to find
+// those that overlap once every file is read.
+type linter struct {
+	large    *grouping
+	entries  []lintEntry
+	problems []lintProblem
+}
+
+// newLintCmd creates the lint subcommand.
+func newLintCmd() *cobra.Command {
+	opts := &lintOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "lint [filename...]",
+		Short: "Report the problems of scope files",
+		Long: "Check the scope files given, or stdin if no file is given, and report their\n" +
+			"problems with a severity: entries that cannot be parsed are errors, while\n" +
+			"duplicate, nested and overlapping entries, prefixes with host bits set,\n" +
+			"reserved address space and suspiciously large prefixes are warnings.\n\n" +
+			"The problems are printed to stdout, and a summary to stderr. The exit status\n" +
+			"is 4 if an error was found, or a warning with --fail-on warning.",
+		Example: "  cidrex lint scope.txt\n" +
+			"  cidrex lint --output json scope.txt exclusions.txt\n" +
+			"  cidrex lint --large-prefix 20,48 --fail-on warning scope.txt",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runLint(opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.output, "output", "o", "text", "Output format: text or json")
+	flags.StringVar(&opts.large, "large-prefix", defaultLargePrefix, "Flag prefixes shorter than this length as suspiciously large, e.g. 16 or 16,32 for IPv6")
+	flags.StringVar(&opts.failOn, "fail-on", severityError, "Lowest severity that makes the exit status 4: error or warning")
+
+	return cmd
+}
+
+// runLint checks the named files, or stdin, and reports their problems.
+func runLint(opts *lintOptions, files []string) error {
+	if opts.output != "text" && opts.output != "json" {
+		return fmt.Errorf("unknown output format: %s", opts.output)
+	}
+
+	if opts.failOn != severityError && opts.failOn != severityWarning {
+		return fmt.Errorf("invalid --fail-on severity: %s", opts.failOn)
+	}
+
+	large, err := parseGroupBy(opts.large)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	l := &linter{large: large}
+	for i, name := range files {
+		if err := l.lintFile(i, name); err != nil {
+			return err
+		}
+	}
+	l.checkOverlaps()
+
+	slices.SortStableFunc(l.problems, func(a, b lintProblem) int {
+		return cmp.Or(cmp.Compare(a.file, b.file), cmp.Compare(a.Line, b.Line))
+	})
+
+	counts := make(map[string]int)
+	for _, p := range l.problems {
+		counts[p.Severity]++
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+	if opts.output == "json" {
+		err = writeLintJSON(writer, l.problems, counts)
+	} else {
+		err = writeLintText(writer, l.problems)
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("lint summary", "errors", counts[severityError], "warnings", counts[severityWarning], "infos", counts[severityInfo], "files", len(files))
+
+	if counts[severityError] > 0 || opts.failOn == severityWarning && counts[severityWarning] > 0 {
+		return &exitError{code: exitCheckFailed}
+	}
+
+	return nil
+}
+
+// lintFile checks the entries of a single file, or stdin for "-".
+func (l *linter) lintFile(file int, name string) error {
+	var reader io.Reader = os.Stdin
+	source := stdinName
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader, source = f, name
+	}
+
+	scanner := newLineScanner(reader, defaultMaxLineBytes)
+	for num := 1; scanner.Scan(); num++ {
+		for _, entry := range lineEntries(normalizeLine(scanner.Text()), false) {
+			l.check(lintEntry{file: file, source: source, line: num, entry: entry})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// report records a problem of an entry.
+func (l *linter) report(e lintEntry, severity, check, message string) {
+	l.problems = append(l.problems, lintProblem{
+		Source:   e.source,
+		Line:     e.line,
+		Entry:    e.entry,
+		Severity: severity,
+		Check:    check,
+		Message:  message,
+		file:     e.file,
+	})
+}
+
+// check checks a single entry on its own, and keeps it to be checked
+// against the others if it is included. Exclusions are only checked for
+// their syntax, since they are meant to overlap included entries. ASNs are
+// not resolved, and are not checked.
+func (l *linter) check(e lintEntry) {
+	entry, negated := cutNegation(e.entry)
+	if _, ok := parseASN(entry); ok {
+		return
+	}
+
+	t, err := parseEntryWith(cidrex.ParseOptions{}, entry)
+	if err != nil {
+		if isQualifiedHostname(entry) {
+			l.report(e, severityWarning, "hostname", "hostname, only expanded with --resolve")
+		} else {
+			l.report(e, severityError, "unparsable", err.Error())
+		}
+		return
+	}
+
+	// The pedantic parser tells what may not be what the author intended
+	if _, err := parseEntryWith(cidrex.ParseOptions{Pedantic: true}, entry); err != nil {
+		switch {
+		case errors.Is(err, cidrex.ErrHostBitsSet):
+			l.report(e, severityWarning, "host-bits", err.Error())
+		case errors.Is(err, cidrex.ErrNonCanonical):
+			l.report(e, severityInfo, "non-canonical", err.Error())
+		case errors.Is(err, cidrex.ErrInvalidZone):
+			l.report(e, severityInfo, "zone", "zones are ignored when comparing entries")
+		}
+	}
+
+	if negated {
+		return
+	}
+
+	set := &rangeSet{}
+	for _, prefix := range t.prefixes {
+		set.addPrefix(prefix)
+	}
+	set.normalize()
+	e.ranges = set.ranges
+
+	l.checkLarge(e, t.prefixes)
+	l.checkReserved(e)
+
+	l.entries = append(l.entries, e)
+}
+
+// isQualifiedHostname reports whether s is a hostname of several labels
+// ending with a top-level domain of letters, such as www.example.com. Single
+// words such as bogus, and addresses with a typo such as 10.0.0.l, are not.
+func isQualifiedHostname(s string) bool {
+	if !isHostname(s) {
+		return false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(s, "."), ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 || strings.ContainsFunc(tld, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+	}) {
+		return false
+	}
+
+	// Only numbers before the last label look like a mistyped address
+	return slices.ContainsFunc(labels[:len(labels)-1], func(label string) bool {
+		return strings.ContainsFunc(label, func(c rune) bool { return c < '0' || c > '9' })
+	})
+}
+
+// checkLarge reports the largest of the prefixes of an entry if it is shorter
+// than the large prefix length of its family.
+func (l *linter) checkLarge(e lintEntry, prefixes []netip.Prefix) {
+	var largest netip.Prefix
+	for _, prefix := range prefixes {
+		limit := l.large.group(prefix.Addr()).Bits()
+		if prefix.Bits() < limit && (!largest.IsValid() || prefix.Bits() < largest.Bits()) {
+			largest = prefix
+		}
+	}
+
+	if largest.IsValid() {
+		limit := l.large.group(largest.Addr()).Bits()
+		l.report(e, severityWarning, "large", fmt.Sprintf("%s is larger than /%d, %s addresses", largest, limit, rangeSize(prefixRange(largest))))
+	}
+}
+
+// checkReserved reports the special-purpose blocks an entry overlaps.
+func (l *linter) checkReserved(e lintEntry) {
+	var blocks []string
+	for _, reserved := range reservedPrefixes {
+		block := prefixRange(reserved.prefix)
+		if slices.ContainsFunc(e.ranges, func(r addrRange) bool { return rangesOverlap(r, block) }) {
+			blocks = append(blocks, fmt.Sprintf("%s (%s)", reserved.prefix, reserved.name))
+		}
+	}
+
+	if len(blocks) > 0 {
+		l.report(e, severityWarning, "reserved", "includes reserved space: "+strings.Join(blocks, ", "))
+	}
+}
+
+// checkOverlaps reports the included entries that are the same as, contained
+// in, contain or overlap earlier ones, sweeping over their ranges in address
+// order.
+func (l *linter) checkOverlaps() {
+	var ranges []entryRange
+	for i, e := range l.entries {
+		for _, r := range e.ranges {
+			ranges = append(ranges, entryRange{addrRange: r, entry: i})
+		}
+	}
+	slices.SortFunc(ranges, func(a, b entryRange) int {
+		return a.first.Compare(b.first)
+	})
+
+	// active holds the ranges that may still overlap those to come
+	var active []entryRange
+	seen := make(map[[2]int]bool)
+	var pairs [][2]int
+
+	for _, r := range ranges {
+		active = slices.DeleteFunc(active, func(a entryRange) bool {
+			return !rangesOverlap(a.addrRange, r.addrRange)
+		})
+
+		for _, a := range active {
+			pair := [2]int{min(a.entry, r.entry), max(a.entry, r.entry)}
+			if pair[0] != pair[1] && !seen[pair] {
+				seen[pair] = true
+				pairs = append(pairs, pair)
+			}
+		}
+		active = append(active, r)
+	}
+
+	for _, pair := range pairs {
+		earlier, later := l.entries[pair[0]], l.entries[pair[1]]
+		inner, outer := rangesContain(earlier.ranges, later.ranges), rangesContain(later.ranges, earlier.ranges)
+
+		switch {
+		case inner && outer:
+			l.report(later, severityWarning, "duplicate", fmt.Sprintf("duplicate of %s at %s", earlier.entry, earlier.name()))
+		case inner:
+			l.report(later, severityWarning, "nested", fmt.Sprintf("contained in %s at %s", earlier.entry, earlier.name()))
+		case outer:
+			l.report(later, severityWarning, "nested", fmt.Sprintf("contains %s at %s", earlier.entry, earlier.name()))
+		default:
+			l.report(later, severityWarning, "overlap", fmt.Sprintf("overlaps %s at %s", earlier.entry, earlier.name()))
+		}
+	}
+}
+
+// rangesOverlap reports whether two ranges have addresses in common. Ranges
+// of different families never do.
+func rangesOverlap(a, b addrRange) bool {
+	return a.first.Compare(b.last) <= 0 && b.first.Compare(a.last) <= 0
+}
+
+// rangesContain reports whether every range of inner is within one of outer,
+// which are disjoint and non-adjacent.
+func rangesContain(outer, inner []addrRange) bool {
+	for _, r := range inner {
+		if !slices.ContainsFunc(outer, func(o addrRange) bool {
+			return o.first.Compare(r.first) <= 0 && r.last.Compare(o.last) <= 0
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeLintText writes the problems one per line, like a compiler.
+func writeLintText(w io.Writer, problems []lintProblem) error {
+	for _, p := range problems {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s: %s: %s [%s]\n", p.Source, p.Line, p.Severity, p.Entry, p.Message, p.Check); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeLintJSON writes the problems and their count by severity as indented
+// JSON.
+func writeLintJSON(w io.Writer, problems []lintProblem, counts map[string]int) error {
+	report := struct {
+		Problems []lintProblem `json:"problems"`
+		Errors   int           `json:"errors"`
+		Warnings int           `json:"warnings"`
+		Infos    int           `json:"infos"`
+	}{
+		Problems: problems,
+		Errors:   counts[severityError],
+		Warnings: counts[severityWarning],
+		Infos:    counts[severityInfo],
+	}
+	if report.Problems == nil {
+		report.Problems = []lintProblem{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// Log formats of --log-format.
+const (
+	logText = "text"
+	logJSON = "json"
+)
+
+// logOptions holds the options of the logger, shared by every command.
+type logOptions struct {
+	level  string
+	format string
+}
+
+// addLogFlags registers the logging flags on cmd and its subcommands.
+func addLogFlags(cmd *cobra.Command, opts *logOptions) {
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.level, "log-level", "info", "Only log messages of this level or above to stderr: debug, info, warn or error")
+	flags.StringVar(&opts.format, "log-format", logText, "Format of the messages logged to stderr: text, or json for one JSON object per line")
+}
+
+// newLogger creates the logger writing messages of the given level or above to
+// w in the named format. In text format, each message is followed by its
+// attributes as key=value pairs; records of the JSON format also carry the
+// time and the level.
+func newLogger(w io.Writer, opts logOptions) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", opts.level)
+	}
+
+	switch opts.format {
+	case logText:
+		return slog.New(&plainHandler{w: w, level: level, mu: &sync.Mutex{}}), nil
+	case logJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", opts.format)
+	}
+}
+
+// plainHandler is the slog handler of the text log format, which writes each
+// record on a line of its own: its message followed by its attributes as
+// key=value pairs, values being quoted when they hold spaces or quotes, as in
+// invalid entry source=scope.txt line=2 entry=bad reason="invalid IP address".
+type plainHandler struct {
+	w     io.Writer
+	level slog.Level
+	mu    *sync.Mutex
+
+	// attrs are the attributes added with WithAttrs, already formatted, and
+	// group is the prefix of the keys of the group opened with WithGroup
+	attrs string
+	group string
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.group, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		appendAttr(&b, h.group, a)
+	}
+
+	h2 := *h
+	h2.attrs += b.String()
+	return &h2
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.group += name + "."
+	return &h2
+}
+
+// appendAttr appends an attribute to b as a space and a key=value pair, with
+// its key prefixed by group. The attributes of a group are appended each in
+// turn, and empty attributes are left out.
+func appendAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, group, ga)
+		}
+		return
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(group + a.Key)
+	b.WriteByte('=')
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '=' || r == '"' || !unicode.IsPrint(r)
+	}) {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
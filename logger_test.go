@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+func TestPlainHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{"message only", func(l *slog.Logger) { l.Warn("interrupted") }, "interrupted\n"},
+		{"attributes", func(l *slog.Logger) { l.Warn("invalid entry", "line", 2, "entry", "bad") }, "invalid entry line=2 entry=bad\n"},
+		{"quoted", func(l *slog.Logger) {
+			l.Warn("invalid entry", "source", "(standard input)", "reason", errors.New(`bad "x"`), "raw", "")
+		}, `invalid entry source="(standard input)" reason="bad \"x\"" raw=""` + "\n"},
+		{"with attrs", func(l *slog.Logger) { l.With("job", "scan").Error("job failed", "error", "boom") }, "job failed job=scan error=boom\n"},
+		{"groups", func(l *slog.Logger) {
+			l.WithGroup("feed").Info("cached", slog.Group("cache", "age", "1h"), "name", "x")
+		}, "cached feed.cache.age=1h feed.name=x\n"},
+		{"below level", func(l *slog.Logger) { l.Debug("memory-mapped input", "file", "x") }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(slog.New(&plainHandler{w: &buf, level: slog.LevelInfo, mu: &sync.Mutex{}}))
+
+			if buf.String() != tt.want {
+				t.Errorf("logged %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Input formats of the expand command, besides plain lists of entries.
+const (
+	inputText = "text"
+	inputEVE  = "eve"
+	inputZeek = "zeek"
+	inputCLF  = "clf"
+)
+
+// logParser extracts the addresses logged on each line of a log file. A new
+// parser is created for every input, since some formats, such as Zeek TSV
+// logs, declare their fields in a header.
+type logParser interface {
+	// entries returns the address fields of a line. Lines holding no address,
+	// such as headers or events without one, yield no entries.
+	entries(line string) ([]string, error)
+}
+
+// newLogParser returns a parser for the named input format, or nil for plain
+// lists of entries. xff makes web access logs read the client address from the
+// X-Forwarded-For header when logged.
+func newLogParser(format string, xff bool) (logParser, error) {
+	if xff && format != inputCLF {
+		return nil, fmt.Errorf("--xff requires --input-format clf")
+	}
+
+	switch format {
+	case "", inputText:
+		return nil, nil
+	case inputEVE:
+		return eveParser{}, nil
+	case inputZeek:
+		return &zeekParser{}, nil
+	case inputCLF:
+		return clfParser{xff: xff}, nil
+	default:
+		return nil, fmt.Errorf("unknown input format: %s", format)
+	}
+}
+
+// eveParser reads the src_ip and dest_ip fields of Suricata eve.json events.
+type eveParser struct{}
+
+func (eveParser) entries(line string) ([]string, error) {
+	var event struct {
+		SrcIP  string `json:"src_ip"`
+		DestIP string `json:"dest_ip"`
+	}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return nil, fmt.Errorf("invalid EVE event: %w", err)
+	}
+
+	return nonEmpty(event.SrcIP, event.DestIP), nil
+}
+
+// zeekParser reads the id.orig_h and id.resp_h fields of Zeek logs such as
+// conn.log, written either as TSV with a #fields header or as JSON.
+type zeekParser struct {
+	// separator splits the fields of TSV lines, and orig and resp are the
+	// indexes of the address fields, or -1 if absent
+	separator string
+	orig      int
+	resp      int
+	fields    bool
+}
+
+func (p *zeekParser) entries(line string) ([]string, error) {
+	if strings.HasPrefix(line, "{") {
+		var event struct {
+			Orig string `json:"id.orig_h"`
+			Resp string `json:"id.resp_h"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return nil, fmt.Errorf("invalid Zeek JSON record: %w", err)
+		}
+
+		return nonEmpty(event.Orig, event.Resp), nil
+	}
+
+	if header, ok := strings.CutPrefix(line, "#"); ok {
+		p.parseHeader(header)
+		return nil, nil
+	}
+
+	if !p.fields {
+		return nil, fmt.Errorf("record before the #fields header of the Zeek log")
+	}
+
+	values := strings.Split(line, p.separator)
+
+	var entries []string
+	for _, i := range []int{p.orig, p.resp} {
+		if i >= 0 && i < len(values) && values[i] != "-" {
+			entries = append(entries, values[i])
+		}
+	}
+
+	return entries, nil
+}
+
+// parseHeader reads the separator and field names from a TSV header line,
+// without its leading "#".
+func (p *zeekParser) parseHeader(header string) {
+	if p.separator == "" {
+		p.separator = "\t"
+	}
+
+	if sep, ok := strings.CutPrefix(header, "separator "); ok {
+		p.separator = unescapeZeek(sep)
+		return
+	}
+
+	names, ok := strings.CutPrefix(header, "fields"+p.separator)
+	if !ok {
+		return
+	}
+
+	p.fields, p.orig, p.resp = true, -1, -1
+	for i, name := range strings.Split(names, p.separator) {
+		switch name {
+		case "id.orig_h":
+			p.orig = i
+		case "id.resp_h":
+			p.resp = i
+		}
+	}
+}
+
+// unescapeZeek decodes the \xHH escapes that Zeek uses for the separator.
+func unescapeZeek(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// clfParser reads the client address of web access logs in the Common or
+// Combined Log Format, such as the default logs of Apache and nginx, which is
+// the first field of each line. With xff, the client address is instead the
+// first one of the X-Forwarded-For header if it is logged as the last quoted
+// field, as in the "main" format of nginx.
+type clfParser struct {
+	xff bool
+}
+
+func (p clfParser) entries(line string) ([]string, error) {
+	remote, _, ok := strings.Cut(line, " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid access log line")
+	}
+
+	if p.xff {
+		if client, ok := forwardedFor(line); ok {
+			return []string{client}, nil
+		}
+	}
+
+	return []string{remote}, nil
+}
+
+// forwardedFor returns the first address of the X-Forwarded-For header logged
+// as the last quoted field of line, and whether there is one.
+func forwardedFor(line string) (string, bool) {
+	end := strings.LastIndexByte(line, '"')
+	if end < 0 {
+		return "", false
+	}
+
+	start := strings.LastIndexByte(line[:end], '"')
+	if start < 0 {
+		return "", false
+	}
+
+	first, _, _ := strings.Cut(line[start+1:end], ",")
+	first = strings.TrimSpace(first)
+
+	if _, err := netip.ParseAddr(first); err != nil {
+		return "", false
+	}
+
+	return first, true
+}
+
+// nonEmpty returns the values that are not empty.
+func nonEmpty(values ...string) []string {
+	var entries []string
+	for _, v := range values {
+		if v != "" {
+			entries = append(entries, v)
+		}
+	}
+
+	return entries
+}
@@ -2,136 +2,149 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"io"
-	"net"
+	"log/slog"
 	"os"
+	"syscall"
 
-	"github.com/spf13/pflag"
+	"github.com/spf13/cobra"
 )
 
-func main() {
-	// Define command-line flags
-	printIPv4 := pflag.BoolP("ipv4", "4", false, "Print only IPv4 addresses")
-	printIPv6 := pflag.BoolP("ipv6", "6", false, "Print only IPv6 addresses")
-	help := pflag.BoolP("help", "h", false, "Display this help message")
+// Exit statuses, so that scripts can tell outcomes apart without parsing
+// stderr. Any other error exits with exitFatal.
+const (
+	// exitFatal means that processing failed
+	exitFatal = 1
 
-	pflag.Parse()
+	// exitInvalidInput means that processing completed, but invalid input
+	// entries were reported and skipped
+	exitInvalidInput = 2
 
-	// If help flag is set, print usage
-	if *help {
-		printUsage()
-		return
-	}
+	// exitTruncated means that processing was interrupted, so the output is
+	// incomplete
+	exitTruncated = 3
 
-	// Determine IP address filtering based on flags
-	// If neither or both flags are set, include both IPv4 and IPv6
-	includeIPv4 := *printIPv4 || !(*printIPv4) && !(*printIPv6)
-	includeIPv6 := *printIPv6 || !(*printIPv4) && !(*printIPv6)
-
-	// Determine input source: file if provided, otherwise stdin
-	var reader io.Reader
-	if len(pflag.Args()) > 0 {
-		filename := pflag.Args()[0]
-		file, err := os.Open(filename)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-		defer file.Close()
-		reader = file
-	} else {
-		reader = os.Stdin
-	}
+	// exitCheckFailed means that a check, such as covers, did not pass
+	exitCheckFailed = 4
 
-	// Create a new buffered writer to stdout
-	var writer = bufio.NewWriterSize(os.Stdout, 32*1024)
-	defer writer.Flush()
+	// exitBrokenPipe is the conventional exit status of a process terminated
+	// by SIGPIPE (128 + signal number)
+	exitBrokenPipe = 128 + 13
+)
 
-	if err := processInput(reader, writer, includeIPv4, includeIPv6); err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing input: %v\n", err)
-		os.Exit(1)
-	}
+// exitError requests a specific exit status without printing an error, for
+// outcomes that are reported on their own, such as a failed coverage check.
+type exitError struct {
+	code int
 }
 
-// processInput reads from the provided reader and processes each line
-// to extract and print IP addresses based on the specified filters.
-func processInput(reader io.Reader, writer io.Writer, includeIPv4, includeIPv6 bool) error {
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		if err := printIPsFromLine(writer, scanner.Text(), includeIPv4, includeIPv6); err != nil {
-			return err
-		}
-	}
-
-	return scanner.Err()
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
 
-// printIPsFromLine parses a single line as an IP address or CIDR range
-// and prints the contained IP addresses based on the specified filters.
-func printIPsFromLine(writer io.Writer, line string, includeIPv4, includeIPv6 bool) error {
-	// First, try parsing as a single IP address
-	ip := net.ParseIP(line)
-	if ip != nil {
-		return printIP(writer, ip, includeIPv4, includeIPv6)
+func main() {
+	// Until the flags are parsed, log like --log-format text
+	logger, _ := newLogger(os.Stderr, logOptions{level: "info", format: logText})
+	slog.SetDefault(logger)
+
+	prof := &profiler{}
+	err := newRootCmd(prof).Execute()
+
+	// The profile must be written out before exiting
+	if stopErr := prof.stop(); stopErr != nil {
+		slog.Error("unable to write profile", "error", stopErr)
 	}
 
-	// If not a single IP, try parsing as a CIDR range
-	_, ipNet, err := net.ParseCIDR(line)
 	if err != nil {
-		// Print message to stderr but don't return an error to continue processing
-		fmt.Fprintf(os.Stderr, "invalid IP or CIDR: %s\n", line)
-		return nil
-	}
+		// The consumer went away (e.g. `cidrex input.txt | head`), which is not
+		// worth reporting. This also covers the case where SIGPIPE is ignored by
+		// the parent process and writes fail with EPIPE instead.
+		if errors.Is(err, syscall.EPIPE) {
+			os.Exit(exitBrokenPipe)
+		}
 
-	// Iterate through all IPs in the CIDR range
-	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); incrementIP(ip) {
-		if err := printIP(writer, ip, includeIPv4, includeIPv6); err != nil {
-			return err
+		// Progress has already been reported
+		if errors.Is(err, errInterrupted) {
+			os.Exit(exitTruncated)
 		}
-	}
 
-	return nil
-}
+		// The outcome has already been reported
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 
-// printIP writes the given IP address to the provided writer if it matches the
-// inclusion criteria specified by includeIPv4 and includeIPv6.
-func printIP(writer io.Writer, ip net.IP, includeIPv4, includeIPv6 bool) error {
-	if (includeIPv4 && ip.To4() != nil) || (includeIPv6 && ip.To4() == nil) {
-		_, err := fmt.Fprintln(writer, ip)
-		return err
+		slog.Error("failed", "error", err)
+		os.Exit(exitFatal)
 	}
-	return nil
 }
 
-// incrementIP increments the given IP address by 1.
-// It properly handles overflow across octets/hexadecets.
-func incrementIP(ip net.IP) {
-	// Traverse the IP address from the least significant byte (rightmost) to the
-	// most significant byte (leftmost).
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++ // Increment the current byte by 1.
-
-		// If the incremented byte is not zero, there was no carry-over, and we
-		// can exit the loop. If it is zero, it means the increment caused an
-		// overflow (e.g., from 0xFF to 0x00), and we need to increment the next
-		// more significant byte.
-		if ip[j] != 0 {
-			break
-		}
+// newRootCmd creates the top-level cidrex command and registers its subcommands.
+//
+// The root command accepts the same flags and arguments as the expand subcommand
+// and runs it directly, so legacy invocations such as `cidrex input.txt` or
+// `cat input.txt | cidrex -4` keep working. The logger is set up and profiling
+// is started before any command runs; profiling must be stopped by the caller
+// once it returns.
+func newRootCmd(prof *profiler) *cobra.Command {
+	opts := &expandOptions{}
+	logOpts := &logOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cidrex [filename...]",
+		Short: "cidrex - Expand CIDR ranges",
+		Long: "cidrex - Expand CIDR ranges\n\n" +
+			"When no subcommand is given, cidrex behaves like 'cidrex expand'.",
+		Example: "  cidrex input.txt\n" +
+			"  cidrex -4 input.txt\n" +
+			"  cat input.txt | cidrex -6\n" +
+			"  cidrex expand input.txt",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+		Args: cobra.ArbitraryArgs,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			logger, err := newLogger(os.Stderr, *logOpts)
+			if err != nil {
+				return err
+			}
+			slog.SetDefault(logger)
+
+			return prof.start()
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runExpand(opts, args)
+		},
 	}
-}
 
-// printUsage displays the program usage information.
-func printUsage() {
-	fmt.Println("cidrex - Expand CIDR ranges")
-	fmt.Println("\nUsage:")
-	fmt.Println("  cidrex [OPTIONS] [filename]")
-	fmt.Println("\nOptions:")
-	pflag.PrintDefaults()
-	fmt.Println("\nExamples:")
-	fmt.Println("  cidrex input.txt")
-	fmt.Println("  cidrex -4 input.txt")
-	fmt.Println("  cat input.txt | cidrex -6")
+	addExpandFlags(cmd, opts)
+	addLogFlags(cmd, logOpts)
+	addProfileFlags(cmd, prof)
+
+	cmd.AddCommand(newExpandCmd())
+	cmd.AddCommand(newShiftCmd())
+	cmd.AddCommand(newSubnetCmd())
+	cmd.AddCommand(newRevzoneCmd())
+	cmd.AddCommand(newNextCmd())
+	cmd.AddCommand(newPrevCmd())
+	cmd.AddCommand(newCoversCmd())
+	cmd.AddCommand(newLintCmd())
+	cmd.AddCommand(newFreeCmd())
+	cmd.AddCommand(newAllocateCmd())
+	cmd.AddCommand(newASNCmd())
+	cmd.AddCommand(newCountryCmd())
+	cmd.AddCommand(newSPFCmd())
+	cmd.AddCommand(newMXCmd())
+	cmd.AddCommand(newNSCmd())
+	cmd.AddCommand(newCloudCmd())
+	cmd.AddCommand(newTerraformCmd())
+	cmd.AddCommand(newTopCmd())
+	cmd.AddCommand(newPcapCmd())
+	cmd.AddCommand(newReplCmd())
+	cmd.AddCommand(newUpdateCmd())
+
+	return cmd
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// manifest records what went into a run of expand and what came out of it,
+// so that the output can be verified, and regenerated from the same inputs,
+// arguments and version.
+type manifest struct {
+	Version   string           `json:"version"`
+	Revision  string           `json:"revision,omitempty"`
+	GoVersion string           `json:"go_version"`
+	Arguments []string         `json:"arguments"`
+	Inputs    []manifestInput  `json:"inputs"`
+	Entries   uint64           `json:"entries"`
+	Invalid   int              `json:"invalid"`
+	Addresses uint64           `json:"addresses"`
+	Output    manifestContents `json:"output"`
+	Created   time.Time        `json:"created"`
+}
+
+// manifestInput is an input of the run recorded in a manifest.
+type manifestInput struct {
+	Name string `json:"name"`
+	manifestContents
+}
+
+// manifestContents is the digest of an input or of the output.
+type manifestContents struct {
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+	Lines  int64  `json:"lines"`
+}
+
+// digest hashes and counts the bytes and lines written to it.
+type digest struct {
+	hash  hash.Hash
+	bytes int64
+	lines int64
+}
+
+// newDigest creates an empty digest.
+func newDigest() *digest {
+	return &digest{hash: sha256.New()}
+}
+
+// Write implements io.Writer.
+func (d *digest) Write(p []byte) (int, error) {
+	d.hash.Write(p)
+	d.bytes += int64(len(p))
+	d.lines += int64(bytes.Count(p, []byte{'\n'}))
+	return len(p), nil
+}
+
+// contents returns the hash and size of what was written.
+func (d *digest) contents() manifestContents {
+	return manifestContents{SHA256: hex.EncodeToString(d.hash.Sum(nil)), Bytes: d.bytes, Lines: d.lines}
+}
+
+// digestFile writes the contents of the named file to d.
+func digestFile(d *digest, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(d, file); err != nil {
+		return fmt.Errorf("unable to hash %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeManifest writes the manifest of a run that read inputs, with the given
+// digests, to the named file.
+func writeManifest(name string, inputs []string, digests []*digest, output *digest, exp *expander, invalid int) error {
+	m := manifest{
+		Version:   "(devel)",
+		GoVersion: runtime.Version(),
+		Arguments: os.Args[1:],
+		Entries:   exp.expanded,
+		Invalid:   invalid,
+		Addresses: exp.emitted,
+		Output:    output.contents(),
+		Created:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		m.Version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				m.Revision = setting.Value
+			}
+		}
+	}
+
+	for i, input := range inputs {
+		m.Inputs = append(m.Inputs, manifestInput{Name: input, manifestContents: digests[i].contents()})
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(name, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to write manifest: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMetricsInterval is the default interval at which --metrics prints
+// throughput.
+const defaultMetricsInterval = 5 * time.Second
+
+// throughput counts the work done by an expansion and logs it at a fixed
+// interval, for --metrics. The counters are updated while expanding and read
+// concurrently by the reporter. The time spent writing to the output tells
+// whether cidrex or its consumer is the bottleneck: a consumer that keeps up
+// leaves the output blocked only a small fraction of the time.
+type throughput struct {
+	addresses atomic.Uint64
+	lines     atomic.Uint64
+	bytes     atomic.Uint64
+	blocked   atomic.Int64
+
+	start time.Time
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// throughputSample is a snapshot of the counters of a throughput.
+type throughputSample struct {
+	at        time.Time
+	addresses uint64
+	lines     uint64
+	bytes     uint64
+	blocked   time.Duration
+}
+
+// startThroughput starts logging throughput every interval.
+func startThroughput(interval time.Duration) *throughput {
+	t := &throughput{start: time.Now(), done: make(chan struct{})}
+
+	t.wg.Add(1)
+	go t.reportEvery(interval)
+
+	return t
+}
+
+// meter returns a writer that writes to w, counting the bytes written and the
+// time spent writing them.
+func (t *throughput) meter(w io.Writer) io.Writer {
+	return meteredWriter{w: w, t: t}
+}
+
+// stop stops the periodic reports and logs the averages over the whole run.
+func (t *throughput) stop() {
+	close(t.done)
+	t.wg.Wait()
+
+	first := throughputSample{at: t.start}
+	last := t.sample()
+	slog.Info("metrics", append(rateAttrs(t.start, first, last), "done", true)...)
+}
+
+// reportEvery prints the throughput of each interval until stopped.
+func (t *throughput) reportEvery(interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := throughputSample{at: t.start}
+	for {
+		select {
+		case <-ticker.C:
+			cur := t.sample()
+			slog.Info("metrics", rateAttrs(t.start, prev, cur)...)
+			prev = cur
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// sample takes a snapshot of the counters.
+func (t *throughput) sample() throughputSample {
+	return throughputSample{
+		at:        time.Now(),
+		addresses: t.addresses.Load(),
+		lines:     t.lines.Load(),
+		bytes:     t.bytes.Load(),
+		blocked:   time.Duration(t.blocked.Load()),
+	}
+}
+
+// rateAttrs returns the log attributes of the throughput between two samples,
+// the last one being taken elapsed after start, and of its counters. Rates are
+// rounded to whole units per second, and the share of the time the output was
+// blocked to a percent.
+func rateAttrs(start time.Time, from, to throughputSample) []any {
+	seconds := max(to.at.Sub(from.at).Seconds(), 1e-9)
+	blocked := min(float64(to.blocked-from.blocked)/1e9/seconds, 1)
+
+	return []any{
+		"elapsed", to.at.Sub(start).Round(100 * time.Millisecond),
+		"interval_seconds", math.Round(seconds*1000) / 1000,
+		"addresses_per_second", int64(math.Round(float64(to.addresses-from.addresses) / seconds)),
+		"bytes_per_second", int64(math.Round(float64(to.bytes-from.bytes) / seconds)),
+		"lines_per_second", int64(math.Round(float64(to.lines-from.lines) / seconds)),
+		"blocked_ratio", math.Round(blocked*100) / 100,
+		"addresses", to.addresses,
+		"bytes", to.bytes,
+		"lines", to.lines,
+	}
+}
+
+// meteredWriter is the writer returned by throughput.meter.
+type meteredWriter struct {
+	w io.Writer
+	t *throughput
+}
+
+func (m meteredWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := m.w.Write(p)
+
+	m.t.bytes.Add(uint64(n))
+	m.t.blocked.Add(int64(time.Since(start)))
+
+	return n, err
+}
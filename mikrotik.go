@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// mikrotikFormat writes the prefixes as RouterOS script lines adding them to
+// a firewall address list, such as
+// "/ip firewall address-list add list=blocklist address=10.0.0.0/24", with
+// /ipv6 lines for IPv6 prefixes. The tag, if any, is the comment of every
+// entry.
+type mikrotikFormat struct {
+	list string
+	tag  string
+}
+
+// newMikroTikFormat creates a mikrotikFormat for the set name and tag in opts.
+func newMikroTikFormat(opts formatOptions) (*mikrotikFormat, error) {
+	if opts.setName == "" {
+		return nil, fmt.Errorf("missing list name for --output mikrotik")
+	}
+
+	return &mikrotikFormat{list: opts.setName, tag: opts.tag}, nil
+}
+
+func (f *mikrotikFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	suffix := ""
+	if f.tag != "" {
+		suffix = " comment=" + routerOSQuote(f.tag)
+	}
+
+	for _, prefix := range prefixes {
+		menu := "/ip"
+		if prefix.Addr().Is6() {
+			menu = "/ipv6"
+		}
+
+		before := fmt.Sprintf("%s firewall address-list add list=%s address=", menu, routerOSQuote(f.list))
+		if err := printSetElement(w, before, prefix, suffix); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routerOSQuote quotes a value for a RouterOS script if needed, escaping the
+// characters that are special within double quotes.
+func routerOSQuote(s string) string {
+	safe := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+	if safe {
+		return s
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// mmapMinSize is the size from which regular input files are memory-mapped
+// instead of read, below which the read calls saved are not worth a mapping.
+const mmapMinSize = 4 << 20
+
+// mmapCheckInterval is the number of bytes scanned from a memory-mapped file
+// between checks for an interruption.
+const mmapCheckInterval = 1 << 20
+
+// mmapChunkSize is the size of the chunks a memory-mapped file is cut into at
+// line ends, each parsed ahead by a worker.
+const mmapChunkSize = 1 << 20
+
+// lineScanner reads an input line by line. It is implemented by bufio.Scanner
+// and by mappedScanner.
+type lineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// mappedScanner splits the contents of a memory-mapped file into lines like
+// bufio.ScanLines, searching for line ends in the mapping itself instead of
+// copying the file into a buffer first. Lines over maxLineBytes stop the scan
+// with bufio.ErrTooLong, and closing done stops it with errInterrupted.
+type mappedScanner struct {
+	data         []byte
+	line         []byte
+	maxLineBytes int
+	done         <-chan struct{}
+	unchecked    int
+	err          error
+}
+
+func (s *mappedScanner) Scan() bool {
+	if s.err != nil || len(s.data) == 0 {
+		s.line = nil
+		return false
+	}
+
+	line := s.data
+	if i := bytes.IndexByte(s.data, '\n'); i >= 0 {
+		line, s.data = s.data[:i], s.data[i+1:]
+	} else {
+		s.data = nil
+	}
+
+	if s.maxLineBytes > 0 && len(line) > s.maxLineBytes {
+		s.err = bufio.ErrTooLong
+		return false
+	}
+
+	// Look for an interruption once every chunk, like a read would
+	s.unchecked += len(line) + 1
+	if s.unchecked >= mmapCheckInterval {
+		s.unchecked = 0
+
+		select {
+		case <-s.done:
+			s.err = errInterrupted
+			return false
+		default:
+		}
+	}
+
+	s.line = bytes.TrimSuffix(line, []byte{'\r'})
+	return true
+}
+
+func (s *mappedScanner) Text() string {
+	return string(s.line)
+}
+
+func (s *mappedScanner) Err() error {
+	return s.err
+}
+
+// aheadEntry is an entry of a line parsed ahead by a worker. Entries whose
+// parsing depends on the order of the input, such as exclusions, ASNs and
+// hostnames to resolve, are left unparsed.
+type aheadEntry struct {
+	entry  string
+	parsed bool
+	t      target
+	err    error
+}
+
+// aheadLine is a line of a memory-mapped file and its entries, parsed ahead.
+type aheadLine struct {
+	raw     string
+	entries []aheadEntry
+}
+
+// aheadChunk is a chunk of a memory-mapped file parsed ahead, with the error
+// that ended the scan within it, if any.
+type aheadChunk struct {
+	lines []aheadLine
+	err   error
+}
+
+// chunkedScanner scans the lines of a memory-mapped file like mappedScanner,
+// but parses them ahead on a pool of workers: the mapping is cut into chunks
+// at line ends, each chunk is handed to a worker along with a channel for its
+// result, and the channels are queued in file order so that lines come out in
+// the order they were read. Closing done stops the scan with errInterrupted.
+type chunkedScanner struct {
+	chunks  chan chan aheadChunk
+	lines   []aheadLine
+	current aheadLine
+	done    <-chan struct{}
+	err     error
+
+	// stop ends the cutting of chunks, and wg waits for it and the workers
+	// to be done with the mapping
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newChunkedScanner starts parsing the lines of data ahead with parse, on as
+// many workers as there are CPUs to run them.
+func newChunkedScanner(data []byte, maxLineBytes int, parse func(raw string) []aheadEntry, done <-chan struct{}) *chunkedScanner {
+	workers := runtime.GOMAXPROCS(0)
+	s := &chunkedScanner{
+		chunks: make(chan chan aheadChunk, workers),
+		done:   done,
+		stop:   make(chan struct{}),
+	}
+
+	slots := make(chan struct{}, workers)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(s.chunks)
+
+		for len(data) > 0 {
+			chunk := data
+			if len(data) > mmapChunkSize {
+				if i := bytes.IndexByte(data[mmapChunkSize:], '\n'); i >= 0 {
+					chunk = data[:mmapChunkSize+i+1]
+				}
+			}
+			data = data[len(chunk):]
+
+			select {
+			case slots <- struct{}{}:
+			case <-s.stop:
+				return
+			}
+
+			result := make(chan aheadChunk, 1)
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				result <- parseChunk(chunk, maxLineBytes, parse)
+				<-slots
+			}()
+
+			select {
+			case s.chunks <- result:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+// parseChunk splits a chunk of a memory-mapped file into lines like
+// mappedScanner, and parses each of them with parse. A line over maxLineBytes
+// ends the chunk with bufio.ErrTooLong.
+func parseChunk(chunk []byte, maxLineBytes int, parse func(raw string) []aheadEntry) aheadChunk {
+	var lines []aheadLine
+
+	for len(chunk) > 0 {
+		line := chunk
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line, chunk = chunk[:i], chunk[i+1:]
+		} else {
+			chunk = nil
+		}
+
+		if maxLineBytes > 0 && len(line) > maxLineBytes {
+			return aheadChunk{lines: lines, err: bufio.ErrTooLong}
+		}
+
+		raw := string(bytes.TrimSuffix(line, []byte{'\r'}))
+		lines = append(lines, aheadLine{raw: raw, entries: parse(raw)})
+	}
+
+	return aheadChunk{lines: lines}
+}
+
+func (s *chunkedScanner) Scan() bool {
+	for len(s.lines) == 0 {
+		if s.err != nil {
+			return false
+		}
+
+		var result chan aheadChunk
+		select {
+		case result = <-s.chunks:
+		case <-s.done:
+			s.err = errInterrupted
+			return false
+		}
+		if result == nil {
+			return false
+		}
+
+		select {
+		case chunk := <-result:
+			s.lines, s.err = chunk.lines, chunk.err
+		case <-s.done:
+			s.err = errInterrupted
+			return false
+		}
+	}
+
+	s.current, s.lines = s.lines[0], s.lines[1:]
+	return true
+}
+
+func (s *chunkedScanner) Text() string {
+	return s.current.raw
+}
+
+func (s *chunkedScanner) Err() error {
+	return s.err
+}
+
+// entries returns the entries of the current line, parsed ahead.
+func (s *chunkedScanner) entries() []aheadEntry {
+	return s.current.entries
+}
+
+// close stops parsing ahead and waits for the workers to be done with the
+// mapping.
+func (s *chunkedScanner) close() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// newFileScanner returns a scanner over the lines of file, which is
+// memory-mapped if mmap is set and it is a regular file of at least
+// mmapMinSize bytes, and read through a buffer otherwise, such as when the
+// platform does not support mappings. The lines of a mapped file are parsed
+// ahead with parse on a pool of workers if it is set, unless there is a single
+// CPU to run them, which would only add overhead. Closing done interrupts
+// the scan. The returned function releases the mapping, if any, once scanning
+// is done.
+func newFileScanner(file *os.File, maxLineBytes int, mmap bool, parse func(raw string) []aheadEntry, done <-chan struct{}) (lineScanner, func()) {
+	if mmap {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() && info.Size() >= mmapMinSize {
+			if data, err := mapFile(file, info.Size()); err == nil {
+				slog.Debug("memory-mapped input", "file", file.Name(), "bytes", info.Size())
+
+				if parse != nil && runtime.GOMAXPROCS(0) > 1 {
+					scanner := newChunkedScanner(data, maxLineBytes, parse, done)
+					return scanner, func() {
+						scanner.close()
+						unmapFile(data)
+					}
+				}
+
+				scanner := &mappedScanner{data: data, maxLineBytes: maxLineBytes, done: done}
+				return scanner, func() { unmapFile(data) }
+			}
+		}
+	}
+
+	return newLineScanner(newCancelReader(file, done), maxLineBytes), func() {}
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile is not supported on this platform, where input files are always
+// read through a buffer.
+func mapFile(_ *os.File, _ int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// unmapFile releases a mapping created by mapFile.
+func unmapFile(_ []byte) {}
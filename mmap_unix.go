@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps the first size bytes of file into memory, read-only, and
+// advises the kernel that they are going to be read sequentially.
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	if size > math.MaxInt {
+		return nil, fmt.Errorf("%s is too large to be mapped", file.Name())
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	// The advice only affects read-ahead, so a failure is harmless
+	unix.Madvise(data, unix.MADV_SEQUENTIAL)
+
+	return data, nil
+}
+
+// unmapFile releases a mapping created by mapFile.
+func unmapFile(data []byte) {
+	unix.Munmap(data)
+}
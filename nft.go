@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// defaultNftTable is the family and name of the nftables table holding the
+// sets written by --output nft.
+const defaultNftTable = "inet filter"
+
+// nftFormat writes the prefixes as nftables set elements. In full mode, it
+// writes an "nft -f" snippet creating the set in a table, flushing it and
+// adding the elements; otherwise, it only writes the "elements = { ... }"
+// block of each set, for inclusion in a set definition. IPv6 prefixes go into
+// a second set whose name ends with "-v6", since a set has a single type.
+type nftFormat struct {
+	name  string
+	table string
+	full  bool
+}
+
+// newNftFormat creates an nftFormat for the set and table named in opts.
+func newNftFormat(opts formatOptions, full bool) (*nftFormat, error) {
+	if opts.setName == "" {
+		return nil, fmt.Errorf("missing set name for --output nft")
+	}
+
+	table := strings.Join(strings.Fields(opts.nftTable), " ")
+	if full && strings.Count(table, " ") != 1 {
+		return nil, fmt.Errorf("invalid nftables table, expected \"FAMILY NAME\": %s", opts.nftTable)
+	}
+
+	return &nftFormat{name: opts.setName, table: table, full: full}, nil
+}
+
+func (f *nftFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	if f.full && len(prefixes) > 0 {
+		if _, err := fmt.Fprintf(w, "add table %s\n", f.table); err != nil {
+			return err
+		}
+	}
+
+	v4, v6 := splitFamilies(prefixes)
+
+	if err := f.writeSet(w, f.name, "ipv4_addr", v4); err != nil {
+		return err
+	}
+
+	return f.writeSet(w, f.name+"-v6", "ipv6_addr", v6)
+}
+
+// writeSet writes the elements of a single set. Nothing is written for empty
+// sets.
+func (f *nftFormat) writeSet(w io.Writer, name, typ string, prefixes []netip.Prefix) error {
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	var err error
+	if f.full {
+		_, err = fmt.Fprintf(w, "add set %[1]s %[2]s { type %[3]s; flags interval; }\n"+
+			"flush set %[1]s %[2]s\n"+
+			"add element %[1]s %[2]s {\n", f.table, name, typ)
+	} else {
+		_, err = fmt.Fprintf(w, "# %s (%s)\nelements = {\n", name, typ)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, prefix := range prefixes {
+		separator := ","
+		if i == len(prefixes)-1 {
+			separator = ""
+		}
+
+		if err := printSetElement(w, "\t", prefix, separator); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
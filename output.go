@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultBufferSize is the default size of the output buffer in bytes.
+const defaultBufferSize = 32 * 1024
+
+// outputWriter buffers writes to an underlying writer and optionally flushes
+// the buffer at a fixed interval, so output reaches slow consumers without
+// waiting for the buffer to fill.
+type outputWriter struct {
+	mu     sync.Mutex
+	writer *bufio.Writer
+	direct io.Writer
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newOutputWriter creates an outputWriter on top of w. A bufferSize of 0
+// disables buffering entirely. A flushInterval of 0 disables periodic flushing,
+// in which case the buffer is only flushed when full or when Close is called.
+func newOutputWriter(w io.Writer, bufferSize int, flushInterval time.Duration) *outputWriter {
+	out := &outputWriter{}
+
+	if bufferSize <= 0 {
+		out.direct = w
+		return out
+	}
+
+	out.writer = bufio.NewWriterSize(w, bufferSize)
+
+	if flushInterval > 0 {
+		out.done = make(chan struct{})
+		out.wg.Add(1)
+		go out.flushEvery(flushInterval)
+	}
+
+	return out
+}
+
+// Write implements io.Writer.
+func (o *outputWriter) Write(p []byte) (int, error) {
+	if o.direct != nil {
+		return o.direct.Write(p)
+	}
+
+	// Only pay for locking when a background flusher is running
+	if o.done == nil {
+		return o.writer.Write(p)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writer.Write(p)
+}
+
+// AvailableBuffer returns an empty slice backed by the free space of the
+// buffer, to append to and pass to Write. It returns nil when writes are not
+// buffered, or when a background flusher could flush the buffer in the
+// meantime.
+func (o *outputWriter) AvailableBuffer() []byte {
+	if o.direct != nil || o.done != nil {
+		return nil
+	}
+
+	return o.writer.AvailableBuffer()
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (o *outputWriter) Flush() error {
+	if o.direct != nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writer.Flush()
+}
+
+// Close stops the periodic flusher, if any, and flushes the remaining data.
+func (o *outputWriter) Close() error {
+	if o.done != nil {
+		close(o.done)
+		o.wg.Wait()
+	}
+
+	return o.Flush()
+}
+
+// flushEvery flushes the buffer at the given interval until Close is called.
+func (o *outputWriter) flushEvery(interval time.Duration) {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			o.Flush()
+		case <-o.done:
+			return
+		}
+	}
+}
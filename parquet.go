@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetBatchSize is the number of rows buffered before they are handed to
+// the Parquet writer.
+const parquetBatchSize = 10000
+
+// parquetRow is a row of the Parquet output. The address is stored both as
+// text and as 16 bytes, IPv4 addresses being mapped into IPv6, so that the
+// binary column sorts and compares in address order. Fields that were not
+// requested are null.
+type parquetRow struct {
+	IP      string   `parquet:"ip"`
+	IPBytes [16]byte `parquet:"ip_bytes"`
+	Port    *int32   `parquet:"port,optional"`
+	Source  *string  `parquet:"source,optional,dict"`
+	Group   *string  `parquet:"group,optional,dict"`
+	Tag     *string  `parquet:"tag,optional,dict"`
+
+	Annotation *string `parquet:"annotation,optional,dict"`
+}
+
+// parquetFormatter writes records as rows of a zstd compressed Parquet file,
+// which is created or truncated.
+type parquetFormatter struct {
+	file   *os.File
+	writer *parquet.GenericWriter[parquetRow]
+	rows   []parquetRow
+	tag    *string
+}
+
+// newParquetFormatter creates the Parquet file at path.
+func newParquetFormatter(path string, opts formatOptions) (*parquetFormatter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create parquet file: %w", err)
+	}
+
+	f := &parquetFormatter{
+		file:   file,
+		writer: parquet.NewGenericWriter[parquetRow](file, parquet.Compression(&parquet.Zstd)),
+		rows:   make([]parquetRow, 0, parquetBatchSize),
+	}
+	if opts.tag != "" {
+		f.tag = &opts.tag
+	}
+
+	return f, nil
+}
+
+func (f *parquetFormatter) write(_ io.Writer, rec record) error {
+	row := parquetRow{IP: rec.addr.String(), IPBytes: rec.addr.As16(), Tag: f.tag}
+	if rec.port != 0 {
+		port := int32(rec.port)
+		row.Port = &port
+	}
+	if rec.source != "" {
+		source := rec.source
+		row.Source = &source
+	}
+	if rec.group.IsValid() {
+		group := rec.group.String()
+		row.Group = &group
+	}
+	if rec.annotation != "" {
+		annotation := rec.annotation
+		row.Annotation = &annotation
+	}
+
+	f.rows = append(f.rows, row)
+	if len(f.rows) >= parquetBatchSize {
+		return f.flush()
+	}
+
+	return nil
+}
+
+// flush hands the buffered rows to the Parquet writer.
+func (f *parquetFormatter) flush() error {
+	if _, err := f.writer.Write(f.rows); err != nil {
+		return fmt.Errorf("unable to write parquet rows: %w", err)
+	}
+
+	f.rows = f.rows[:0]
+	return nil
+}
+
+// writeFooter writes the remaining rows and the file metadata, and closes the
+// file.
+func (f *parquetFormatter) writeFooter(_ io.Writer) error {
+	err := f.flush()
+
+	if err == nil {
+		if closeErr := f.writer.Close(); closeErr != nil {
+			err = fmt.Errorf("unable to write parquet footer: %w", closeErr)
+		}
+	}
+
+	if closeErr := f.file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("unable to close parquet file: %w", closeErr)
+	}
+
+	return err
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"unicode"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// byteOrderMark is the UTF-8 encoded byte order mark that some editors, mostly
+// on Windows, add at the start of text files.
+const byteOrderMark = "\uFEFF"
+
+// normalizeLine strips a leading byte order mark, a trailing carriage return
+// and surrounding whitespace from an input line.
+func normalizeLine(line string) string {
+	line = strings.TrimPrefix(line, byteOrderMark)
+	return strings.TrimSpace(line)
+}
+
+// splitTokens splits a line into the entries it contains. Entries can be
+// separated by commas, whitespace, or both, except within braces.
+func splitTokens(line string) []string {
+	var tokens []string
+	start, depth := -1, 0
+
+	for i, r := range line {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case depth == 0 && isTokenSeparator(r):
+			if start >= 0 {
+				tokens = append(tokens, line[start:i])
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, line[start:])
+	}
+
+	return tokens
+}
+
+// isTokenSeparator reports whether r separates entries on a line.
+func isTokenSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// lineEntries returns the entries found on a normalized line, with their
+// braces expanded. In strict mode, the whole line is a single entry. An
+// address and a mask separated by whitespace are joined into a single entry,
+// with a warning.
+func lineEntries(line string, strict bool) []string {
+	return splitEntries(line, strict, warnJoined)
+}
+
+// splitEntries implements lineEntries, calling joined, if not nil, with each
+// entry joined from an address and a mask.
+func splitEntries(line string, strict bool, joined func(entry string)) []string {
+	if strict {
+		return []string{line}
+	}
+
+	var entries []string
+	for _, token := range joinTokens(splitTokens(line), joined) {
+		if !strings.ContainsAny(token, "{}") {
+			entries = append(entries, token)
+			continue
+		}
+
+		// Entries that cannot be expanded are kept to be reported
+		expanded, err := expandBraces(token)
+		if err != nil {
+			expanded = []string{token}
+		}
+		entries = append(entries, expanded...)
+	}
+
+	return entries
+}
+
+// warnJoined warns that an address and a mask were joined into entry, since
+// they could have been meant as two addresses.
+func warnJoined(entry string) {
+	slog.Warn("read an address and a mask; write them with a slash, or on separate lines if they are two addresses", "entry", entry)
+}
+
+// joinTokens merges tokens that belong to the same entry: a lone "!" is
+// attached to the entry it negates, and an IPv4 address followed by a
+// dotted-decimal mask, as in "192.168.1.0 255.255.255.0" or
+// "10.1.0.0 0.0.255.255", becomes a single "address/mask" entry, for which
+// joined is called if not nil. Since masks such as 224.0.0.0 are also valid
+// addresses, a pair of tokens is only joined when it is alone on the line, or
+// when the mask starts with 255 or 0, as no host address does.
+func joinTokens(tokens []string, joined func(entry string)) []string {
+	negated := tokens[:0]
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "!" && i+1 < len(tokens) {
+			i++
+			token += tokens[i]
+		}
+
+		negated = append(negated, token)
+	}
+
+	entries := negated[:0]
+	for i := 0; i < len(negated); i++ {
+		token := negated[i]
+
+		if i+1 < len(negated) && isMaskPair(strings.TrimPrefix(token, "!"), negated[i+1]) &&
+			(len(negated) == 2 || strings.HasPrefix(negated[i+1], "255.") || strings.HasPrefix(negated[i+1], "0.")) {
+			i++
+			token += "/" + negated[i]
+			if joined != nil {
+				joined(token)
+			}
+		}
+
+		entries = append(entries, token)
+	}
+
+	return entries
+}
+
+// cutNegation removes the "!" marking an entry as an exclusion and reports
+// whether it was present.
+func cutNegation(entry string) (string, bool) {
+	return strings.CutPrefix(entry, "!")
+}
+
+// isMaskPair reports whether addr is a plain IPv4 address and mask is a
+// dotted-decimal netmask or wildcard mask that applies to it.
+func isMaskPair(addr, mask string) bool {
+	if strings.Contains(addr, "/") {
+		return false
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil || !ip.Is4() {
+		return false
+	}
+
+	// A netmask, which must be contiguous, is inverted into wildcard form
+	wildcard, err := cidrex.ParseMask(mask)
+	if err != nil {
+		return false
+	}
+	if netip.MustParseAddr(mask).As4()[0]&0x80 != 0 {
+		return true
+	}
+
+	// A wildcard mask. Only accept those that can't be mistaken for a second
+	// address: contiguous ones such as 0.0.255.255, or any mask starting with
+	// a zero octet such as 0.0.255.0
+	return wildcard&(wildcard+1) == 0 || wildcard>>24 == 0
+}
+
+// target is the set of addresses described by an input entry. hostname is
+// set when the entry is a hostname the addresses were resolved from, and port
+// when the entry carries a port, as in 10.0.0.0/24:8443 or [2001:db8::1]:443.
+type target struct {
+	prefixes []netip.Prefix
+	zone     string
+	hostname string
+	port     uint16
+}
+
+// parseEntry parses an input entry into the addresses it describes, in any of
+// the syntaxes accepted by cidrex.ParseTarget, optionally followed by a port
+// as in 1.2.3.4:22, or as a bracketed IPv6 literal with an optional port, as
+// found in URLs and logs.
+func parseEntry(entry string) (target, error) {
+	return parseEntryWith(cidrex.ParseOptions{}, entry)
+}
+
+// parseEntryWith parses an input entry like parseEntry, with the given parser
+// options.
+func parseEntryWith(opts cidrex.ParseOptions, entry string) (target, error) {
+	// Braces are only left in entries that could not be expanded
+	if strings.ContainsAny(entry, "{}") {
+		if _, err := expandBraces(entry); err != nil {
+			return target{}, err
+		}
+	}
+
+	host, port, bracketed, err := cutPort(entry)
+	if err != nil {
+		return target{}, err
+	}
+
+	t, err := opts.ParseTarget(host)
+	if err != nil {
+		return target{}, err
+	}
+
+	if bracketed {
+		for _, prefix := range t.Prefixes {
+			if !prefix.Addr().Is6() {
+				return target{}, fmt.Errorf("brackets are reserved for IPv6 addresses: %s", entry)
+			}
+		}
+	}
+
+	return target{prefixes: t.Prefixes, zone: t.Zone, port: port}, nil
+}
+
+// cutPort strips the port of an entry such as 1.2.3.4:22 or
+// 10.0.0.0/24:8443, and the brackets and the optional port of an entry such
+// as [2001:db8::1] or [2001:db8::1]:443, reporting whether the entry was
+// bracketed. Since IPv6 addresses hold colons, a port only follows entries
+// holding a single colon unless they are bracketed.
+func cutPort(entry string) (host string, port uint16, bracketed bool, err error) {
+	if !strings.HasPrefix(entry, "[") {
+		if strings.Count(entry, ":") != 1 {
+			return entry, 0, false, nil
+		}
+
+		host, portPart, _ := strings.Cut(entry, ":")
+		p, err := parsePort(portPart)
+		if err != nil {
+			return "", 0, false, err
+		}
+
+		return host, uint16(p), false, nil
+	}
+
+	host, rest, ok := strings.Cut(entry[1:], "]")
+	if !ok || host == "" {
+		return "", 0, false, fmt.Errorf("unterminated bracket: %s", entry)
+	}
+
+	if rest == "" {
+		return host, 0, true, nil
+	}
+
+	portPart, ok := strings.CutPrefix(rest, ":")
+	if !ok {
+		return "", 0, false, fmt.Errorf("unexpected text after bracket: %s", entry)
+	}
+
+	p, err := parsePort(portPart)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	return host, uint16(p), true, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitEntries(t *testing.T) {
+	tests := []struct {
+		line   string
+		strict bool
+		want   string
+		joined int
+	}{
+		{line: "10.0.0.1", want: "[10.0.0.1]"},
+		{line: "10.0.0.1, 10.0.0.2\t10.0.0.3", want: "[10.0.0.1 10.0.0.2 10.0.0.3]"},
+		{line: "10.0.0.1 10.0.0.2", strict: true, want: "[10.0.0.1 10.0.0.2]"},
+		{line: "10.{1, 2}.0.0", want: "[10.1.0.0 10.2.0.0]"},
+		{line: "10.{1,2.0.0", want: "[10.{1,2.0.0]"},
+		{line: "! 10.0.0.0/8 10.1.0.0", want: "[!10.0.0.0/8 10.1.0.0]"},
+
+		// Netmasks and wildcard masks separated from their address
+		{line: "192.168.1.0 255.255.255.0", want: "[192.168.1.0/255.255.255.0]", joined: 1},
+		{line: "10.1.0.0 0.0.255.255", want: "[10.1.0.0/0.0.255.255]", joined: 1},
+		{line: "10.0.0.1 0.0.255.0", want: "[10.0.0.1/0.0.255.0]", joined: 1},
+		{line: "! 10.1.0.0 0.0.255.255", want: "[!10.1.0.0/0.0.255.255]", joined: 1},
+		{line: "10.0.0.1 0.0.0.1", want: "[10.0.0.1/0.0.0.1]", joined: 1},
+		{line: "10.0.0.0 255.0.0.0, 10.1.0.0 0.0.255.255", want: "[10.0.0.0/255.0.0.0 10.1.0.0/0.0.255.255]", joined: 2},
+		{line: "10.0.0.1 224.0.0.0", want: "[10.0.0.1/224.0.0.0]", joined: 1},
+		{line: "10.0.0.1 224.0.0.0 10.0.0.2", want: "[10.0.0.1 224.0.0.0 10.0.0.2]"},
+		{line: "10.0.0.1 10.0.0.2", want: "[10.0.0.1 10.0.0.2]"},
+		{line: "10.0.0.1 255.0.255.0", want: "[10.0.0.1 255.0.255.0]"},
+		{line: "10.0.0.0/8 255.255.0.0", want: "[10.0.0.0/8 255.255.0.0]"},
+		{line: "2001:db8:: 255.255.0.0", want: "[2001:db8:: 255.255.0.0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			joined := 0
+			got := fmt.Sprint(splitEntries(tt.line, tt.strict, func(string) { joined++ }))
+			if got != tt.want || joined != tt.joined {
+				t.Errorf("splitEntries(%q) = %s, %d joined, want %s, %d joined", tt.line, got, joined, tt.want, tt.joined)
+			}
+		})
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+		port  uint16
+		err   bool
+	}{
+		{entry: "10.0.0.0/24", want: "[10.0.0.0/24]"},
+		{entry: "10.0.0.1:22", want: "[10.0.0.1/32]", port: 22},
+		{entry: "10.0.0.0/24:8443", want: "[10.0.0.0/24]", port: 8443},
+		{entry: "[2001:db8::1]:443", want: "[2001:db8::1/128]", port: 443},
+		{entry: "[2001:db8::1]", want: "[2001:db8::1/128]"},
+		{entry: "2001:db8::1", want: "[2001:db8::1/128]"},
+		{entry: "10.0.0.1:0", err: true},
+		{entry: "10.0.0.1:65536", err: true},
+		{entry: "not an address", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := parseEntry(tt.entry)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseEntry(%s) = %v, want an error", tt.entry, got.prefixes)
+				}
+				return
+			}
+
+			if s := fmt.Sprint(got.prefixes); err != nil || s != tt.want || got.port != tt.port {
+				t.Errorf("parseEntry(%s) = %s port %d, %v, want %s port %d", tt.entry, s, got.port, err, tt.want, tt.port)
+			}
+		})
+	}
+}
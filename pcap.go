@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/spf13/cobra"
+)
+
+// pcapngMagic is the block type of the section header that starts pcapng
+// files.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// Addresses extracted from the packets by the pcap command.
+const (
+	pcapBoth = "both"
+	pcapSrc  = "src"
+	pcapDst  = "dst"
+)
+
+// newPcapCmd creates the pcap subcommand.
+func newPcapCmd() *cobra.Command {
+	opts := &expandOptions{}
+	var direction string
+
+	cmd := &cobra.Command{
+		Use:   "pcap [flags] capture...",
+		Short: "Expand the IP addresses observed in packet captures",
+		Long: "Extract the unique IP addresses observed in pcap or pcapng packet captures,\n" +
+			"and print them like the expand command, in ascending order.\n\n" +
+			"The options of the expand command apply to the extracted addresses. Use '-'\n" +
+			"to read a capture from stdin.",
+		Example: "  cidrex pcap capture.pcapng\n" +
+			"  cidrex pcap --direction src --roll-up 24 capture.pcap\n" +
+			"  tcpdump -w - -c 1000 | cidrex pcap -6 -",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runPcap(opts, direction, args)
+		},
+	}
+
+	addExpandFlags(cmd, opts)
+	cmd.Flags().StringVar(&direction, "direction", pcapBoth, "Addresses to extract from each packet: both, src or dst")
+
+	return cmd
+}
+
+// runPcap expands the addresses observed in the captures and prints them to
+// stdout.
+func runPcap(opts *expandOptions, direction string, captures []string) error {
+	if direction != pcapBoth && direction != pcapSrc && direction != pcapDst {
+		return fmt.Errorf("unknown direction: %s", direction)
+	}
+
+	if opts.follow || opts.watch {
+		return fmt.Errorf("--follow and --watch are not supported with packet captures")
+	}
+
+	seen := make(map[netip.Addr]struct{})
+	for _, name := range captures {
+		if err := readCapture(name, direction, seen); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, len(seen))
+	for addr := range seen {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+
+	var input bytes.Buffer
+	for _, addr := range addrs {
+		input.WriteString(addr.String())
+		input.WriteByte('\n')
+	}
+
+	opts.stdin = &input
+	opts.stdinName = captures[0]
+	if len(captures) > 1 {
+		opts.stdinName = "(packet captures)"
+	}
+
+	return expandTo(opts, nil, os.Stdout)
+}
+
+// packetReader is implemented by the pcap and pcapng readers.
+type packetReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// readCapture adds the addresses of the packets in the named capture, or in
+// stdin for "-", to seen.
+func readCapture(name, direction string, seen map[netip.Addr]struct{}) error {
+	var file io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		file = f
+	}
+
+	buffered := bufio.NewReader(file)
+	magic, err := buffered.Peek(len(pcapngMagic))
+	if err != nil {
+		return fmt.Errorf("not a packet capture: %w", err)
+	}
+
+	var reader packetReader
+	if bytes.Equal(magic, pcapngMagic) {
+		reader, err = pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+	} else {
+		reader, err = pcapgo.NewReader(buffered)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		packet := gopacket.NewPacket(data, reader.LinkType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+		var src, dst net.IP
+		switch network := packet.NetworkLayer().(type) {
+		case *layers.IPv4:
+			src, dst = network.SrcIP, network.DstIP
+		case *layers.IPv6:
+			src, dst = network.SrcIP, network.DstIP
+		default:
+			continue
+		}
+
+		if direction != pcapDst {
+			addObserved(seen, src)
+		}
+		if direction != pcapSrc {
+			addObserved(seen, dst)
+		}
+	}
+}
+
+// addObserved adds an address read from a packet to seen.
+func addObserved(seen map[netip.Addr]struct{}, ip net.IP) {
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		seen[addr.Unmap()] = struct{}{}
+	}
+}
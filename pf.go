@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// pfFormat writes the prefixes as a pf table file, one per line, preceded by
+// comments giving the pfctl command loading it into the table and the pf.conf
+// line declaring it. pf tables hold both address families.
+type pfFormat struct {
+	table string
+}
+
+// newPFFormat creates a pfFormat for the table named in opts.
+func newPFFormat(opts formatOptions) (*pfFormat, error) {
+	if opts.table == "" {
+		return nil, fmt.Errorf("missing table name for --output pf")
+	}
+
+	return &pfFormat{table: opts.table}, nil
+}
+
+func (f *pfFormat) writePrefixes(w io.Writer, prefixes []netip.Prefix) error {
+	_, err := fmt.Fprintf(w, "# Load with: pfctl -t %[1]s -T replace -f FILE\n"+
+		"# Declare in pf.conf with: table <%[1]s> persist file \"FILE\"\n", f.table)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		if err := printSetElement(w, "", prefix, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ICMP protocol numbers, as expected by icmp.ParseMessage.
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// pinger sends ICMP echo requests. It uses raw sockets when permitted, and
+// otherwise falls back to unprivileged ICMP datagram sockets, which Linux
+// allows for the groups in net.ipv4.ping_group_range.
+type pinger struct {
+	privileged bool
+	id         int
+	seq        atomic.Uint32
+}
+
+// pingPayload is the data sent in the echo requests.
+var pingPayload = []byte("cidrex")
+
+// newPinger checks which kind of ICMP socket can be opened.
+func newPinger() (*pinger, error) {
+	p := &pinger{id: rand.Intn(0xffff)}
+
+	if conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err == nil {
+		conn.Close()
+		p.privileged = true
+		return p, nil
+	}
+
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ICMP socket, run as root or allow unprivileged ping: %w", err)
+	}
+	conn.Close()
+
+	return p, nil
+}
+
+// ping reports whether addr answers an echo request within timeout.
+func (p *pinger) ping(addr netip.Addr, timeout time.Duration) bool {
+	network, listen, proto := "udp4", "0.0.0.0", protocolICMP
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if addr.Is6() {
+		network, listen, proto = "udp6", "::", protocolICMPv6
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	if p.privileged {
+		network = map[string]string{"udp4": "ip4:icmp", "udp6": "ip6:ipv6-icmp"}[network]
+	}
+
+	conn, err := icmp.ListenPacket(network, listen)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	// The kernel replaces the ID of unprivileged sockets by their port
+	seq := int(p.seq.Add(1) & 0xffff)
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: pingPayload},
+	}
+
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: addr.AsSlice(), Zone: addr.Zone()}
+	if p.privileged {
+		dst = &net.IPAddr{IP: addr.AsSlice(), Zone: addr.Zone()}
+	}
+
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return false
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return false
+	}
+
+	// Raw sockets receive every ICMP packet, so keep reading until ours
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+
+		if !samePeer(peer, addr) {
+			continue
+		}
+
+		reply, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+
+		echo, ok := reply.Body.(*icmp.Echo)
+		if ok && echo.Seq == seq && (!p.privileged || echo.ID == p.id) && bytes.Equal(echo.Data, pingPayload) {
+			return true
+		}
+	}
+}
+
+// samePeer reports whether the sender of a packet is addr.
+func samePeer(peer net.Addr, addr netip.Addr) bool {
+	var ip net.IP
+	switch peer := peer.(type) {
+	case *net.IPAddr:
+		ip = peer.IP
+	case *net.UDPAddr:
+		ip = peer.IP
+	default:
+		return false
+	}
+
+	from, ok := netip.AddrFromSlice(ip)
+	return ok && from.Unmap() == addr.WithZone("").Unmap()
+}
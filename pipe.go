@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// defaultPipeEvery is the number of records fed to each run of the --pipe
+// command by default.
+const defaultPipeEvery = 10000
+
+// pipeFormatter formats records into chunks and runs a shell command for each
+// chunk with the chunk on its stdin, running up to jobs commands at once. The
+// commands inherit stdout and stderr.
+type pipeFormatter struct {
+	inner   formatter
+	command string
+	every   int
+
+	buf   *bytes.Buffer
+	count int
+	index int
+	pool  *jobPool
+}
+
+// newPipeFormatter creates a pipeFormatter feeding chunks of every records,
+// formatted by inner, to command.
+func newPipeFormatter(inner formatter, command string, every, jobs int) (*pipeFormatter, error) {
+	if every < 1 {
+		return nil, fmt.Errorf("invalid chunk size: %d", every)
+	}
+
+	// Formats that are written at the end cannot be split into chunks
+	if _, ok := inner.(footerWriter); ok {
+		return nil, fmt.Errorf("output format cannot be used with --pipe")
+	}
+
+	pool, err := newJobPool(jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pipeFormatter{
+		inner:   inner,
+		command: command,
+		every:   every,
+		pool:    pool,
+	}, nil
+}
+
+func (f *pipeFormatter) write(_ io.Writer, rec record) error {
+	// Every chunk is a complete document, with its own header
+	if f.buf == nil {
+		f.buf = &bytes.Buffer{}
+		if header, ok := f.inner.(headerWriter); ok {
+			if err := header.writeHeader(f.buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.inner.write(f.buf, rec); err != nil {
+		return err
+	}
+
+	f.count++
+	if f.count >= f.every {
+		f.spawn()
+	}
+
+	return nil
+}
+
+// spawn runs the command on the current chunk in the background, after
+// waiting for a free job slot.
+func (f *pipeFormatter) spawn() {
+	chunk, index := f.buf, f.index
+	f.buf, f.count = nil, 0
+	f.index++
+
+	f.pool.start(fmt.Sprintf("chunk %d", index), func() error {
+		return f.run(chunk, index)
+	})
+}
+
+// run runs the command once with chunk as its stdin. The chunk number is
+// available to the command in the CIDREX_CHUNK environment variable.
+func (f *pipeFormatter) run(chunk *bytes.Buffer, index int) error {
+	cmd := shellCommand(context.Background(), f.command)
+	cmd.Stdin = chunk
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "CIDREX_CHUNK="+strconv.Itoa(index))
+
+	return cmd.Run()
+}
+
+// writeFooter runs the command on the last, partial chunk and waits for all
+// commands to finish.
+func (f *pipeFormatter) writeFooter(_ io.Writer) error {
+	if f.buf != nil {
+		f.spawn()
+	}
+
+	if total, failed := f.pool.wait(); failed > 0 {
+		return fmt.Errorf("command failed for %d of %d chunks", failed, total)
+	}
+
+	return nil
+}
+
+// shellCommand returns a command running s with the system shell, killed
+// when ctx is done.
+func shellCommand(ctx context.Context, s string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", s)
+	}
+
+	// Do not wait forever for children of the shell holding its output open
+	cmd.WaitDelay = time.Second
+
+	return cmd
+}
@@ -0,0 +1,39 @@
+package cidrex
+
+import (
+	"math/big"
+	"net/netip"
+)
+
+// NextPrefix returns the prefix of the same length immediately following
+// prefix. ErrOutOfRange is returned at the end of the address family.
+func NextPrefix(prefix netip.Prefix) (netip.Prefix, error) {
+	return adjacentPrefix(prefix, 1)
+}
+
+// PrevPrefix returns the prefix of the same length immediately preceding
+// prefix. ErrOutOfRange is returned at the start of the address family.
+func PrevPrefix(prefix netip.Prefix) (netip.Prefix, error) {
+	return adjacentPrefix(prefix, -1)
+}
+
+// adjacentPrefix returns the prefix of the same length that is count blocks
+// away from prefix.
+func adjacentPrefix(prefix netip.Prefix, count int64) (netip.Prefix, error) {
+	prefix = prefix.Masked()
+
+	n := PrefixSize(prefix)
+	n.Mul(n, big.NewInt(count))
+
+	addr, err := Shift(prefix.Addr(), n)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return netip.PrefixFrom(addr, prefix.Bits()), nil
+}
+
+// PrefixSize returns the number of addresses in a prefix.
+func PrefixSize(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
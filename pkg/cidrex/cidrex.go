@@ -0,0 +1,3 @@
+// Package cidrex provides the IP address and CIDR range arithmetic used by the
+// cidrex command-line utility, for use by other Go programs.
+package cidrex
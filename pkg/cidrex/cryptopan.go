@@ -0,0 +1,78 @@
+package cidrex
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"net/netip"
+)
+
+// CryptoPAnKeySize is the size of a Crypto-PAn key in bytes.
+const CryptoPAnKeySize = 32
+
+// CryptoPAn pseudonymizes IP addresses with Crypto-PAn, the prefix-preserving
+// scheme of Xu, Fan, Ammar and Moon: two addresses sharing a k-bit prefix are
+// mapped to two addresses sharing a k-bit prefix, so that the subnet structure
+// of a dataset survives while the addresses themselves are hidden. The same
+// key always yields the same mapping.
+type CryptoPAn struct {
+	block cipher.Block
+	pad   [16]byte
+}
+
+// NewCryptoPAn creates a CryptoPAn from a key of CryptoPAnKeySize bytes. The
+// first half of the key is the AES key, and the second half is encrypted to
+// produce the padding.
+func NewCryptoPAn(key []byte) (*CryptoPAn, error) {
+	if len(key) != CryptoPAnKeySize {
+		return nil, fmt.Errorf("invalid Crypto-PAn key size: %d bytes instead of %d", len(key), CryptoPAnKeySize)
+	}
+
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CryptoPAn{block: block}
+	block.Encrypt(c.pad[:], key[16:])
+
+	return c, nil
+}
+
+// Anonymize returns the pseudonym of addr. IPv4 and IPv6 addresses map to
+// addresses of the same family. IPv4-mapped IPv6 addresses are treated as IPv4,
+// and zones are removed.
+func (c *CryptoPAn) Anonymize(addr netip.Addr) netip.Addr {
+	addr = addr.Unmap().WithZone("")
+
+	// IPv4 addresses occupy the first bytes of the block
+	var orig [16]byte
+	if addr.Is4() {
+		a4 := addr.As4()
+		copy(orig[:], a4[:])
+	} else {
+		orig = addr.As16()
+	}
+
+	// Bit i of the result is the first bit of the encryption of the first i
+	// bits of the address followed by the padding
+	var in, out [16]byte
+	result := orig
+	for i := 0; i < addr.BitLen(); i++ {
+		full, rem := i/8, i%8
+		mask := byte(0xff << (8 - rem))
+
+		copy(in[:full], orig[:full])
+		in[full] = orig[full]&mask | c.pad[full]&^mask
+		copy(in[full+1:], c.pad[full+1:])
+
+		c.block.Encrypt(out[:], in[:])
+		result[full] ^= (out[0] >> 7) << (7 - rem)
+	}
+
+	if addr.Is4() {
+		return netip.AddrFrom4([4]byte(result[:4]))
+	}
+
+	return netip.AddrFrom16(result)
+}
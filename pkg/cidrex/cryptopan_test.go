@@ -0,0 +1,52 @@
+package cidrex
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// cryptoPAnKey is the key of the sample implementation published by the
+// authors of Crypto-PAn, along with the vectors below.
+var cryptoPAnKey = []byte{
+	21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2,
+}
+
+func TestCryptoPAnReferenceVectors(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"128.11.68.132", "135.242.180.132"},
+		{"129.118.74.4", "134.136.186.123"},
+		{"130.132.252.244", "133.68.164.234"},
+		{"141.223.7.43", "141.167.8.160"},
+		{"141.233.145.108", "141.129.237.235"},
+		{"152.163.225.39", "151.140.114.167"},
+		{"156.29.3.236", "147.225.12.42"},
+		{"165.247.96.84", "162.9.99.234"},
+		{"166.107.77.190", "160.132.178.185"},
+		{"192.102.249.13", "252.138.62.131"},
+		{"192.215.32.125", "252.43.47.189"},
+		{"192.233.80.103", "252.25.108.8"},
+		{"192.41.57.43", "252.222.221.184"},
+		{"193.150.244.223", "253.169.52.216"},
+		{"195.205.63.100", "255.186.223.5"},
+		{"198.200.171.101", "249.199.68.213"},
+		{"199.217.79.101", "248.38.184.213"},
+		{"202.49.198.20", "245.206.7.234"},
+		{"203.12.160.252", "244.248.163.4"},
+		{"204.184.162.189", "243.192.77.90"},
+	}
+
+	c, err := NewCryptoPAn(cryptoPAnKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		if got := c.Anonymize(netip.MustParseAddr(tt.addr)); got != netip.MustParseAddr(tt.want) {
+			t.Errorf("Anonymize(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package cidrex
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math/bits"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Errors identifying what was wrong with an input, wrapped in a *ParseError.
+var (
+	ErrInvalidAddress    = errors.New("invalid IP address")
+	ErrInvalidPrefix     = errors.New("invalid CIDR prefix")
+	ErrInvalidMask       = errors.New("invalid mask")
+	ErrNonContiguousMask = errors.New("non-contiguous netmask")
+	ErrInvalidRange      = errors.New("invalid address range")
+	ErrInvalidZone       = errors.New("invalid zone")
+	ErrHostBitsSet       = errors.New("host bits set")
+	ErrNonCanonical      = errors.New("non-canonical IPv6 address")
+)
+
+// ParseError is returned by ParseTarget. Use errors.Is with the Err variables
+// of this package to find out what was wrong.
+type ParseError struct {
+	// Input is the string that could not be parsed
+	Input string
+
+	// Err is one of the Err variables of this package, possibly wrapped with
+	// more details
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parsing " + strconv.Quote(e.Input) + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Target is the set of addresses described by a single input entry.
+type Target struct {
+	// Prefixes are the prefixes covering the addresses of the target, with
+	// their host bits cleared, in ascending order
+	Prefixes []netip.Prefix
+
+	// Zone is the IPv6 zone of the target, if any
+	Zone string
+}
+
+// ParseTarget parses an entry in any of the syntaxes accepted by cidrex:
+//
+//   - a single IP address, such as 192.0.2.1 or 2001:db8::1
+//   - a CIDR prefix, such as 192.0.2.0/24 or 2001:db8::/64
+//   - an IPv4 address with a dotted-decimal netmask, such as
+//     192.0.2.0/255.255.255.0
+//   - an IPv4 address with a Cisco-style wildcard mask, such as
+//     10.1.0.0/0.0.255.255, which may be non-contiguous as in 10.0.0.1/0.0.255.0
+//   - an inclusive range of addresses of the same family, such as
+//     192.0.2.10-192.0.2.20
+//
+// Single IPv6 addresses and prefixes may carry a zone, as in fe80::1%eth0 or
+// fe80::%eth0/64. A mask whose first bit is set is a netmask and must be
+// contiguous; any other mask is a wildcard mask, so 0.0.0.0 matches a single
+// address.
+func ParseTarget(s string) (Target, error) {
+	return ParseOptions{}.ParseTarget(s)
+}
+
+// ParseOptions changes how entries are parsed. The zero value parses entries
+// like the ParseTarget function.
+type ParseOptions struct {
+	// LenientIPv4 accepts IPv4 addresses in any of the forms accepted by
+	// inet_aton: one to four parts separated by dots, each in decimal, in
+	// hexadecimal with a 0x prefix, or in octal with a leading 0. The last
+	// part fills the remaining bytes, so 3232235777, 0xC0A80101 and
+	// 192.168.257 all stand for 192.168.1.1, and 10.1 for 10.0.0.1.
+	LenientIPv4 bool
+
+	// Pedantic rejects entries that are valid but may not mean what their
+	// author intended: IPv6 addresses not written in the canonical form of
+	// RFC 5952, prefixes and masks with host bits set, and zones. It takes
+	// precedence over LenientIPv4.
+	Pedantic bool
+}
+
+// ParseTarget parses an entry like the ParseTarget function, with the options
+// set in o.
+func (o ParseOptions) ParseTarget(s string) (Target, error) {
+	t, err := o.parseTarget(s)
+	if err != nil {
+		return Target{}, &ParseError{Input: s, Err: err}
+	}
+
+	return t, nil
+}
+
+// parseTarget implements ParseTarget, returning unwrapped errors.
+func (o ParseOptions) parseTarget(s string) (Target, error) {
+	// Dashes are common in zone names, as in fe80::1%br-lan, and only
+	// separate a range before the zone
+	head, _, _ := strings.Cut(s, "%")
+	if i := strings.IndexByte(head, '-'); i >= 0 {
+		prefixes, err := o.parseRange(s[:i], s[i+1:])
+		return Target{Prefixes: prefixes}, err
+	}
+
+	entry, zone, err := cutZone(s)
+	if err != nil {
+		return Target{}, err
+	}
+
+	prefixes, err := o.parsePrefixes(entry)
+	if err != nil {
+		return Target{}, err
+	}
+
+	if zone != "" && !prefixes[0].Addr().Is6() {
+		return Target{}, fmt.Errorf("%w: zone %s on non-IPv6 address", ErrInvalidZone, zone)
+	}
+
+	if zone != "" && o.Pedantic {
+		return Target{}, fmt.Errorf("%w: zone %s not allowed in pedantic mode", ErrInvalidZone, zone)
+	}
+
+	return Target{Prefixes: prefixes, Zone: zone}, nil
+}
+
+// Addresses returns an iterator over the addresses of the target, in ascending
+// order, with the zone of the target.
+func (t Target) Addresses() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, prefix := range t.Prefixes {
+			last := LastAddr(prefix)
+
+			for addr := prefix.Addr(); ; addr = addr.Next() {
+				if !yield(addr.WithZone(t.Zone)) {
+					return
+				}
+
+				if addr == last {
+					break
+				}
+			}
+		}
+	}
+}
+
+// parseRange parses an inclusive range of addresses into the minimal list of
+// prefixes covering it.
+func (o ParseOptions) parseRange(firstPart, lastPart string) ([]netip.Prefix, error) {
+	first, err := o.parseAddr(firstPart)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := o.parseAddr(lastPart)
+	if err != nil {
+		return nil, err
+	}
+
+	if first.Is4() != last.Is4() {
+		return nil, fmt.Errorf("%w: mixed address families", ErrInvalidRange)
+	}
+
+	if last.Less(first) {
+		return nil, fmt.Errorf("%w: %s is before %s", ErrInvalidRange, last, first)
+	}
+
+	return RangePrefixes(first, last), nil
+}
+
+// cutZone removes the zone identifier from an entry and returns it separately.
+func cutZone(entry string) (string, string, error) {
+	addrPart, rest, found := strings.Cut(entry, "%")
+	if !found {
+		return entry, "", nil
+	}
+
+	zone, maskPart, hasMask := strings.Cut(rest, "/")
+	if zone == "" {
+		return "", "", fmt.Errorf("%w: empty zone", ErrInvalidZone)
+	}
+
+	if hasMask {
+		return addrPart + "/" + maskPart, zone, nil
+	}
+
+	return addrPart, zone, nil
+}
+
+// parsePrefixes parses an entry without zone or range into the prefixes it
+// contains.
+func (o ParseOptions) parsePrefixes(entry string) ([]netip.Prefix, error) {
+	addrPart, maskPart, hasMask := strings.Cut(entry, "/")
+
+	// A single IP address
+	if !hasMask {
+		addr, err := o.parseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		return []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, nil
+	}
+
+	addr, err := o.parseAddr(addrPart)
+	if err != nil {
+		return nil, err
+	}
+
+	// An IPv4 address with a dotted-decimal netmask or wildcard mask
+	if strings.Contains(maskPart, ".") {
+		if !addr.Is4() {
+			return nil, fmt.Errorf("%w: mask %s applied to non-IPv4 address", ErrInvalidMask, maskPart)
+		}
+
+		wildcard, err := ParseMask(maskPart)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes := wildcardPrefixes(addr, wildcard)
+		if o.Pedantic && len(prefixes) == 1 && prefixes[0].Addr() != addr {
+			return nil, fmt.Errorf("%w: network is %s/%s", ErrHostBitsSet, prefixes[0].Addr(), maskPart)
+		}
+
+		return prefixes, nil
+	}
+
+	// A CIDR prefix
+	prefixLen, err := parsePrefixLen(maskPart, addr.BitLen())
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := netip.PrefixFrom(addr, prefixLen).Masked()
+	if o.Pedantic && prefix.Addr() != addr {
+		return nil, fmt.Errorf("%w: network is %s", ErrHostBitsSet, prefix)
+	}
+
+	return []netip.Prefix{prefix}, nil
+}
+
+// parsePrefixLen parses the length of a CIDR prefix of an address of bitLen
+// bits. Like netip.ParsePrefix, it rejects signs and leading zeros.
+func parsePrefixLen(s string, bitLen int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > bitLen || s != strconv.Itoa(n) {
+		return 0, fmt.Errorf("%w: bad prefix length %q", ErrInvalidPrefix, s)
+	}
+
+	return n, nil
+}
+
+// parseAddr parses a single IP address. Zoned IPv6 addresses are rejected.
+func (o ParseOptions) parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil && o.LenientIPv4 && !o.Pedantic {
+		if addr, ok := parseLenientIPv4(s); ok {
+			return addr, nil
+		}
+	}
+
+	if err != nil && hasLeadingZero(s) {
+		return netip.Addr{}, fmt.Errorf("%w: IPv4 octet with a leading zero, which may be read as octal", ErrInvalidAddress)
+	}
+
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, ErrInvalidAddress
+	}
+
+	if o.Pedantic && addr.Is6() && s != addr.String() {
+		return netip.Addr{}, fmt.Errorf("%w: should be written %s", ErrNonCanonical, addr)
+	}
+
+	return addr, nil
+}
+
+// hasLeadingZero reports whether s is a dotted-decimal IPv4 address in which
+// some octet has a leading zero, such as 010.0.0.1.
+func hasLeadingZero(s string) bool {
+	octets := strings.Split(s, ".")
+	if len(octets) != 4 {
+		return false
+	}
+
+	found := false
+	for _, octet := range octets {
+		if octet == "" || strings.Trim(octet, "0123456789") != "" {
+			return false
+		}
+
+		if len(octet) > 1 && octet[0] == '0' {
+			found = true
+		}
+	}
+
+	return found
+}
+
+// parseLenientIPv4 parses an IPv4 address in any of the forms accepted by
+// inet_aton.
+func parseLenientIPv4(s string) (netip.Addr, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	// Every part is a byte, except the last one which fills the rest
+	var n uint64
+	last := len(parts) - 1
+	for i, part := range parts[:last] {
+		v, ok := parseInetPart(part, 0xff)
+		if !ok {
+			return netip.Addr{}, false
+		}
+
+		n |= v << (24 - 8*i)
+	}
+
+	v, ok := parseInetPart(parts[last], 1<<(32-8*last)-1)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	n |= v
+
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), true
+}
+
+// parseInetPart parses a part of an IPv4 address as inet_aton does, in
+// hexadecimal with a 0x prefix, in octal with a leading 0, or in decimal, and
+// checks that it is at most limit.
+func parseInetPart(s string, limit uint64) (uint64, bool) {
+	base := 10
+	switch {
+	case len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		s, base = s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+
+	// ParseUint rejects signs, and underscores unless the base is 0
+	v, err := strconv.ParseUint(s, base, 32)
+	if err != nil || v > limit {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// topBit is the most significant bit of an IPv4 address.
+const topBit = 1 << 31
+
+// ipv4Bits returns an IPv4 address as a 32-bit number.
+func ipv4Bits(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// maxFreeBits is the number of one bits a wildcard mask can have before its
+// trailing run of ones, each of which doubles the number of prefixes matched.
+const maxFreeBits = 16
+
+// ParseMask parses a dotted-decimal IPv4 netmask such as 255.255.0.0, or a
+// wildcard mask such as 0.0.255.255, and returns it in wildcard form, where
+// one bits mark the host part of the address. Netmasks must be contiguous,
+// and wildcard masks can match at most 2^16 prefixes.
+func ParseMask(s string) (uint32, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return 0, fmt.Errorf("%w %s", ErrInvalidMask, s)
+	}
+
+	m := ipv4Bits(addr)
+	if m&topBit == 0 {
+		free := m &^ (1<<bits.TrailingZeros32(^m) - 1)
+		if bits.OnesCount32(free) > maxFreeBits {
+			return 0, fmt.Errorf("%w %s: matches more than %d prefixes", ErrInvalidMask, s, 1<<maxFreeBits)
+		}
+		return m, nil
+	}
+
+	// The inverted mask of a contiguous netmask is of the form 0...01...1, so
+	// adding one to it yields a power of two
+	wildcard := ^m
+	if wildcard&(wildcard+1) != 0 {
+		return 0, fmt.Errorf("%w %s", ErrNonContiguousMask, s)
+	}
+
+	return wildcard, nil
+}
+
+// wildcardPrefixes returns the prefixes matched by addr under the given
+// wildcard mask, in ascending order. A contiguous mask yields a single prefix;
+// every one bit before the trailing run of ones doubles the number of prefixes.
+func wildcardPrefixes(addr netip.Addr, wildcard uint32) []netip.Prefix {
+	base := ipv4Bits(addr) &^ wildcard
+
+	// The trailing run of ones becomes the host part of each prefix
+	hostBits := bits.TrailingZeros32(^wildcard)
+	if hostBits == 32 {
+		return []netip.Prefix{netip.PrefixFrom(netip.IPv4Unspecified(), 0)}
+	}
+
+	// The remaining ones are enumerated. (sub - free) & free walks through every
+	// subset of free in ascending order and wraps back to zero at the end.
+	free := wildcard &^ (1<<hostBits - 1)
+	prefixes := make([]netip.Prefix, 0, 1<<bits.OnesCount32(free))
+
+	for sub := uint32(0); ; {
+		n := base | sub
+		a := netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		prefixes = append(prefixes, netip.PrefixFrom(a, 32-hostBits))
+
+		sub = (sub - free) & free
+		if sub == 0 {
+			break
+		}
+	}
+
+	return prefixes
+}
@@ -0,0 +1,205 @@
+package cidrex
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		zone string
+		err  error
+	}{
+		// Addresses and prefixes
+		{in: "192.0.2.1", want: "[192.0.2.1/32]"},
+		{in: "192.0.2.1/24", want: "[192.0.2.0/24]"},
+		{in: "2001:db8::1", want: "[2001:db8::1/128]"},
+		{in: "2001:db8::/32", want: "[2001:db8::/32]"},
+		{in: "192.0.2.0/33", err: ErrInvalidPrefix},
+		{in: "192.0.2.0/024", err: ErrInvalidPrefix},
+		{in: "192.0.2.0/+24", err: ErrInvalidPrefix},
+		{in: "192.0.2", err: ErrInvalidAddress},
+		{in: "010.0.0.1", err: ErrInvalidAddress},
+
+		// Zones
+		{in: "fe80::1%eth0", want: "[fe80::1/128]", zone: "eth0"},
+		{in: "fe80::%eth0/64", want: "[fe80::/64]", zone: "eth0"},
+		{in: "fe80::1%br-lan", want: "[fe80::1/128]", zone: "br-lan"},
+		{in: "fe80::1%wg-0/64", want: "[fe80::/64]", zone: "wg-0"},
+		{in: "fe80::1%", err: ErrInvalidZone},
+		{in: "192.0.2.1%eth0", err: ErrInvalidZone},
+		{in: "fe80::1%eth0-fe80::2", want: "[fe80::1/128]", zone: "eth0-fe80::2"},
+
+		// Netmasks and wildcard masks
+		{in: "192.0.2.7/255.255.255.0", want: "[192.0.2.0/24]"},
+		{in: "10.1.2.3/0.0.255.255", want: "[10.1.0.0/16]"},
+		{in: "10.0.0.1/0.0.0.0", want: "[10.0.0.1/32]"},
+		{in: "10.0.0.1/0.0.1.0", want: "[10.0.0.1/32 10.0.1.1/32]"},
+		{in: "10.0.0.0/0.0.0.6", want: "[10.0.0.0/32 10.0.0.2/32 10.0.0.4/32 10.0.0.6/32]"},
+		{in: "192.0.2.0/255.0.255.0", err: ErrNonContiguousMask},
+		{in: "192.0.2.0/255.255.255", err: ErrInvalidMask},
+		{in: "0.0.0.0/127.255.255.254", err: ErrInvalidMask},
+		{in: "2001:db8::/255.255.0.0", err: ErrInvalidMask},
+
+		// Ranges
+		{in: "192.0.2.10-192.0.2.20", want: "[192.0.2.10/31 192.0.2.12/30 192.0.2.16/30 192.0.2.20/32]"},
+		{in: "192.0.2.0-192.0.2.255", want: "[192.0.2.0/24]"},
+		{in: "2001:db8::-2001:db8::3", want: "[2001:db8::/126]"},
+		{in: "192.0.2.20-192.0.2.10", err: ErrInvalidRange},
+		{in: "192.0.2.1-2001:db8::1", err: ErrInvalidRange},
+		{in: "192.0.2.1-", err: ErrInvalidAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTarget(tt.in)
+			checkTarget(t, got, err, tt.want, tt.zone, tt.err)
+		})
+	}
+}
+
+func TestParseOptionsLenientIPv4(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "3232235777", want: "[192.168.1.1/32]"},
+		{in: "0xC0A80101", want: "[192.168.1.1/32]"},
+		{in: "0300.0250.01.01", want: "[192.168.1.1/32]"},
+		{in: "192.168.257", want: "[192.168.1.1/32]"},
+		{in: "10.1", want: "[10.0.0.1/32]"},
+		{in: "10.1/8", want: "[10.0.0.0/8]"},
+		{in: "10.1-10.3", want: "[10.0.0.1/32 10.0.0.2/31]"},
+		{in: "4294967296", err: ErrInvalidAddress},
+		{in: "192.168.256.1", err: ErrInvalidAddress},
+		{in: "08.0.0.1", err: ErrInvalidAddress},
+		{in: "1.2.3.4.5", err: ErrInvalidAddress},
+	}
+
+	o := ParseOptions{LenientIPv4: true}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := o.ParseTarget(tt.in)
+			checkTarget(t, got, err, tt.want, "", tt.err)
+		})
+	}
+}
+
+func TestParseOptionsPedantic(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "192.0.2.0/24", want: "[192.0.2.0/24]"},
+		{in: "2001:db8::1", want: "[2001:db8::1/128]"},
+		{in: "192.0.2.0/255.255.255.0", want: "[192.0.2.0/24]"},
+		{in: "192.0.2.1/24", err: ErrHostBitsSet},
+		{in: "192.0.2.1/255.255.255.0", err: ErrHostBitsSet},
+		{in: "2001:DB8::1", err: ErrNonCanonical},
+		{in: "2001:db8:0:0::1", err: ErrNonCanonical},
+		{in: "2001:db8::1-2001:db8:0::2", err: ErrNonCanonical},
+		{in: "fe80::1%eth0", err: ErrInvalidZone},
+		{in: "3232235777", err: ErrInvalidAddress},
+	}
+
+	// Pedantic takes precedence over LenientIPv4
+	o := ParseOptions{LenientIPv4: true, Pedantic: true}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := o.ParseTarget(tt.in)
+			checkTarget(t, got, err, tt.want, "", tt.err)
+		})
+	}
+}
+
+func TestParseMask(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+		err  error
+	}{
+		{in: "255.255.255.0", want: 0x000000ff},
+		{in: "255.255.255.255", want: 0},
+		{in: "128.0.0.0", want: 0x7fffffff},
+		{in: "0.0.0.255", want: 0x000000ff},
+		{in: "0.0.255.0", want: 0x0000ff00},
+		{in: "0.0.255.255", want: 0x0000ffff},
+		{in: "0.1.255.255", want: 0x0001ffff},
+		{in: "0.255.255.254", err: ErrInvalidMask},
+		{in: "255.0.255.0", err: ErrNonContiguousMask},
+		{in: "255.255.255", err: ErrInvalidMask},
+		{in: "::", err: ErrInvalidMask},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMask(tt.in)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ParseMask(%s) error = %v, want %v", tt.in, err, tt.err)
+				}
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Fatalf("ParseMask(%s) = %#08x, %v, want %#08x", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorWrapsInput(t *testing.T) {
+	_, err := ParseTarget("192.0.2.0/33")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Input != "192.0.2.0/33" {
+		t.Fatalf("ParseTarget error = %#v, want a *ParseError for the input", err)
+	}
+}
+
+// checkTarget compares the result of a ParseTarget call against the expected
+// prefixes and zone, or the expected error.
+func checkTarget(t *testing.T, got Target, err error, want, zone string, wantErr error) {
+	t.Helper()
+
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("error = %v, want %v", err, wantErr)
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s := fmt.Sprint(got.Prefixes); s != want {
+		t.Errorf("prefixes = %s, want %s", s, want)
+	}
+
+	if got.Zone != zone {
+		t.Errorf("zone = %q, want %q", got.Zone, zone)
+	}
+}
+
+func TestTargetAddresses(t *testing.T) {
+	target, err := ParseTarget("fe80::%eth0/127")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []netip.Addr
+	for addr := range target.Addresses() {
+		got = append(got, addr)
+	}
+
+	if s := fmt.Sprint(got); s != "[fe80::%eth0 fe80::1%eth0]" {
+		t.Errorf("Addresses() = %s", s)
+	}
+}
@@ -0,0 +1,56 @@
+package cidrex
+
+import "net/netip"
+
+// LastAddr returns the last address of a prefix.
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr()
+	bits := prefix.Bits()
+
+	if addr.Is4() {
+		b := addr.As4()
+		for i := bits; i < 32; i++ {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+		return netip.AddrFrom4(b)
+	}
+
+	b := addr.As16()
+	for i := bits; i < 128; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	return netip.AddrFrom16(b)
+}
+
+// RangePrefixes returns the minimal list of prefixes that exactly covers the
+// addresses from first to last inclusive, in ascending order. first and last
+// must belong to the same address family, and first must not be greater than
+// last. Zones are ignored.
+func RangePrefixes(first, last netip.Addr) []netip.Prefix {
+	first, last = first.WithZone(""), last.WithZone("")
+
+	var prefixes []netip.Prefix
+
+	for {
+		// Find the largest prefix starting at first that does not extend
+		// past last
+		bits := first.BitLen()
+		for bits > 0 {
+			candidate := netip.PrefixFrom(first, bits-1)
+			if candidate.Masked().Addr() != first || LastAddr(candidate).Compare(last) > 0 {
+				break
+			}
+			bits--
+		}
+
+		prefix := netip.PrefixFrom(first, bits)
+		prefixes = append(prefixes, prefix)
+
+		end := LastAddr(prefix)
+		if end == last {
+			return prefixes
+		}
+
+		first = end.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package cidrex
+
+import (
+	"errors"
+	"iter"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrUnalignedPrefix is returned when a prefix does not end on the boundary of
+// a reverse DNS zone: an octet for IPv4, or a nibble for IPv6.
+var ErrUnalignedPrefix = errors.New("prefix not on a reverse zone boundary")
+
+// ReverseZoneBits returns the number of bits between reverse DNS zone
+// boundaries in the family of addr: 8 for IPv4, and 4 for IPv6.
+func ReverseZoneBits(addr netip.Addr) int {
+	if addr.Is4() {
+		return 8
+	}
+	return 4
+}
+
+// ReverseName returns the fully qualified name under in-addr.arpa or ip6.arpa
+// of the PTR record of addr, such as "1.113.0.203.in-addr.arpa.". IPv4-mapped
+// IPv6 addresses are named as IPv6 addresses. The zone, if any, is ignored.
+func ReverseName(addr netip.Addr) string {
+	name, _ := ReverseZone(netip.PrefixFrom(addr.WithZone(""), addr.BitLen()))
+	return name
+}
+
+// ReverseZone returns the fully qualified name of the reverse DNS zone holding
+// exactly the addresses of prefix, such as "113.0.203.in-addr.arpa." for
+// 203.0.113.0/24 or "8.b.d.0.1.0.0.2.ip6.arpa." for 2001:db8::/32.
+// ErrUnalignedPrefix is returned if the length of prefix is not a multiple of
+// ReverseZoneBits.
+func ReverseZone(prefix netip.Prefix) (string, error) {
+	addr := prefix.Masked().Addr()
+	step := ReverseZoneBits(addr)
+
+	if prefix.Bits()%step != 0 {
+		return "", ErrUnalignedPrefix
+	}
+
+	var b strings.Builder
+
+	if addr.Is4() {
+		octets := addr.As4()
+		for i := prefix.Bits()/8 - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(octets[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String(), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+
+	bytes := addr.As16()
+	for i := prefix.Bits()/4 - 1; i >= 0; i-- {
+		nibble := bytes[i/2] >> 4
+		if i%2 == 1 {
+			nibble = bytes[i/2] & 0x0f
+		}
+
+		b.WriteByte(hexDigits[nibble])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
+
+// Subnets returns an iterator over the prefixes of length bits that make up
+// prefix, in ascending order. It yields nothing if bits is shorter than the
+// length of prefix or longer than its address family.
+func Subnets(prefix netip.Prefix, bits int) iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		prefix = prefix.Masked()
+		if bits < prefix.Bits() || bits > prefix.Addr().BitLen() {
+			return
+		}
+
+		last := LastAddr(prefix)
+
+		for addr := prefix.Addr(); ; {
+			subnet := netip.PrefixFrom(addr, bits)
+			if !yield(subnet) {
+				return
+			}
+
+			end := LastAddr(subnet)
+			if end == last {
+				return
+			}
+			addr = end.Next()
+		}
+	}
+}
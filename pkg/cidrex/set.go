@@ -0,0 +1,185 @@
+package cidrex
+
+import (
+	"iter"
+	"math/bits"
+	"net/netip"
+)
+
+// Set is a set of CIDR prefixes stored in a path-compressed binary trie, with
+// one trie per address family. It answers membership and longest-prefix-match
+// queries in time proportional to the address length, regardless of the
+// number of prefixes. Zones are ignored. The zero value is an empty set ready
+// to use. A Set is not safe for concurrent use while it is being modified.
+type Set struct {
+	root4 *setNode
+	root6 *setNode
+	count int
+}
+
+// setNode is a node of the trie. Nodes that were not added themselves only
+// exist to branch between their two children.
+type setNode struct {
+	prefix netip.Prefix
+	added  bool
+	child  [2]*setNode
+}
+
+// Add adds a prefix to the set. Host bits are ignored, so 10.0.0.1/8 adds
+// 10.0.0.0/8. Adding an invalid prefix has no effect.
+func (s *Set) Add(prefix netip.Prefix) {
+	if !prefix.IsValid() {
+		return
+	}
+
+	prefix = netip.PrefixFrom(prefix.Addr().WithZone(""), prefix.Bits()).Masked()
+	if s.insert(s.root(prefix.Addr()), prefix) {
+		s.count++
+	}
+}
+
+// Len returns the number of distinct prefixes added to the set.
+func (s *Set) Len() int {
+	return s.count
+}
+
+// Contains reports whether addr is covered by any prefix of the set.
+func (s *Set) Contains(addr netip.Addr) bool {
+	_, ok := s.ContainingPrefix(addr)
+	return ok
+}
+
+// ContainingPrefix returns the longest prefix of the set containing addr, and
+// whether there is one.
+func (s *Set) ContainingPrefix(addr netip.Addr) (netip.Prefix, bool) {
+	if !addr.IsValid() {
+		return netip.Prefix{}, false
+	}
+
+	addr = addr.WithZone("")
+
+	var best netip.Prefix
+	found := false
+
+	for n := *s.root(addr); n != nil && n.prefix.Contains(addr); {
+		if n.added {
+			best, found = n.prefix, true
+		}
+
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.child[bitAt(addr, n.prefix.Bits())]
+	}
+
+	return best, found
+}
+
+// All returns an iterator over the prefixes of the set, IPv4 prefixes first,
+// in ascending order of address; a prefix comes before the longer prefixes it
+// contains.
+func (s *Set) All() iter.Seq[netip.Prefix] {
+	return func(yield func(netip.Prefix) bool) {
+		if walk(s.root4, yield) {
+			walk(s.root6, yield)
+		}
+	}
+}
+
+// root returns the trie for the family of addr.
+func (s *Set) root(addr netip.Addr) **setNode {
+	if addr.Is4() {
+		return &s.root4
+	}
+	return &s.root6
+}
+
+// insert adds a masked prefix to the trie rooted at *root and reports whether
+// it was not already present.
+func (s *Set) insert(root **setNode, prefix netip.Prefix) bool {
+	for {
+		n := *root
+		if n == nil {
+			*root = &setNode{prefix: prefix, added: true}
+			return true
+		}
+
+		common := commonBits(n.prefix, prefix)
+
+		switch {
+		case common == n.prefix.Bits() && common == prefix.Bits():
+			// Already a node, possibly only branching so far
+			added := !n.added
+			n.added = true
+			return added
+
+		case common == n.prefix.Bits():
+			// The prefix belongs below this node
+			root = &n.child[bitAt(prefix.Addr(), common)]
+
+		case common == prefix.Bits():
+			// This node belongs below the prefix
+			parent := &setNode{prefix: prefix, added: true}
+			parent.child[bitAt(n.prefix.Addr(), common)] = n
+			*root = parent
+			return true
+
+		default:
+			// The node and the prefix diverge, branch where they do
+			branch := &setNode{prefix: netip.PrefixFrom(prefix.Addr(), common).Masked()}
+			branch.child[bitAt(n.prefix.Addr(), common)] = n
+			branch.child[bitAt(prefix.Addr(), common)] = &setNode{prefix: prefix, added: true}
+			*root = branch
+			return true
+		}
+	}
+}
+
+// walk calls fn for the added prefixes of the trie rooted at n, in order, and
+// reports whether the iteration should continue.
+func walk(n *setNode, fn func(prefix netip.Prefix) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	if n.added && !fn(n.prefix) {
+		return false
+	}
+
+	return walk(n.child[0], fn) && walk(n.child[1], fn)
+}
+
+// commonBits returns the length of the longest prefix shared by a and b, at
+// most the length of the shorter one. Both must belong to the same family.
+func commonBits(a, b netip.Prefix) int {
+	x, y := a.Addr().As16(), b.Addr().As16()
+
+	// IPv4 addresses occupy the last 4 bytes of their 16-byte form
+	offset := 0
+	if a.Addr().Is4() {
+		offset = 96
+	}
+
+	n := 0
+	for i := offset / 8; i < 16; i++ {
+		if d := x[i] ^ y[i]; d != 0 {
+			n += bits.LeadingZeros8(d)
+			break
+		}
+		n += 8
+	}
+
+	return min(n, a.Bits(), b.Bits())
+}
+
+// bitAt returns the bit of addr at position i, counting from the most
+// significant bit.
+func bitAt(addr netip.Addr, i int) int {
+	if addr.Is4() {
+		b := addr.As4()
+		return int(b[i/8]>>(7-i%8)) & 1
+	}
+
+	b := addr.As16()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
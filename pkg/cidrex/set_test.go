@@ -0,0 +1,89 @@
+package cidrex
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+func TestSetContainingPrefix(t *testing.T) {
+	var s Set
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32", "192.0.2.128/25", "2001:db8::/32", "2001:db8:1::/48", "::/0"} {
+		s.Add(netip.MustParsePrefix(p))
+	}
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.0/8"},
+		{"10.1.0.1", "10.1.0.0/16"},
+		{"10.1.2.3", "10.1.2.3/32"},
+		{"10.1.2.4", "10.1.0.0/16"},
+		{"10.255.255.255", "10.0.0.0/8"},
+		{"11.0.0.0", ""},
+		{"9.255.255.255", ""},
+		{"192.0.2.127", ""},
+		{"192.0.2.128", "192.0.2.128/25"},
+		{"192.0.2.255", "192.0.2.128/25"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+		{"fe80::1%eth0", "::/0"},
+		{"::ffff:10.0.0.1", "::/0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			addr := netip.MustParseAddr(tt.addr)
+
+			got, ok := s.ContainingPrefix(addr)
+			if want := tt.want != ""; ok != want || s.Contains(addr) != want {
+				t.Fatalf("ContainingPrefix(%s) = %s, %t, want %q", addr, got, ok, tt.want)
+			}
+
+			if ok && got.String() != tt.want {
+				t.Errorf("ContainingPrefix(%s) = %s, want %s", addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAddAll(t *testing.T) {
+	tests := []struct {
+		name string
+		add  []string
+		want string
+		len  int
+	}{
+		{"empty", nil, "[]", 0},
+		{"host bits ignored", []string{"10.0.0.1/8", "10.0.0.0/8"}, "[10.0.0.0/8]", 1},
+		{"sorted", []string{"10.0.0.0/24", "2001:db8::/32", "10.0.0.0/8", "9.0.0.0/8", "10.0.1.0/24"}, "[9.0.0.0/8 10.0.0.0/8 10.0.0.0/24 10.0.1.0/24 2001:db8::/32]", 5},
+		{"split branch", []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.0.0/23"}, "[10.0.0.0/23 10.0.0.0/24 10.0.1.0/24]", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Set
+			for _, p := range tt.add {
+				s.Add(netip.MustParsePrefix(p))
+			}
+			s.Add(netip.Prefix{})
+
+			var got []netip.Prefix
+			for prefix := range s.All() {
+				got = append(got, prefix)
+			}
+
+			if g := fmt.Sprint(got); g != tt.want || s.Len() != tt.len {
+				t.Errorf("All() = %s, Len() = %d, want %s, %d", g, s.Len(), tt.want, tt.len)
+			}
+		})
+	}
+}
+
+func TestSetEmpty(t *testing.T) {
+	var s Set
+	if s.Contains(netip.MustParseAddr("10.0.0.1")) || s.Contains(netip.Addr{}) {
+		t.Error("empty set contains an address")
+	}
+}
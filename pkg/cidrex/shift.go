@@ -0,0 +1,71 @@
+package cidrex
+
+import (
+	"errors"
+	"math/big"
+	"net/netip"
+)
+
+// ErrOutOfRange is returned when the result of an operation falls outside of
+// the address family of its input.
+var ErrOutOfRange = errors.New("address out of range")
+
+// Shift returns addr offset by n addresses, carrying across octets and
+// hexadecets as needed. n may be negative. ErrOutOfRange is returned if the
+// result falls outside of the address family of addr. The zone, if any, is
+// preserved.
+func Shift(addr netip.Addr, n *big.Int) (netip.Addr, error) {
+	v := addrToInt(addr)
+	v.Add(v, n)
+
+	if v.Sign() < 0 || v.BitLen() > addr.BitLen() {
+		return netip.Addr{}, ErrOutOfRange
+	}
+
+	return intToAddr(v, addr.Is4()).WithZone(addr.Zone()), nil
+}
+
+// ShiftPrefix offsets every address of prefix by n addresses and returns the
+// resulting range as a list of prefixes. When n is a multiple of the size of
+// prefix, the result is a single prefix of the same length; otherwise, it is
+// the minimal list of prefixes covering the shifted range.
+func ShiftPrefix(prefix netip.Prefix, n *big.Int) ([]netip.Prefix, error) {
+	prefix = prefix.Masked()
+
+	first, err := Shift(prefix.Addr(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := Shift(LastAddr(prefix), n)
+	if err != nil {
+		return nil, err
+	}
+
+	return RangePrefixes(first, last), nil
+}
+
+// addrToInt returns addr as an integer.
+func addrToInt(addr netip.Addr) *big.Int {
+	if addr.Is4() {
+		b := addr.As4()
+		return new(big.Int).SetBytes(b[:])
+	}
+
+	b := addr.As16()
+	return new(big.Int).SetBytes(b[:])
+}
+
+// intToAddr returns the IPv4 or IPv6 address with the integer value v, which
+// must fit in the address family.
+func intToAddr(v *big.Int, is4 bool) netip.Addr {
+	if is4 {
+		var b [4]byte
+		v.FillBytes(b[:])
+		return netip.AddrFrom4(b)
+	}
+
+	var b [16]byte
+	v.FillBytes(b[:])
+	return netip.AddrFrom16(b)
+}
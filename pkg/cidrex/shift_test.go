@@ -0,0 +1,124 @@
+package cidrex
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"testing"
+)
+
+func TestShift(t *testing.T) {
+	tests := []struct {
+		addr string
+		n    string
+		want string
+		err  error
+	}{
+		{addr: "10.0.0.255", n: "1", want: "10.0.1.0"},
+		{addr: "10.0.1.0", n: "-1", want: "10.0.0.255"},
+		{addr: "10.0.0.0", n: "65536", want: "10.1.0.0"},
+		{addr: "0.0.0.0", n: "4294967295", want: "255.255.255.255"},
+		{addr: "255.255.255.255", n: "-4294967295", want: "0.0.0.0"},
+		{addr: "255.255.255.255", n: "1", err: ErrOutOfRange},
+		{addr: "0.0.0.0", n: "-1", err: ErrOutOfRange},
+		{addr: "10.0.0.0", n: "4294967296", err: ErrOutOfRange},
+		{addr: "2001:db8::ffff", n: "1", want: "2001:db8::1:0"},
+		{addr: "fe80::1%eth0", n: "1", want: "fe80::2%eth0"},
+		{addr: "::", n: "340282366920938463463374607431768211455", want: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{addr: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", n: "1", err: ErrOutOfRange},
+		{addr: "::", n: "-1", err: ErrOutOfRange},
+		{addr: "::", n: "340282366920938463463374607431768211456", err: ErrOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr+"+"+tt.n, func(t *testing.T) {
+			n, _ := new(big.Int).SetString(tt.n, 10)
+
+			got, err := Shift(netip.MustParseAddr(tt.addr), n)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Shift error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+
+			if err != nil || got.String() != tt.want {
+				t.Fatalf("Shift = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		n      int64
+		want   string
+		err    error
+	}{
+		{prefix: "10.0.0.0/24", n: 256, want: "[10.0.1.0/24]"},
+		{prefix: "10.0.0.0/24", n: -256, want: "[9.255.255.0/24]"},
+		{prefix: "10.0.0.7/30", n: 4, want: "[10.0.0.8/30]"},
+		{prefix: "10.0.0.0/30", n: 1, want: "[10.0.0.1/32 10.0.0.2/31 10.0.0.4/32]"},
+		{prefix: "255.255.255.0/24", n: 1, err: ErrOutOfRange},
+		{prefix: "0.0.0.0/24", n: -1, err: ErrOutOfRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.prefix, "+", tt.n), func(t *testing.T) {
+			got, err := ShiftPrefix(netip.MustParsePrefix(tt.prefix), big.NewInt(tt.n))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ShiftPrefix error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+
+			if s := fmt.Sprint(got); err != nil || s != tt.want {
+				t.Fatalf("ShiftPrefix = %s, %v, want %s", s, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdjacentPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		next   string
+		prev   string
+	}{
+		{"10.0.0.0/24", "10.0.1.0/24", "9.255.255.0/24"},
+		{"10.0.0.5/23", "10.0.2.0/23", "9.255.254.0/23"},
+		{"0.0.0.0/1", "128.0.0.0/1", ""},
+		{"255.255.255.255/32", "", "255.255.255.254/32"},
+		{"0.0.0.0/0", "", ""},
+		{"2001:db8::/32", "2001:db9::/32", "2001:db7::/32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			prefix := netip.MustParsePrefix(tt.prefix)
+			checkAdjacent(t, "NextPrefix", NextPrefix, prefix, tt.next)
+			checkAdjacent(t, "PrevPrefix", PrevPrefix, prefix, tt.prev)
+		})
+	}
+}
+
+// checkAdjacent checks the result of NextPrefix or PrevPrefix, where an empty
+// want stands for ErrOutOfRange.
+func checkAdjacent(t *testing.T, name string, fn func(netip.Prefix) (netip.Prefix, error), prefix netip.Prefix, want string) {
+	t.Helper()
+
+	got, err := fn(prefix)
+	if want == "" {
+		if !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("%s(%s) = %s, %v, want ErrOutOfRange", name, prefix, got, err)
+		}
+		return
+	}
+
+	if err != nil || got.String() != want {
+		t.Errorf("%s(%s) = %s, %v, want %s", name, prefix, got, err, want)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxPort is the highest valid TCP/UDP port number.
+const maxPort = 65535
+
+// parsePorts parses a comma-separated port specification into a sorted list of
+// unique ports. Each element is a single port, a range such as 1-1024, or an
+// exclusion prefixed with "!" such as !22 or !135-139. If the specification
+// only contains exclusions, they apply to the full 1-65535 range.
+func parsePorts(spec string) ([]uint16, error) {
+	var included, excluded [maxPort + 1]bool
+	hasIncluded := false
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		set := &included
+		if strings.HasPrefix(part, "!") {
+			set = &excluded
+			part = part[1:]
+		} else {
+			hasIncluded = true
+		}
+
+		low, high, err := parsePortRange(part)
+		if err != nil {
+			return nil, err
+		}
+
+		for port := low; port <= high; port++ {
+			set[port] = true
+		}
+	}
+
+	var ports []uint16
+	for port := 1; port <= maxPort; port++ {
+		if (included[port] || !hasIncluded) && !excluded[port] {
+			ports = append(ports, uint16(port))
+		}
+	}
+
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("port specification %q selects no ports", spec)
+	}
+
+	return ports, nil
+}
+
+// parsePortRange parses a single port or a low-high port range.
+func parsePortRange(s string) (int, int, error) {
+	lowPart, highPart, isRange := strings.Cut(s, "-")
+
+	low, err := parsePort(lowPart)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !isRange {
+		return low, low, nil
+	}
+
+	high, err := parsePort(highPart)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if low > high {
+		return 0, 0, fmt.Errorf("invalid port range %s", s)
+	}
+
+	return low, high, nil
+}
+
+// parsePort parses a single port number between 1 and 65535.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > maxPort {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+
+	return port, nil
+}
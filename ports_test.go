@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+		len  int
+	}{
+		{spec: "22", want: "[22]"},
+		{spec: "443,22,80,22", want: "[22 80 443]"},
+		{spec: "20-23, 80", want: "[20 21 22 23 80]"},
+		{spec: "20-25,!22", want: "[20 21 23 24 25]"},
+		{spec: "1-10,!2-9", want: "[1 10]"},
+		{spec: "!22", len: maxPort - 1},
+		{spec: "1-65535", len: maxPort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parsePorts(tt.spec)
+			if err != nil {
+				t.Fatalf("parsePorts(%s) error: %v", tt.spec, err)
+			}
+
+			if tt.want != "" && fmt.Sprint(got) != tt.want {
+				t.Errorf("parsePorts(%s) = %v, want %s", tt.spec, got, tt.want)
+			}
+
+			if tt.len != 0 && len(got) != tt.len {
+				t.Errorf("parsePorts(%s) has %d ports, want %d", tt.spec, len(got), tt.len)
+			}
+		})
+	}
+}
+
+func TestParsePortsErrors(t *testing.T) {
+	for _, spec := range []string{"0", "65536", "-1", "x", "10-5", "22-", "!22,22"} {
+		t.Run(spec, func(t *testing.T) {
+			if got, err := parsePorts(spec); err == nil {
+				t.Errorf("parsePorts(%q) selects %d ports, want an error", spec, len(got))
+			}
+		})
+	}
+}
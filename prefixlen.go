@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Policies applied by --prefix-policy to the prefixes outside the window of
+// --min-prefix and --max-prefix.
+const (
+	prefixDrop   = "drop"
+	prefixPass   = "pass"
+	prefixReject = "reject"
+)
+
+// prefixWindow is the range of prefix lengths of each family that are
+// expanded, such as /16 to /30 for IPv4. The other prefixes are handled as
+// told by policy.
+type prefixWindow struct {
+	min4, max4 int
+	min6, max6 int
+	policy     string
+}
+
+// parsePrefixWindow parses the --min-prefix and --max-prefix lengths, each
+// such as 16 or 16,48 for IPv6, and the policy to apply outside of them. An
+// empty length leaves that end of the window open.
+func parsePrefixWindow(minSpec, maxSpec, policy string) (*prefixWindow, error) {
+	switch policy {
+	case prefixDrop, prefixPass, prefixReject:
+	default:
+		return nil, fmt.Errorf("unknown prefix policy: %s", policy)
+	}
+
+	w := &prefixWindow{max4: 32, max6: 128, policy: policy}
+
+	var err error
+	min4, min6, _ := strings.Cut(minSpec, ",")
+	if w.min4, err = parseGroupBits(min4, 32, 0); err != nil {
+		return nil, fmt.Errorf("invalid minimum prefix length: %s", minSpec)
+	}
+	if w.min6, err = parseGroupBits(min6, 128, 0); err != nil {
+		return nil, fmt.Errorf("invalid minimum prefix length: %s", minSpec)
+	}
+
+	max4, max6, _ := strings.Cut(maxSpec, ",")
+	if w.max4, err = parseGroupBits(max4, 32, 32); err != nil {
+		return nil, fmt.Errorf("invalid maximum prefix length: %s", maxSpec)
+	}
+	if w.max6, err = parseGroupBits(max6, 128, 128); err != nil {
+		return nil, fmt.Errorf("invalid maximum prefix length: %s", maxSpec)
+	}
+
+	if w.min4 > w.max4 || w.min6 > w.max6 {
+		return nil, fmt.Errorf("--min-prefix %s is longer than --max-prefix %s", minSpec, maxSpec)
+	}
+
+	return w, nil
+}
+
+// check returns an error if the length of prefix is outside of the window of
+// its family. IPv4-mapped IPv6 prefixes are treated as IPv4.
+func (w *prefixWindow) check(prefix netip.Prefix) error {
+	bits, shortest, longest := prefix.Bits(), w.min4, w.max4
+	if prefix.Addr().Is4In6() && bits >= 96 {
+		bits -= 96
+	} else if prefix.Addr().Is6() {
+		shortest, longest = w.min6, w.max6
+	}
+
+	if bits < shortest || bits > longest {
+		return fmt.Errorf("prefix length /%d is outside of /%d to /%d", bits, shortest, longest)
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"slices"
+	"text/tabwriter"
+)
+
+// defaultMaxLineAddresses is the number of addresses above which --dry-run
+// flags a line by default, that of a /16.
+const defaultMaxLineAddresses = 1 << 16
+
+// lineCollector is implemented by collectors that tell the ranges of each
+// input line apart. startLine is called before the ranges of a line are added.
+type lineCollector interface {
+	rangeCollector
+	startLine(source string, num int, line string)
+}
+
+// preflightLine is an input line and the number of addresses of each family
+// it expands to.
+type preflightLine struct {
+	source string
+	num    int
+	line   string
+	ipv4   *big.Int
+	ipv6   *big.Int
+}
+
+// name returns the name of the line, such as scope.txt:3.
+func (l preflightLine) name() string {
+	return fmt.Sprintf("%s:%d", l.source, l.num)
+}
+
+// addresses returns the number of addresses the line expands to.
+func (l preflightLine) addresses() *big.Int {
+	return new(big.Int).Add(l.ipv4, l.ipv6)
+}
+
+// lineRange is a range expanded from the input line of index line.
+type lineRange struct {
+	addrRange
+	line int
+}
+
+// preflight counts the addresses each input line expands to, for --dry-run,
+// instead of printing them. Lines expanding to more than limit addresses are
+// flagged, unless limit is 0, and counted in exceeded once written. The
+// report is written as JSON if json is set, along with the addresses shared
+// by several lines.
+type preflight struct {
+	limit    uint64
+	json     bool
+	lines    []preflightLine
+	ranges   []lineRange
+	exceeded int
+}
+
+func (p *preflight) startLine(source string, num int, line string) {
+	p.lines = append(p.lines, preflightLine{source: source, num: num, line: line, ipv4: new(big.Int), ipv6: new(big.Int)})
+}
+
+// add counts the addresses of a range in the current line.
+func (p *preflight) add(r addrRange) {
+	if len(p.lines) == 0 {
+		return
+	}
+
+	cur := &p.lines[len(p.lines)-1]
+	count := cur.ipv4
+	if r.first.Is6() {
+		count = cur.ipv6
+	}
+	count.Add(count, rangeSize(r))
+
+	p.ranges = append(p.ranges, lineRange{addrRange: r, line: len(p.lines) - 1})
+}
+
+// exceeds reports whether a line expands to more than the limit.
+func (p *preflight) exceeds(line preflightLine) bool {
+	return p.limit > 0 && line.addresses().Cmp(new(big.Int).SetUint64(p.limit)) > 0
+}
+
+// write prints the number of addresses of each line, flagging those above the
+// limit, followed by the total.
+func (p *preflight) write(w io.Writer) error {
+	if p.json {
+		return p.writeJSON(w)
+	}
+
+	total := new(big.Int)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tADDRESSES\tENTRY")
+	for _, line := range p.lines {
+		addresses := line.addresses()
+		total.Add(total, addresses)
+
+		flag := ""
+		if p.exceeds(line) {
+			flag = fmt.Sprintf(" (exceeds %d)", p.limit)
+			p.exceeded++
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s%s\n", line.name(), addresses, line.line, flag)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("%s addresses in %d lines", total, len(p.lines))
+	if p.exceeded > 0 {
+		summary += fmt.Sprintf(", %d exceeding %d addresses", p.exceeded, p.limit)
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// preflightReport is the report of --dry-run --output json. Addresses counted
+// by several lines, or several times by a line, are duplicates.
+type preflightReport struct {
+	Lines      []preflightLineReport `json:"lines"`
+	Addresses  *big.Int              `json:"addresses"`
+	IPv4       *big.Int              `json:"ipv4"`
+	IPv6       *big.Int              `json:"ipv6"`
+	Unique     *big.Int              `json:"unique"`
+	Duplicates *big.Int              `json:"duplicates"`
+	Overlaps   []preflightOverlap    `json:"overlaps"`
+	Limit      uint64                `json:"limit"`
+	Exceeded   int                   `json:"exceeded"`
+}
+
+// preflightLineReport is a line in a preflightReport.
+type preflightLineReport struct {
+	Line      string   `json:"line"`
+	Entry     string   `json:"entry"`
+	Addresses *big.Int `json:"addresses"`
+	IPv4      *big.Int `json:"ipv4"`
+	IPv6      *big.Int `json:"ipv6"`
+	Exceeds   bool     `json:"exceeds"`
+}
+
+// preflightOverlap is the number of addresses two lines have in common.
+type preflightOverlap struct {
+	Lines     [2]string `json:"lines"`
+	Addresses *big.Int  `json:"addresses"`
+}
+
+// writeJSON writes the report as indented JSON.
+func (p *preflight) writeJSON(w io.Writer) error {
+	report := preflightReport{
+		Lines:     []preflightLineReport{},
+		Addresses: new(big.Int),
+		IPv4:      new(big.Int),
+		IPv6:      new(big.Int),
+		Limit:     p.limit,
+	}
+
+	for _, line := range p.lines {
+		exceeds := p.exceeds(line)
+		if exceeds {
+			p.exceeded++
+		}
+
+		report.Lines = append(report.Lines, preflightLineReport{
+			Line:      line.name(),
+			Entry:     line.line,
+			Addresses: line.addresses(),
+			IPv4:      line.ipv4,
+			IPv6:      line.ipv6,
+			Exceeds:   exceeds,
+		})
+		report.IPv4.Add(report.IPv4, line.ipv4)
+		report.IPv6.Add(report.IPv6, line.ipv6)
+	}
+	report.Addresses.Add(report.IPv4, report.IPv6)
+	report.Exceeded = p.exceeded
+
+	report.Unique, report.Overlaps = p.overlaps()
+	report.Duplicates = new(big.Int).Sub(report.Addresses, report.Unique)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// overlaps returns the number of distinct addresses the lines expand to, and
+// the addresses each pair of lines has in common, sweeping over the ranges in
+// address order.
+func (p *preflight) overlaps() (*big.Int, []preflightOverlap) {
+	ranges := slices.Clone(p.ranges)
+	slices.SortFunc(ranges, func(a, b lineRange) int {
+		return cmp.Or(cmp.Compare(a.first.BitLen(), b.first.BitLen()), a.first.Compare(b.first))
+	})
+
+	unique := new(big.Int)
+	shared := make(map[[2]int]*big.Int)
+
+	// active holds the ranges that may still overlap those to come, and
+	// merged the union of the ranges so far that is not counted yet
+	var active []lineRange
+	var merged *addrRange
+
+	for _, r := range ranges {
+		active = slices.DeleteFunc(active, func(a lineRange) bool {
+			return a.first.BitLen() != r.first.BitLen() || a.last.Less(r.first)
+		})
+
+		for _, a := range active {
+			if a.line == r.line {
+				continue
+			}
+
+			last := r.last
+			if a.last.Less(last) {
+				last = a.last
+			}
+
+			pair := [2]int{min(a.line, r.line), max(a.line, r.line)}
+			if shared[pair] == nil {
+				shared[pair] = new(big.Int)
+			}
+			shared[pair].Add(shared[pair], rangeSize(addrRange{first: r.first, last: last}))
+		}
+		active = append(active, r)
+
+		if merged != nil && merged.first.BitLen() == r.first.BitLen() && !merged.last.Less(r.first) {
+			if merged.last.Less(r.last) {
+				merged.last = r.last
+			}
+			continue
+		}
+
+		if merged != nil {
+			unique.Add(unique, rangeSize(*merged))
+		}
+		merged = &addrRange{first: r.first, last: r.last}
+	}
+
+	if merged != nil {
+		unique.Add(unique, rangeSize(*merged))
+	}
+
+	pairs := slices.SortedFunc(maps.Keys(shared), func(a, b [2]int) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+	})
+
+	overlaps := []preflightOverlap{}
+	for _, pair := range pairs {
+		overlaps = append(overlaps, preflightOverlap{
+			Lines:     [2]string{p.lines[pair[0]].name(), p.lines[pair[1]].name()},
+			Addresses: shared[pair],
+		})
+	}
+
+	return unique, overlaps
+}
+
+// rangeSize returns the number of addresses of a range.
+func rangeSize(r addrRange) *big.Int {
+	first, last := r.first.As16(), r.last.As16()
+	size := new(big.Int).SetBytes(last[:])
+	size.Sub(size, new(big.Int).SetBytes(first[:]))
+	return size.Add(size, big.NewInt(1))
+}
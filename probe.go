@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the liveness probes.
+const (
+	defaultProbeTimeout = time.Second
+	defaultProbeJobs    = 256
+)
+
+// prober filters records by probing their addresses concurrently, passing
+// only those of live hosts to deliver. Records may be delivered in a
+// different order than they were submitted.
+type prober struct {
+	ports   []uint16
+	pinger  *pinger
+	timeout time.Duration
+	deliver func(rec record) error
+
+	// ticker paces the probes if a rate limit was given
+	ticker *time.Ticker
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	// mu serializes calls to deliver. err is the first error it returned.
+	mu  sync.Mutex
+	err error
+}
+
+// probeOptions holds the settings of a prober.
+type probeOptions struct {
+	// spec lists the TCP probes, comma-separated, such as tcp:443,tcp:80 or
+	// tcp:8000-8010
+	spec string
+
+	// ping enables ICMP echo probes
+	ping bool
+
+	timeout time.Duration
+	jobs    int
+
+	// rate is the maximum number of addresses probed per second, or 0
+	rate int
+}
+
+// newProber creates a prober, running up to opts.jobs probes at once.
+func newProber(opts probeOptions, deliver func(rec record) error) (*prober, error) {
+	p := &prober{timeout: opts.timeout, deliver: deliver}
+
+	if opts.spec != "" {
+		ports, err := parseProbes(opts.spec)
+		if err != nil {
+			return nil, err
+		}
+		p.ports = ports
+	}
+
+	if opts.timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout: %s", opts.timeout)
+	}
+
+	if opts.jobs < 1 {
+		return nil, fmt.Errorf("invalid number of probe jobs: %d", opts.jobs)
+	}
+	p.sem = make(chan struct{}, opts.jobs)
+
+	// The ticker cannot tick more often than every nanosecond
+	if opts.rate < 0 || opts.rate > int(time.Second) {
+		return nil, fmt.Errorf("invalid rate: %d", opts.rate)
+	}
+	if opts.rate > 0 {
+		p.ticker = time.NewTicker(time.Second / time.Duration(opts.rate))
+	}
+
+	if opts.ping {
+		pinger, err := newPinger()
+		if err != nil {
+			return nil, err
+		}
+		p.pinger = pinger
+	}
+
+	return p, nil
+}
+
+// parseProbes parses a probe specification into the list of TCP ports to try.
+func parseProbes(spec string) ([]uint16, error) {
+	var ports []uint16
+
+	for _, part := range strings.Split(spec, ",") {
+		proto, portSpec, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || proto != "tcp" {
+			return nil, fmt.Errorf("invalid probe %q, expected tcp:PORT", part)
+		}
+
+		low, high, err := parsePortRange(portSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		for port := low; port <= high; port++ {
+			ports = append(ports, uint16(port))
+		}
+	}
+
+	return ports, nil
+}
+
+// submit probes the address of rec in the background once a slot is free,
+// and delivers rec if the host is live. It returns the error of a previous
+// delivery, if any.
+func (p *prober) submit(rec record) error {
+	p.mu.Lock()
+	err := p.err
+	p.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if p.ticker != nil {
+		<-p.ticker.C
+	}
+
+	p.sem <- struct{}{}
+	p.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+
+		if !p.alive(rec.addr) {
+			return
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.err == nil {
+			p.err = p.deliver(rec)
+		}
+	}()
+
+	return nil
+}
+
+// alive reports whether addr answers a ping, if enabled, or accepts a TCP
+// connection on any of the ports.
+func (p *prober) alive(addr netip.Addr) bool {
+	if p.pinger != nil && p.pinger.ping(addr, p.timeout) {
+		return true
+	}
+
+	for _, port := range p.ports {
+		conn, err := net.DialTimeout("tcp", netip.AddrPortFrom(addr, port).String(), p.timeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+	}
+
+	return false
+}
+
+// wait waits for the pending probes and returns the first delivery error.
+func (p *prober) wait() error {
+	p.wg.Wait()
+
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
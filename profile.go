@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+// profiler serves the net/http/pprof endpoints and records a CPU profile while
+// a command runs, as requested with --pprof and --cpuprofile, so that users
+// can look into the performance of their own workloads.
+type profiler struct {
+	addr       string
+	cpuProfile string
+
+	server *http.Server
+	file   *os.File
+}
+
+// addProfileFlags registers the profiling flags on cmd and its subcommands.
+func addProfileFlags(cmd *cobra.Command, p *profiler) {
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&p.addr, "pprof", "", "Serve the net/http/pprof endpoints at this address while running, e.g. localhost:6060")
+	flags.StringVar(&p.cpuProfile, "cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+}
+
+// start starts the requested profiling. The address the endpoints are served
+// at is logged, since it may have been chosen by the system.
+func (p *profiler) start() error {
+	if p.addr != "" {
+		listener, err := net.Listen("tcp", p.addr)
+		if err != nil {
+			return fmt.Errorf("unable to serve pprof: %w", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", httppprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+
+		p.server = &http.Server{Handler: mux}
+		go p.server.Serve(listener)
+
+		url := fmt.Sprintf("http://%s/debug/pprof/", listener.Addr())
+		slog.Info("serving pprof", "url", url)
+	}
+
+	if p.cpuProfile != "" {
+		file, err := os.Create(p.cpuProfile)
+		if err != nil {
+			return fmt.Errorf("unable to create CPU profile: %w", err)
+		}
+
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return fmt.Errorf("unable to start CPU profile: %w", err)
+		}
+
+		p.file = file
+	}
+
+	return nil
+}
+
+// stop stops the profiling started by start, if any, and writes out the CPU
+// profile.
+func (p *profiler) stop() error {
+	if p.server != nil {
+		p.server.Close()
+		p.server = nil
+	}
+
+	if p.file == nil {
+		return nil
+	}
+
+	pprof.StopCPUProfile()
+	err := p.file.Close()
+	p.file = nil
+	if err != nil {
+		return fmt.Errorf("unable to write CPU profile: %w", err)
+	}
+
+	return nil
+}
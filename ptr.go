@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"regexp"
+)
+
+// ptrFilter keeps the addresses with a PTR record matching a regular
+// expression, such as `vpn|fw|gw`, or with invert, those without one.
+// Addresses without PTR records match nothing, and those whose records cannot
+// be looked up are dropped either way.
+type ptrFilter struct {
+	dns    *dnsResolver
+	re     *regexp.Regexp
+	invert bool
+}
+
+// newPTRFilter compiles the expression of --ptr-match, whose records are
+// looked up through dns.
+func newPTRFilter(expression string, invert bool, dns *dnsResolver) (*ptrFilter, error) {
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --ptr-match expression: %w", err)
+	}
+
+	return &ptrFilter{dns: dns, re: re, invert: invert}, nil
+}
+
+// match reports whether addr is kept by the filter.
+func (f *ptrFilter) match(addr netip.Addr) bool {
+	names, err := f.dns.ptr(addr)
+	if err != nil {
+		slog.Warn("unable to look up PTR records", "addr", addr, "error", err)
+		return false
+	}
+
+	for _, name := range names {
+		if f.re.MatchString(name) {
+			return !f.invert
+		}
+	}
+
+	return f.invert
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// refangReplacer undoes the usual ways of defanging the addresses of
+// indicators of compromise, such as 192[.]168[.]1[.]1 or 2001[:]db8::1.
+var refangReplacer = strings.NewReplacer(
+	"[.]", ".", "(.)", ".", "{.}", ".",
+	"[dot]", ".", "(dot)", ".", "{dot}", ".",
+	"[DOT]", ".", "(DOT)", ".", "{DOT}", ".",
+	"[:]", ":", "(:)", ":", "{:}", ":",
+	"[://]", "://",
+)
+
+// defangReplacer defangs addresses, so that they cannot be clicked or resolved
+// by accident once pasted into a report.
+var defangReplacer = strings.NewReplacer(".", "[.]", ":", "[:]")
+
+// defang defangs an address, as in 203[.]0[.]113[.]5 or 2001[:]db8[:][:]1.
+func defang(addr string) string {
+	return defangReplacer.Replace(addr)
+}
+
+// defangHost defangs an address, followed by its port if not 0 as in
+// 203[.]0[.]113[.]5:443 or [2001[:]db8[:][:]1]:443.
+func defangHost(addr netip.Addr, port uint16) string {
+	host := defang(addr.String())
+	if port == 0 {
+		return host
+	}
+
+	if addr.Is6() {
+		host = "[" + host + "]"
+	}
+
+	return host + ":" + strconv.Itoa(int(port))
+}
+
+// defangScheme defangs the scheme of a URL, as in hxxps or fxp.
+func defangScheme(scheme string) string {
+	switch scheme {
+	case "http", "https":
+		return "hxxp" + scheme[4:]
+	case "ftp":
+		return "fxp"
+	default:
+		return scheme
+	}
+}
+
+// refang restores a defanged entry. URLs are reduced to their host, whatever
+// their scheme, so that hxxp://10[.]0[.]0[.]1:8080/login yields 10.0.0.1.
+func refang(entry string) string {
+	entry = refangReplacer.Replace(entry)
+
+	_, rest, ok := strings.Cut(entry, "://")
+	if !ok {
+		return entry
+	}
+
+	// Keep the authority, without user information
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		rest = rest[i+1:]
+	}
+
+	// Remove the port, of IPv6 hosts in brackets or of IPv4 hosts
+	if host, ok := strings.CutPrefix(rest, "["); ok {
+		host, _, _ = strings.Cut(host, "]")
+		return host
+	}
+
+	if strings.Count(rest, ":") == 1 {
+		rest, _, _ = strings.Cut(rest, ":")
+	}
+
+	return rest
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// replPrompt is printed before each line read from a terminal.
+const replPrompt = "cidrex> "
+
+// maxReplHistory is the number of lines kept in the history of the repl
+// command.
+const maxReplHistory = 1000
+
+// defaultPagerRows is the height of the terminal assumed when it cannot be
+// found out.
+const defaultPagerRows = 24
+
+// replHelp is printed by the help command of the repl.
+const replHelp = `expand ENTRY...            print the addresses of entries
+info ENTRY...              print the netmask, range and size of entries
+contains ENTRY [in] ENTRY  tell whether the addresses of an entry are all in another
+history                    list the previous lines, run again with !! or !N
+help                       print this help
+exit, quit                 leave the repl, like Ctrl-D
+
+Entries are written as in input files: addresses, CIDRs, netmasks or ranges.
+last stands for the last entry used, as in contains 10.0.0.5 in last.
+`
+
+// replOptions holds the command-line options of the repl command.
+type replOptions struct {
+	historyFile string
+	noPager     bool
+}
+
+// newReplCmd creates the repl subcommand.
+func newReplCmd() *cobra.Command {
+	opts := &replOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "repl",
+		Short: "Run expand, info and contains commands interactively",
+		Long: "Run expand, info and contains commands interactively, for subnet math\n" +
+			"without running cidrex again. Type help for the list of commands.\n\n" +
+			"Lines are kept in a history, listed by the history command and run again\n" +
+			"with !! or !N, and saved to --history-file between sessions. Output longer\n" +
+			"than the terminal is shown in $PAGER, less by default. Ctrl-C stops the\n" +
+			"running command, and Ctrl-D leaves the repl.\n\n" +
+			"Lines are read as typed: use rlwrap for line editing and arrow keys.",
+		Example: "  cidrex repl\n" +
+			"  rlwrap cidrex repl\n" +
+			"  printf 'info 10.0.0.0/29\\ncontains 10.0.0.5 in last\\n' | cidrex repl",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return runRepl(opts)
+		},
+	}
+
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".cidrex_history")
+	}
+
+	cmd.Flags().StringVar(&opts.historyFile, "history-file", historyFile, "File the history is saved to, or \"\" to keep it for the session only")
+	cmd.Flags().BoolVar(&opts.noPager, "no-pager", false, "Never show output in a pager")
+
+	return cmd
+}
+
+// runRepl reads and runs commands from stdin until exit or the end of input.
+// Commands that fail are reported on stderr, and make the repl exit with
+// exitInvalidInput once done.
+func runRepl(opts *replOptions) error {
+	s := &replSession{}
+	s.openHistory(opts.historyFile)
+	defer s.closeHistory()
+
+	if !opts.noPager && isTerminal(os.Stdout) {
+		s.pager = os.Getenv("PAGER")
+		if s.pager == "" {
+			s.pager = "less"
+		}
+
+		s.rows, _ = terminalSize(os.Stdout)
+		if s.rows <= 0 {
+			s.rows = defaultPagerRows
+		}
+	}
+
+	// Ctrl-C stops the running command rather than the repl
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for range signals {
+			s.interrupted.Store(true)
+		}
+	}()
+
+	interactive := isTerminal(os.Stdin)
+	failed, quit := false, false
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for !quit {
+		if interactive {
+			fmt.Print(replPrompt)
+		}
+		if !scanner.Scan() {
+			// Leave the prompt line on Ctrl-D
+			if interactive {
+				fmt.Println()
+			}
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			recalled, err := s.recall(line)
+			if err != nil {
+				slog.Error("command failed", "error", err)
+				failed = true
+				continue
+			}
+			line = recalled
+			fmt.Println(line)
+		}
+		s.addHistory(line)
+
+		var err error
+		if quit, err = s.run(line); err != nil {
+			slog.Error("command failed", "error", err)
+			failed = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read commands: %w", err)
+	}
+
+	if failed {
+		return &exitError{code: exitInvalidInput}
+	}
+
+	return nil
+}
+
+// replSession holds the state of the repl between commands.
+type replSession struct {
+	// last is the last entry used by a command, which last stands for
+	last string
+
+	// history holds the previous lines, and historyOut is the file they are
+	// appended to, if any
+	history    []string
+	historyOut *os.File
+
+	// pager is the command output longer than rows lines is shown in, if any
+	pager string
+	rows  int
+
+	// interrupted is set by Ctrl-C, stopping the running command
+	interrupted atomic.Bool
+}
+
+// openHistory loads the history saved to name, if any, and opens it for the
+// lines of this session. Problems with the history are reported on stderr,
+// and the history is then kept for the session only.
+func (s *replSession) openHistory(name string) {
+	if name == "" {
+		return
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("unable to read history", "file", name, "error", err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+	s.trimHistory()
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		slog.Warn("unable to save history", "error", err)
+		return
+	}
+	s.historyOut = file
+}
+
+// closeHistory closes the history file, if any.
+func (s *replSession) closeHistory() {
+	if s.historyOut != nil {
+		s.historyOut.Close()
+	}
+}
+
+// addHistory adds a line to the history, and saves it to the history file.
+func (s *replSession) addHistory(line string) {
+	s.history = append(s.history, line)
+	s.trimHistory()
+
+	if s.historyOut == nil {
+		return
+	}
+	if _, err := fmt.Fprintln(s.historyOut, line); err != nil {
+		slog.Warn("unable to save history", "error", err)
+		s.historyOut.Close()
+		s.historyOut = nil
+	}
+}
+
+// trimHistory drops the oldest lines past maxReplHistory.
+func (s *replSession) trimHistory() {
+	if len(s.history) > maxReplHistory {
+		s.history = s.history[len(s.history)-maxReplHistory:]
+	}
+}
+
+// recall returns the line of the history referred to by !! for the previous
+// line, or !N for the N-th line listed by the history command.
+func (s *replSession) recall(ref string) (string, error) {
+	if ref == "!!" {
+		if len(s.history) == 0 {
+			return "", fmt.Errorf("history is empty")
+		}
+		return s.history[len(s.history)-1], nil
+	}
+
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(s.history) {
+		return "", fmt.Errorf("no such line in history: %s", ref)
+	}
+
+	return s.history[n-1], nil
+}
+
+// run runs a line of the repl, and reports whether the repl should exit.
+func (s *replSession) run(line string) (bool, error) {
+	fields := strings.Fields(line)
+	name, args := strings.ToLower(fields[0]), fields[1:]
+
+	for i, arg := range args {
+		if strings.EqualFold(arg, "last") {
+			if s.last == "" {
+				return false, fmt.Errorf("no entry was used yet, for last to stand for")
+			}
+			args[i] = s.last
+		}
+	}
+
+	var command func(w io.Writer) error
+	switch name {
+	case "expand", "info":
+		if len(args) == 0 {
+			return false, fmt.Errorf("usage: %s ENTRY...", name)
+		}
+
+		targets, err := parseReplEntries(args)
+		if err != nil {
+			return false, err
+		}
+		s.last = args[len(args)-1]
+
+		command = func(w io.Writer) error {
+			return s.expand(w, targets)
+		}
+		if name == "info" {
+			command = func(w io.Writer) error {
+				return replInfo(w, targets)
+			}
+		}
+
+	case "contains":
+		if len(args) == 3 && strings.EqualFold(args[1], "in") {
+			args = []string{args[0], args[2]}
+		}
+		if len(args) != 2 {
+			return false, fmt.Errorf("usage: contains ENTRY [in] ENTRY")
+		}
+
+		targets, err := parseReplEntries(args)
+		if err != nil {
+			return false, err
+		}
+		s.last = args[1]
+
+		command = func(w io.Writer) error {
+			verb := "is in"
+			if !targetContains(targets[1], targets[0]) {
+				verb = "is not in"
+			}
+			_, err := fmt.Fprintln(w, args[0], verb, args[1])
+			return err
+		}
+
+	case "history":
+		command = func(w io.Writer) error {
+			for i, line := range s.history {
+				if _, err := fmt.Fprintf(w, "%5d  %s\n", i+1, line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case "help":
+		command = func(w io.Writer) error {
+			_, err := io.WriteString(w, replHelp)
+			return err
+		}
+
+	case "exit", "quit":
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("unknown command: %s, type help for the list of commands", name)
+	}
+
+	return false, s.output(command)
+}
+
+// output runs a command writing to the terminal, or to the pager once its
+// output gets longer than the terminal. Quitting the pager before the end of
+// the output, or pressing Ctrl-C, stops the command without an error.
+func (s *replSession) output(command func(w io.Writer) error) error {
+	s.interrupted.Store(false)
+
+	p := &replPager{command: s.pager, rows: s.rows - 1}
+	writer := newOutputWriter(p, defaultBufferSize, 0)
+
+	err := command(writer)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := p.close(); err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, syscall.EPIPE) {
+		return nil
+	}
+	if errors.Is(err, errInterrupted) {
+		slog.Warn("interrupted")
+		return nil
+	}
+
+	return err
+}
+
+// expand prints the addresses of the targets, until Ctrl-C is pressed.
+func (s *replSession) expand(w io.Writer, targets []target) error {
+	for _, t := range targets {
+		for addr := range (cidrex.Target{Prefixes: t.prefixes, Zone: t.zone}).Addresses() {
+			if s.interrupted.Load() {
+				return errInterrupted
+			}
+
+			if _, err := fmt.Fprintln(w, addr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseReplEntries parses the entries given to a command of the repl.
+func parseReplEntries(args []string) ([]target, error) {
+	targets := make([]target, len(args))
+	for i, arg := range args {
+		t, err := parseEntry(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR: %w", err)
+		}
+		targets[i] = t
+	}
+
+	return targets, nil
+}
+
+// replInfo prints the netmask, range, size and reverse zone of each prefix of
+// the targets, in blocks separated by a blank line.
+func replInfo(w io.Writer, targets []target) error {
+	var b strings.Builder
+	for _, t := range targets {
+		for _, prefix := range t.prefixes {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+
+			fmt.Fprintf(&b, "%-10s %s\n", "prefix", prefix)
+			if prefix.Addr().Is4() {
+				var mask [4]byte
+				for i := range mask {
+					bits := min(max(prefix.Bits()-8*i, 0), 8)
+					mask[i] = byte(0xff << (8 - bits))
+				}
+				wildcard := [4]byte{^mask[0], ^mask[1], ^mask[2], ^mask[3]}
+				fmt.Fprintf(&b, "%-10s %s\n", "netmask", netip.AddrFrom4(mask))
+				fmt.Fprintf(&b, "%-10s %s\n", "wildcard", netip.AddrFrom4(wildcard))
+			}
+			fmt.Fprintf(&b, "%-10s %s - %s\n", "range", prefix.Addr(), cidrex.LastAddr(prefix))
+			fmt.Fprintf(&b, "%-10s %s\n", "addresses", cidrex.PrefixSize(prefix))
+			if zone, err := cidrex.ReverseZone(prefix); err == nil {
+				fmt.Fprintf(&b, "%-10s %s\n", "reverse", zone)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// targetContains reports whether every address of inner is in outer. The
+// prefixes of a target are the largest aligned blocks covering it, so each
+// prefix of inner must fall within a single prefix of outer.
+func targetContains(outer, inner target) bool {
+	for _, p := range inner.prefixes {
+		found := false
+		for _, q := range outer.prefixes {
+			if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replPager holds the output of a command until it gets longer than rows
+// lines, at which point it starts the pager command and writes to it instead.
+// Shorter output is written to stdout once the command is done.
+type replPager struct {
+	command string
+	rows    int
+	buf     []byte
+	lines   int
+
+	cmd  *exec.Cmd
+	pipe io.WriteCloser
+}
+
+// Write implements io.Writer.
+func (p *replPager) Write(b []byte) (int, error) {
+	if p.pipe != nil {
+		return p.pipe.Write(b)
+	}
+	if p.command == "" {
+		return os.Stdout.Write(b)
+	}
+
+	p.buf = append(p.buf, b...)
+	p.lines += bytes.Count(b, []byte{'\n'})
+	if p.lines <= p.rows {
+		return len(b), nil
+	}
+
+	cmd := shellCommand(context.Background(), p.command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("unable to start pager: %w", err)
+	}
+	p.cmd, p.pipe = cmd, pipe
+
+	if _, err := pipe.Write(p.buf); err != nil {
+		return 0, err
+	}
+	p.buf = nil
+
+	return len(b), nil
+}
+
+// close writes the held output to stdout, or waits for the pager to exit.
+func (p *replPager) close() error {
+	if p.pipe == nil {
+		_, err := os.Stdout.Write(p.buf)
+		return err
+	}
+
+	p.pipe.Close()
+
+	// The exit status of the pager does not matter, only that it is done
+	var exitErr *exec.ExitError
+	if err := p.cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	return nil
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
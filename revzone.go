@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// maxRevzoneBits bounds the size of the zones generated by the revzone
+// command to 2 to the power of maxRevzoneBits records.
+const maxRevzoneBits = 24
+
+// revzoneOptions holds the command-line options of the revzone command.
+type revzoneOptions struct {
+	template   string
+	ns         string
+	hostmaster string
+	ttl        uint32
+	serial     uint32
+}
+
+// newRevzoneCmd creates the revzone subcommand.
+func newRevzoneCmd() *cobra.Command {
+	opts := &revzoneOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "revzone PREFIX",
+		Short: "Generate a BIND reverse zone file for a prefix",
+		Long: "Generate a BIND reverse zone file for a prefix, with a PTR record for each\n" +
+			"of its addresses named after --domain-template, and SOA and NS records.\n\n" +
+			"{index} in the template is replaced by the number of the address within the\n" +
+			"prefix, starting at 0, {dashed} by the address with its dots or colons\n" +
+			"replaced by dashes, and {last_octet} by the last byte of the address.\n" +
+			"Numbers can be padded with zeros to a width, as in {index:3}. The prefix\n" +
+			"must end on an octet boundary for IPv4, or a nibble boundary for IPv6, and\n" +
+			"hold at most 2^24 addresses.",
+		Example: "  cidrex revzone 203.0.113.0/24 --domain-template 'host-{index}.example.com'\n" +
+			"  cidrex revzone 2001:db8::/120 --domain-template '{dashed}.example.com' --ns ns1.example.net",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runRevzone(opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.template, "domain-template", "", "Name of the PTR records, with {index}, {dashed} and {last_octet} placeholders")
+	cmd.Flags().StringVar(&opts.ns, "ns", "ns1.example.com", "Name server of the zone")
+	cmd.Flags().StringVar(&opts.hostmaster, "hostmaster", "hostmaster.example.com", "Mailbox of the person responsible for the zone, as a domain name")
+	cmd.Flags().Uint32Var(&opts.ttl, "ttl", 3600, "Default TTL of the records, in seconds")
+	cmd.Flags().Uint32Var(&opts.serial, "serial", 0, "Serial number of the zone (default today's date as YYYYMMDD01)")
+	cmd.MarkFlagRequired("domain-template")
+
+	return cmd
+}
+
+// runRevzone prints the reverse zone of the prefix given as entry.
+func runRevzone(opts *revzoneOptions, entry string) error {
+	template, err := newHostnameTemplate(opts.template)
+	if err != nil {
+		return err
+	}
+
+	t, err := parseEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	if len(t.prefixes) != 1 {
+		return fmt.Errorf("not a single prefix: %s", entry)
+	}
+
+	prefix := t.prefixes[0].Masked()
+
+	origin, err := cidrex.ReverseZone(prefix)
+	if err != nil {
+		return fmt.Errorf("%s: %w", prefix, err)
+	}
+
+	if prefix.Addr().BitLen()-prefix.Bits() > maxRevzoneBits {
+		return fmt.Errorf("%s holds more than 2^%d addresses", prefix, maxRevzoneBits)
+	}
+
+	serial := opts.serial
+	if serial == 0 {
+		serial = todaySerial()
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	err = writeRevzone(writer, opts, serial, origin, cidrex.Target{Prefixes: []netip.Prefix{prefix}}, template)
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// todaySerial returns a zone serial number for the current date, in the
+// conventional YYYYMMDDnn form.
+func todaySerial() uint32 {
+	now := time.Now()
+	return uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100 + 1)
+}
+
+// writeRevzone writes the zone origin holding the addresses of target.
+func writeRevzone(w io.Writer, opts *revzoneOptions, serial uint32, origin string, target cidrex.Target, template hostnameTemplate) error {
+	ns, hostmaster := fqdn(opts.ns), fqdn(opts.hostmaster)
+
+	_, err := fmt.Fprintf(w, "$ORIGIN %s\n"+
+		"$TTL %d\n"+
+		"@\tIN\tSOA\t%s %s (\n"+
+		"\t\t%d ; serial\n"+
+		"\t\t%d ; refresh\n"+
+		"\t\t%d ; retry\n"+
+		"\t\t%d ; expire\n"+
+		"\t\t%d ) ; minimum\n"+
+		"@\tIN\tNS\t%s\n",
+		origin, opts.ttl, ns, hostmaster, serial, opts.ttl, opts.ttl/4, 1209600, opts.ttl, ns)
+	if err != nil {
+		return err
+	}
+
+	var index uint64
+	for addr := range target.Addresses() {
+		owner := strings.TrimSuffix(cidrex.ReverseName(addr), "."+origin)
+
+		if _, err := fmt.Fprintf(w, "%s\tIN\tPTR\t%s\n", owner, fqdn(template.name(addr, index, index))); err != nil {
+			return err
+		}
+
+		index++
+	}
+
+	return nil
+}
+
+// fqdn returns name as a fully qualified domain name, ending with a dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
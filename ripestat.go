@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// ripeStatNetworkURL is the RIPEstat endpoint returning the announced prefix
+// holding an address, and its origin ASes.
+const ripeStatNetworkURL = "https://stat.ripe.net/data/network-info/data.json?resource=%s"
+
+// ripeStatOverviewURL is the RIPEstat endpoint returning the holder of an
+// autonomous system.
+const ripeStatOverviewURL = "https://stat.ripe.net/data/as-overview/data.json?resource=AS%d"
+
+// ripeStatAbuseURL is the RIPEstat endpoint returning the abuse contacts of a
+// prefix.
+const ripeStatAbuseURL = "https://stat.ripe.net/data/abuse-contact-finder/data.json?resource=%s"
+
+// ripeStatAnnotator annotates addresses with the announced prefix they belong
+// to, its origin AS, the holder of the AS and the abuse contact of the prefix,
+// according to RIPEstat. Each prefix is only looked up once, and responses are
+// cached like feeds. The prefixes of the ASNs of the input are known to be
+// announced by them, which saves a lookup.
+type ripeStatAnnotator struct {
+	feeds    feedCache
+	limiter  lookupLimiter
+	networks networkAnnotations
+
+	// announced holds the prefixes announced by the ASNs of the input, and
+	// origins their ASN
+	announced cidrex.Set
+	origins   map[netip.Prefix]uint32
+
+	// holders holds the holder of each AS looked up so far
+	holders map[uint32]string
+}
+
+// newRipeStatAnnotator creates a ripeStatAnnotator using cached responses as
+// told by feeds, and spacing out lookups by at least interval.
+func newRipeStatAnnotator(feeds feedCache, interval time.Duration) *ripeStatAnnotator {
+	return &ripeStatAnnotator{
+		feeds:   feeds,
+		limiter: lookupLimiter{interval: interval},
+		origins: make(map[netip.Prefix]uint32),
+		holders: make(map[uint32]string),
+	}
+}
+
+// announce records that asn announces prefixes.
+func (a *ripeStatAnnotator) announce(asn uint32, prefixes []netip.Prefix) {
+	for _, prefix := range prefixes {
+		a.announced.Add(prefix)
+		a.origins[prefix.Masked()] = asn
+	}
+}
+
+func (a *ripeStatAnnotator) annotate(addr netip.Addr) string {
+	addr = addr.WithZone("")
+
+	if annotation, ok := a.networks.get(addr); ok {
+		return annotation
+	}
+
+	prefix, annotation, err := a.lookup(addr)
+	if err != nil {
+		slog.Warn("unable to look up address", "addr", addr, "error", err)
+	}
+	if !prefix.IsValid() {
+		// Leave the rest of the block unannotated rather than looking it up
+		// once per address
+		prefix = annotationBlock(addr)
+	}
+
+	a.networks.add(prefix, annotation)
+
+	return annotation
+}
+
+// lookup returns the announced prefix holding addr and its annotation. The
+// prefix is invalid if addr is not announced.
+func (a *ripeStatAnnotator) lookup(addr netip.Addr) (netip.Prefix, string, error) {
+	prefix, ok := a.announced.ContainingPrefix(addr)
+	asn := a.origins[prefix]
+
+	if !ok {
+		var resp struct {
+			Data struct {
+				ASNs   []string `json:"asns"`
+				Prefix string   `json:"prefix"`
+			} `json:"data"`
+		}
+		if err := a.get(fmt.Sprintf(ripeStatNetworkURL, addr), &resp); err != nil {
+			return netip.Prefix{}, "", err
+		}
+
+		if resp.Data.Prefix == "" {
+			return netip.Prefix{}, "", nil
+		}
+
+		var err error
+		if prefix, err = netip.ParsePrefix(resp.Data.Prefix); err != nil {
+			return netip.Prefix{}, "", fmt.Errorf("invalid prefix in RIPEstat response: %s", resp.Data.Prefix)
+		}
+		if len(resp.Data.ASNs) > 0 {
+			if n, err := strconv.ParseUint(resp.Data.ASNs[0], 10, 32); err == nil {
+				asn = uint32(n)
+			}
+		}
+	}
+
+	holder, err := a.holder(asn)
+	if err != nil {
+		return prefix, "", err
+	}
+
+	var abuse struct {
+		Data struct {
+			AbuseContacts []string `json:"abuse_contacts"`
+		} `json:"data"`
+	}
+	if err := a.get(fmt.Sprintf(ripeStatAbuseURL, prefix.Masked()), &abuse); err != nil {
+		return prefix, "", err
+	}
+
+	return prefix.Masked(), ripeStatAnnotation(asn, holder, abuse.Data.AbuseContacts, prefix.Masked()), nil
+}
+
+// holder returns the holder of an autonomous system, or "" for AS0, which
+// stands for an unknown origin.
+func (a *ripeStatAnnotator) holder(asn uint32) (string, error) {
+	if asn == 0 {
+		return "", nil
+	}
+
+	if holder, ok := a.holders[asn]; ok {
+		return holder, nil
+	}
+
+	var resp struct {
+		Data struct {
+			Holder string `json:"holder"`
+		} `json:"data"`
+	}
+	if err := a.get(fmt.Sprintf(ripeStatOverviewURL, asn), &resp); err != nil {
+		return "", err
+	}
+
+	a.holders[asn] = resp.Data.Holder
+
+	return resp.Data.Holder, nil
+}
+
+// get decodes the RIPEstat response of url into v.
+func (a *ripeStatAnnotator) get(url string, v any) error {
+	data, err := readFeedWith(url, a.feeds, func(url string) ([]byte, error) {
+		a.limiter.wait()
+		return downloadFeed(url)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid RIPEstat response: %w", err)
+	}
+
+	return nil
+}
+
+// ripeStatAnnotation formats the annotation of a prefix, such as asn=13335
+// holder="CLOUDFLARENET - Cloudflare, Inc." abuse=abuse@cloudflare.com
+// cidr=1.1.1.0/24, leaving out the parts that are unknown.
+func ripeStatAnnotation(asn uint32, holder string, abuse []string, prefix netip.Prefix) string {
+	var parts []string
+	if asn != 0 {
+		parts = append(parts, "asn="+strconv.FormatUint(uint64(asn), 10))
+	}
+	if holder != "" {
+		parts = append(parts, "holder="+strconv.Quote(holder))
+	}
+	if len(abuse) > 0 {
+		parts = append(parts, "abuse="+strings.Join(abuse, ","))
+	}
+	parts = append(parts, "cidr="+prefix.String())
+
+	return strings.Join(parts, " ")
+}
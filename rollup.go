@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// rollUp maps the expanded addresses to their enclosing prefix of a fixed
+// length and prints each prefix once, in ascending order.
+type rollUp struct {
+	groups *grouping
+	set    rangeSet
+}
+
+// add rolls up the addresses of a range.
+func (u *rollUp) add(r addrRange) {
+	first := u.groups.group(r.first)
+	last := u.groups.group(r.last)
+
+	for _, prefix := range cidrex.RangePrefixes(first.Addr(), cidrex.LastAddr(last)) {
+		u.set.addPrefix(prefix)
+	}
+}
+
+// write prints the prefixes holding at least one address.
+func (u *rollUp) write(w io.Writer) error {
+	u.set.normalize()
+
+	for _, r := range u.set.ranges {
+		for prefix := u.groups.group(r.first); ; prefix, _ = cidrex.NextPrefix(prefix) {
+			if _, err := fmt.Fprintln(w, prefix); err != nil {
+				return err
+			}
+
+			if cidrex.LastAddr(prefix) == r.last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
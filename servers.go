@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serversOptions holds the command-line options of the mx and ns commands.
+type serversOptions struct {
+	ipv4      bool
+	ipv6      bool
+	annotate  bool
+	resolvers []string
+	timeout   time.Duration
+}
+
+// newMXCmd creates the mx subcommand.
+func newMXCmd() *cobra.Command {
+	return newServersCmd("mx", "MX", "mail servers", (*dnsResolver).mx)
+}
+
+// newNSCmd creates the ns subcommand.
+func newNSCmd() *cobra.Command {
+	return newServersCmd("ns", "NS", "name servers", (*dnsResolver).ns)
+}
+
+// newServersCmd creates a subcommand printing the addresses of the servers
+// named by the records of a domain, as returned by lookup.
+func newServersCmd(name, record, servers string, lookup func(*dnsResolver, string) ([]string, error)) *cobra.Command {
+	opts := &serversOptions{}
+
+	cmd := &cobra.Command{
+		Use:   name + " [domain...]",
+		Short: fmt.Sprintf("Print the addresses of the %s of domains", servers),
+		Long: fmt.Sprintf("Print the addresses of the %s of domains, resolving the hosts of their\n", servers) +
+			fmt.Sprintf("%s records to all of their A and AAAA records.\n\n", record) +
+			"If no domain is given, domains are read from stdin.",
+		Example: fmt.Sprintf("  cidrex %s example.com\n", name) +
+			fmt.Sprintf("  cidrex %s --annotate example.com example.org", name),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runServers(opts, args, record, lookup)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 addresses")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 addresses")
+	flags.BoolVar(&opts.annotate, "annotate", false, fmt.Sprintf("Follow each address with the record type and the hostname, as in \"192.0.2.1 %s host.example.com\"", record))
+	flags.StringSliceVar(&opts.resolvers, "resolvers", nil, "DNS servers to query, e.g. 1.1.1.1,8.8.8.8:53 (default: the system resolver)")
+	flags.DurationVar(&opts.timeout, "dns-timeout", defaultDNSTimeout, "Time allowed for each DNS query")
+
+	return cmd
+}
+
+// runServers prints the addresses of the servers of each domain, once each.
+func runServers(opts *serversOptions, args []string, record string, lookup func(*dnsResolver, string) ([]string, error)) error {
+	dns, err := newDNSResolver(opts.resolvers, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	s := &serverPrinter{
+		dns:         dns,
+		lookup:      lookup,
+		record:      record,
+		annotate:    opts.annotate,
+		includeIPv4: opts.ipv4 || !opts.ipv4 && !opts.ipv6,
+		includeIPv6: opts.ipv6 || !opts.ipv4 && !opts.ipv6,
+		printed:     make(map[string]bool),
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	invalid := 0
+	err = forEachEntry(args, os.Stdin, func(domain string) error {
+		if !isHostname(domain) {
+			slog.Warn("invalid domain", "entry", domain)
+			invalid++
+			return nil
+		}
+
+		return s.print(writer, domain)
+	})
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if invalid > 0 {
+		return &exitError{code: exitInvalidInput}
+	}
+
+	return nil
+}
+
+// serverPrinter prints the addresses of the servers of domains. Servers that
+// cannot be resolved are reported on stderr.
+type serverPrinter struct {
+	dns         *dnsResolver
+	lookup      func(*dnsResolver, string) ([]string, error)
+	record      string
+	annotate    bool
+	includeIPv4 bool
+	includeIPv6 bool
+
+	// printed holds the lines already printed
+	printed map[string]bool
+}
+
+// print prints the addresses of the servers of domain.
+func (s *serverPrinter) print(w io.Writer, domain string) error {
+	hosts, err := s.lookup(s.dns, domain)
+	if err != nil {
+		slog.Warn("unable to read records", "record", s.record, "domain", domain, "error", err)
+		return nil
+	}
+
+	for _, host := range hosts {
+		addrs, err := s.dns.resolve(host)
+		if err != nil {
+			slog.Warn("unable to resolve host", "record", s.record, "domain", domain, "host", host, "error", err)
+			continue
+		}
+
+		for _, addr := range addrs {
+			if err := s.printAddr(w, addr, host); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printAddr prints the address of a server, unless it was already printed.
+func (s *serverPrinter) printAddr(w io.Writer, addr netip.Addr, host string) error {
+	if !(s.includeIPv4 && addr.Is4()) && !(s.includeIPv6 && addr.Is6()) {
+		return nil
+	}
+
+	line := addr.String()
+	if s.annotate {
+		line = strings.Join([]string{line, s.record, normalizeDomain(host)}, " ")
+	}
+
+	if s.printed[line] {
+		return nil
+	}
+	s.printed[line] = true
+
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// addrRange is an inclusive range of IP addresses of a single family.
+type addrRange struct {
+	first netip.Addr
+	last  netip.Addr
+}
+
+// prefixRange returns the range of addresses covered by a prefix.
+func prefixRange(prefix netip.Prefix) addrRange {
+	prefix = prefix.Masked()
+	return addrRange{first: prefix.Addr(), last: cidrex.LastAddr(prefix)}
+}
+
+// rangeSet is a set of IP addresses backed by a cidrex.Set, which also keeps
+// the addresses as a sorted list of disjoint, non-adjacent ranges for
+// subtraction. The ranges are rebuilt by normalize, which subtract and empty
+// call when prefixes were added since, so that adding many prefixes in a row
+// only rebuilds them once. Call normalize before reading the ranges directly.
+type rangeSet struct {
+	set    cidrex.Set
+	ranges []addrRange
+	dirty  bool
+}
+
+// addPrefix adds all addresses of a prefix to the set.
+func (s *rangeSet) addPrefix(prefix netip.Prefix) {
+	s.set.Add(prefix)
+	s.dirty = true
+}
+
+// normalize rebuilds the ranges from the prefixes of the set, merging those
+// that overlap or are adjacent.
+func (s *rangeSet) normalize() {
+	s.ranges = s.ranges[:0]
+	s.dirty = false
+
+	// Prefixes come in ascending order, each before those it contains
+	for prefix := range s.set.All() {
+		r := prefixRange(prefix)
+
+		if n := len(s.ranges); n > 0 {
+			cur := &s.ranges[n-1]
+
+			if cur.first.BitLen() == r.first.BitLen() && (r.first.Compare(cur.last) <= 0 || r.first == cur.last.Next()) {
+				if r.last.Compare(cur.last) > 0 {
+					cur.last = r.last
+				}
+				continue
+			}
+		}
+
+		s.ranges = append(s.ranges, r)
+	}
+}
+
+// empty reports whether the set contains no addresses.
+func (s *rangeSet) empty() bool {
+	if s.dirty {
+		s.normalize()
+	}
+
+	return len(s.ranges) == 0
+}
+
+// contains reports whether addr is in the set.
+func (s *rangeSet) contains(addr netip.Addr) bool {
+	return s.set.Contains(addr)
+}
+
+// subtract returns the parts of r that are not in the set, in ascending order.
+func (s *rangeSet) subtract(r addrRange) []addrRange {
+	if s.dirty {
+		s.normalize()
+	}
+
+	// Find the first range that ends at or after the start of r
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].last.Compare(r.first) >= 0
+	})
+
+	var parts []addrRange
+	cur := r.first
+
+	for ; i < len(s.ranges) && s.ranges[i].first.Compare(r.last) <= 0; i++ {
+		hole := s.ranges[i]
+
+		if hole.first.Compare(cur) > 0 {
+			parts = append(parts, addrRange{first: cur, last: hole.first.Prev()})
+		}
+
+		// Next returns the zero Addr past the end of the address space
+		cur = hole.last.Next()
+		if !cur.IsValid() || cur.Compare(r.last) > 0 {
+			return parts
+		}
+	}
+
+	return append(parts, addrRange{first: cur, last: r.last})
+}
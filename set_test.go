@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+)
+
+// newTestRangeSet returns a normalized rangeSet of the given prefixes.
+func newTestRangeSet(prefixes ...string) *rangeSet {
+	var s rangeSet
+	for _, p := range prefixes {
+		s.addPrefix(netip.MustParsePrefix(p))
+	}
+	s.normalize()
+
+	return &s
+}
+
+// formatRanges formats ranges as first-last pairs.
+func formatRanges(ranges []addrRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.first.String() + "-" + r.last.String()
+	}
+
+	return fmt.Sprint(parts)
+}
+
+func TestRangeSetNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     string
+	}{
+		{"empty", nil, "[]"},
+		{"adjacent", []string{"10.0.1.0/24", "10.0.0.0/24"}, "[10.0.0.0-10.0.1.255]"},
+		{"contained", []string{"10.0.0.0/8", "10.1.0.0/16"}, "[10.0.0.0-10.255.255.255]"},
+		{"disjoint", []string{"10.0.0.0/24", "10.0.2.0/24"}, "[10.0.0.0-10.0.0.255 10.0.2.0-10.0.2.255]"},
+		{"families", []string{"255.255.255.255/32", "::/128"}, "[255.255.255.255-255.255.255.255 ::-::]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestRangeSet(tt.prefixes...)
+			if got := formatRanges(s.ranges); got != tt.want || s.empty() != (tt.want == "[]") {
+				t.Errorf("ranges = %s, empty = %t, want %s", got, s.empty(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeSetSubtract(t *testing.T) {
+	set := newTestRangeSet("10.0.0.0/24", "10.0.2.0/24", "255.255.255.0/24")
+
+	tests := []struct {
+		from string
+		want string
+	}{
+		{"10.0.0.0/22", "[10.0.1.0-10.0.1.255 10.0.3.0-10.0.3.255]"},
+		{"10.0.0.0/24", "[]"},
+		{"10.0.0.128/25", "[]"},
+		{"10.0.1.0/24", "[10.0.1.0-10.0.1.255]"},
+		{"9.255.254.0/23", "[9.255.254.0-9.255.255.255]"},
+		{"255.255.0.0/16", "[255.255.0.0-255.255.254.255]"},
+		{"2001:db8::/32", "[2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			got := formatRanges(set.subtract(prefixRange(netip.MustParsePrefix(tt.from))))
+			if got != tt.want {
+				t.Errorf("subtract(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreePrefixes(t *testing.T) {
+	set := newTestRangeSet("10.0.0.0/26", "10.0.0.128/27")
+
+	tests := []struct {
+		supernet string
+		maxBits  int
+		want     string
+	}{
+		{"10.0.0.0/24", 32, "[10.0.0.64/26 10.0.0.160/27 10.0.0.192/26]"},
+		{"10.0.0.0/24", 26, "[10.0.0.64/26 10.0.0.192/26]"},
+		{"10.0.0.0/24", 24, "[]"},
+		{"10.0.0.0/26", 32, "[]"},
+		{"10.0.1.0/24", 24, "[10.0.1.0/24]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.supernet, " ", tt.maxBits), func(t *testing.T) {
+			got := fmt.Sprint(freePrefixes(set, netip.MustParsePrefix(tt.supernet), tt.maxBits))
+			if got != tt.want {
+				t.Errorf("freePrefixes(%s, %d) = %s, want %s", tt.supernet, tt.maxBits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateBlock(t *testing.T) {
+	set := newTestRangeSet("10.0.0.0/26", "10.0.0.128/27")
+	supernet := netip.MustParsePrefix("10.0.0.0/24")
+
+	tests := []struct {
+		bits    int
+		bestFit bool
+		want    string
+	}{
+		{27, false, "10.0.0.64/27"},
+		{27, true, "10.0.0.160/27"},
+		{26, false, "10.0.0.64/26"},
+		{26, true, "10.0.0.64/26"},
+		{30, true, "10.0.0.160/30"},
+		{25, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.bits, " ", tt.bestFit), func(t *testing.T) {
+			got, ok := allocateBlock(set, supernet, tt.bits, tt.bestFit)
+			if ok != (tt.want != "") || ok && got.String() != tt.want {
+				t.Errorf("allocateBlock(/%d, %t) = %s, %t, want %q", tt.bits, tt.bestFit, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeSetAddAfterSubtract(t *testing.T) {
+	var set rangeSet
+	from := prefixRange(netip.MustParsePrefix("10.0.0.0/30"))
+
+	set.addPrefix(netip.MustParsePrefix("10.0.0.0/32"))
+	if got := formatRanges(set.subtract(from)); got != "[10.0.0.1-10.0.0.3]" {
+		t.Fatalf("subtract = %s", got)
+	}
+
+	set.addPrefix(netip.MustParsePrefix("10.0.0.2/31"))
+	if got := formatRanges(set.subtract(from)); got != "[10.0.0.1-10.0.0.1]" {
+		t.Errorf("subtract after adding = %s", got)
+	}
+}
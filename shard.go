@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// shard selects the addresses of one of count disjoint shards, numbered from 1.
+// Addresses are assigned to shards by a hash of their value only, so that
+// invocations given the same addresses agree on the shards regardless of how
+// the input is ordered or split across files.
+type shard struct {
+	index uint64
+	count uint64
+}
+
+// parseShard parses a shard in the "i/n" form, such as "3/10".
+func parseShard(s string) (*shard, error) {
+	is, ns, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid shard: %s: expected i/n", s)
+	}
+
+	i, err := strconv.ParseUint(is, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard: %s: expected i/n", s)
+	}
+
+	n, err := strconv.ParseUint(ns, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard: %s: expected i/n", s)
+	}
+
+	if n == 0 || i == 0 || i > n {
+		return nil, fmt.Errorf("invalid shard: %s: i must be between 1 and n", s)
+	}
+
+	return &shard{index: i - 1, count: n}, nil
+}
+
+// contains reports whether addr belongs to the shard. The zone is ignored.
+//
+// The hash must not change between versions, since invocations on different
+// machines rely on it to agree on the shards.
+func (s *shard) contains(addr netip.Addr) bool {
+	b := addr.Unmap().As16()
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	return mix64(hi^mix64(lo))%s.count == s.index
+}
+
+// mix64 is the finalizer of the SplitMix64 generator, which scatters the bits
+// of x over the whole result.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// newShiftCmd creates the shift subcommand.
+func newShiftCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shift OFFSET [entry...]",
+		Short: "Offset IP addresses and CIDR ranges by a number of addresses",
+		Long: "Offset IP addresses and CIDR ranges by a number of addresses.\n\n" +
+			"The offset is a decimal or 0x-prefixed hexadecimal number, optionally signed.\n" +
+			"Negative offsets must follow '--' so they are not mistaken for flags.\n" +
+			"If no entry is given, entries are read from stdin. A shifted range is printed\n" +
+			"as a single CIDR when aligned, and as the minimal list of CIDRs otherwise.",
+		Example: "  cidrex shift +256 10.0.0.0/24\n" +
+			"  cidrex shift -- -1 10.0.1.0\n" +
+			"  cidrex shift 0x10000 2001:db8::/112\n" +
+			"  cat input.txt | cidrex shift 1024",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runShift(args[0], args[1:])
+		},
+	}
+
+	return cmd
+}
+
+// runShift offsets each entry by the given offset and prints the results.
+func runShift(offset string, args []string) error {
+	n, ok := new(big.Int).SetString(offset, 0)
+	if !ok {
+		return fmt.Errorf("invalid offset: %s", offset)
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	errs := newTextReporter()
+	err := forEachEntry(args, os.Stdin, func(entry string) error {
+		return shiftEntry(writer, errs, entry, n)
+	})
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return errs.status()
+}
+
+// shiftEntry offsets a single entry by n and prints the result. Invalid
+// entries and those shifted outside of the address family are reported to
+// errs and skipped.
+func shiftEntry(w io.Writer, errs *errorReporter, entry string, n *big.Int) error {
+	t, err := parseEntry(entry)
+	if err != nil {
+		errs.invalid("", 0, entry, entry, err)
+		return nil
+	}
+
+	for _, prefix := range t.prefixes {
+		if err := shiftPrefix(w, prefix, t.zone, n); err != nil {
+			if errors.Is(err, cidrex.ErrOutOfRange) {
+				errs.invalid("", 0, entry, entry, fmt.Errorf("shifted by %s: %w", n, err))
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shiftPrefix offsets a single prefix by n and prints the result. Single
+// addresses are printed without prefix length.
+func shiftPrefix(w io.Writer, prefix netip.Prefix, zone string, n *big.Int) error {
+	if prefix.IsSingleIP() {
+		addr, err := cidrex.Shift(prefix.Addr().WithZone(zone), n)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, addr)
+		return err
+	}
+
+	shifted, err := cidrex.ShiftPrefix(prefix, n)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range shifted {
+		if err := printPrefix(w, p, zone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultSPFDepth is the default number of nested include and redirect
+// mechanisms followed, which is the lookup limit of RFC 7208.
+const defaultSPFDepth = 10
+
+// spfOptions holds the command-line options of the spf command.
+type spfOptions struct {
+	ipv4      bool
+	ipv6      bool
+	expand    bool
+	maxDepth  int
+	resolvers []string
+	timeout   time.Duration
+}
+
+// newSPFCmd creates the spf subcommand.
+func newSPFCmd() *cobra.Command {
+	opts := &spfOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "spf DOMAIN...",
+		Short: "Print the ranges allowed to send mail by SPF records",
+		Long: "Print the ranges allowed to send mail for domains by their SPF records,\n" +
+			"following their include and redirect mechanisms and resolving their a and mx\n" +
+			"mechanisms.\n\n" +
+			"Only the mechanisms that allow mail count: those qualified with -, ~ or ? are\n" +
+			"skipped, and so are the ptr and exists mechanisms and those using macros,\n" +
+			"which cannot be turned into ranges.",
+		Example: "  cidrex spf example.com\n" +
+			"  cidrex spf -4 --expand example.com",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runSPF(opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 ranges")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 ranges")
+	flags.BoolVarP(&opts.expand, "expand", "e", false, "Print every address instead of the ranges")
+	flags.IntVar(&opts.maxDepth, "max-depth", defaultSPFDepth, "Number of nested include and redirect mechanisms followed")
+	flags.StringSliceVar(&opts.resolvers, "resolvers", nil, "DNS servers to query, e.g. 1.1.1.1,8.8.8.8:53 (default: the system resolver)")
+	flags.DurationVar(&opts.timeout, "dns-timeout", defaultDNSTimeout, "Time allowed for each DNS query")
+
+	return cmd
+}
+
+// runSPF prints the ranges of the SPF record of each domain.
+func runSPF(opts *spfOptions, args []string) error {
+	if opts.maxDepth < 0 {
+		return fmt.Errorf("invalid SPF depth: %d", opts.maxDepth)
+	}
+
+	for _, arg := range args {
+		if !isHostname(arg) {
+			return fmt.Errorf("invalid domain: %s", arg)
+		}
+	}
+
+	dns, err := newDNSResolver(opts.resolvers, opts.timeout)
+	if err != nil {
+		return err
+	}
+
+	s := &spfResolver{dns: dns, maxDepth: opts.maxDepth, seen: make(map[netip.Prefix]bool), visited: make(map[string]bool)}
+	for _, domain := range args {
+		if err := s.resolve(domain, 0); err != nil {
+			return err
+		}
+	}
+
+	includeIPv4 := opts.ipv4 || !opts.ipv4 && !opts.ipv6
+	includeIPv6 := opts.ipv6 || !opts.ipv4 && !opts.ipv6
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+	for _, prefix := range s.prefixes {
+		if !(includeIPv4 && prefix.Addr().Is4()) && !(includeIPv6 && prefix.Addr().Is6()) {
+			continue
+		}
+
+		var err error
+		switch {
+		case opts.expand:
+			err = printAddrs(writer, prefix)
+		case prefix.IsSingleIP():
+			_, err = fmt.Fprintln(writer, prefix.Addr())
+		default:
+			_, err = fmt.Fprintln(writer, prefix)
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// spfResolver collects the ranges allowed by SPF records, in the order they
+// are found and without duplicates.
+type spfResolver struct {
+	dns      *dnsResolver
+	maxDepth int
+	prefixes []netip.Prefix
+	seen     map[netip.Prefix]bool
+
+	// visited holds the domains whose records were read
+	visited map[string]bool
+}
+
+// resolve collects the ranges of the SPF record of domain, found at the given
+// depth of nested include and redirect mechanisms. Only the record of a
+// domain given on the command line is required to exist; the problems of
+// nested records are reported on stderr and their ranges skipped.
+func (s *spfResolver) resolve(domain string, depth int) error {
+	s.visited[normalizeDomain(domain)] = true
+
+	record, err := s.record(domain)
+	if err != nil {
+		if depth == 0 {
+			return err
+		}
+		slog.Warn("unable to read nested SPF record", "domain", domain, "error", err)
+		return nil
+	}
+
+	var redirect string
+	hasAll := false
+	for _, term := range strings.Fields(record)[1:] {
+		if name, value, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+			if strings.EqualFold(name, "redirect") {
+				redirect = value
+			}
+			continue
+		}
+
+		qualifier := term[0]
+		if strings.IndexByte("+-~?", qualifier) >= 0 {
+			term = term[1:]
+		} else {
+			qualifier = '+'
+		}
+
+		// The name of a mechanism is followed by its argument after a colon,
+		// or by prefix lengths as in a/24
+		name, arg := term, ""
+		if i := strings.IndexAny(term, ":/"); i >= 0 {
+			name, arg = term[:i], strings.TrimPrefix(term[i:], ":")
+		}
+		if strings.EqualFold(name, "all") {
+			hasAll = true
+		}
+		if qualifier != '+' {
+			continue
+		}
+
+		if strings.Contains(arg, "%") {
+			slog.Warn("skipping SPF term: macros are not supported", "term", term, "domain", domain)
+			continue
+		}
+
+		if err := s.mechanism(domain, strings.ToLower(name), arg, depth); err != nil {
+			slog.Warn("skipping SPF term", "term", term, "domain", domain, "error", err)
+		}
+	}
+
+	// A redirect is only used by records that do not end with all
+	if redirect != "" && !hasAll {
+		if err := s.nest(redirect, depth); err != nil {
+			slog.Warn("skipping SPF redirect", "redirect", redirect, "domain", domain, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// record returns the SPF record of domain.
+func (s *spfResolver) record(domain string) (string, error) {
+	records, err := s.dns.txt(domain)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the SPF record of %s: %w", domain, err)
+	}
+
+	var spf []string
+	for _, record := range records {
+		version, _, _ := strings.Cut(record, " ")
+		if strings.EqualFold(version, "v=spf1") {
+			spf = append(spf, record)
+		}
+	}
+
+	switch len(spf) {
+	case 0:
+		return "", fmt.Errorf("%s has no SPF record", domain)
+	case 1:
+		return spf[0], nil
+	default:
+		return "", fmt.Errorf("%s has %d SPF records", domain, len(spf))
+	}
+}
+
+// mechanism collects the ranges allowed by a mechanism of the SPF record of
+// domain, written as name:arg.
+func (s *spfResolver) mechanism(domain, name, arg string, depth int) error {
+	switch name {
+	case "ip4", "ip6":
+		prefix, err := parseSPFNetwork(arg, name == "ip6")
+		if err != nil {
+			return err
+		}
+		s.add(prefix)
+
+	case "a", "mx":
+		target, bits4, bits6, err := parseSPFDualCIDR(arg)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			target = domain
+		}
+
+		hosts := []string{target}
+		if name == "mx" {
+			if hosts, err = s.dns.mx(target); err != nil {
+				return err
+			}
+		}
+
+		for _, host := range hosts {
+			addrs, err := s.dns.resolve(host)
+			if err != nil {
+				return fmt.Errorf("unable to resolve %s: %w", host, err)
+			}
+
+			for _, addr := range addrs {
+				bits := bits6
+				if addr.Is4() {
+					bits = bits4
+				}
+				s.add(netip.PrefixFrom(addr, bits).Masked())
+			}
+		}
+
+	case "include":
+		if arg == "" {
+			return fmt.Errorf("missing domain")
+		}
+		return s.nest(arg, depth)
+
+	case "all":
+
+	case "ptr", "exists":
+		return fmt.Errorf("%s mechanisms cannot be turned into ranges", name)
+
+	default:
+		return fmt.Errorf("unknown mechanism")
+	}
+
+	return nil
+}
+
+// nest collects the ranges of the SPF record of target, included or
+// redirected to at the given depth. Records already visited are skipped,
+// since their ranges were collected.
+func (s *spfResolver) nest(target string, depth int) error {
+	if s.visited[normalizeDomain(target)] {
+		return nil
+	}
+	if depth >= s.maxDepth {
+		return fmt.Errorf("more than %d nested records, see --max-depth", s.maxDepth)
+	}
+
+	return s.resolve(target, depth+1)
+}
+
+// add collects a range, unless it was already found.
+func (s *spfResolver) add(prefix netip.Prefix) {
+	if !s.seen[prefix] {
+		s.seen[prefix] = true
+		s.prefixes = append(s.prefixes, prefix)
+	}
+}
+
+// parseSPFNetwork parses the network of an ip4 or ip6 mechanism, an address
+// optionally followed by a prefix length.
+func parseSPFNetwork(s string, ipv6 bool) (netip.Prefix, error) {
+	addrPart, bitsPart, hasBits := strings.Cut(s, "/")
+
+	addr, err := netip.ParseAddr(addrPart)
+	if err != nil || addr.Is6() != ipv6 || addr.Zone() != "" {
+		return netip.Prefix{}, fmt.Errorf("invalid network")
+	}
+
+	bits := addr.BitLen()
+	if hasBits {
+		if bits, err = parseSPFLength(bitsPart, addr.BitLen()); err != nil {
+			return netip.Prefix{}, err
+		}
+	}
+
+	return netip.PrefixFrom(addr, bits).Masked(), nil
+}
+
+// parseSPFDualCIDR parses the argument of an a or mx mechanism: an optional
+// domain, followed by optional IPv4 and IPv6 prefix lengths applied to the
+// addresses found, as in example.com/24//64.
+func parseSPFDualCIDR(s string) (domain string, bits4 int, bits6 int, err error) {
+	bits4, bits6 = 32, 128
+
+	domain, lengths, _ := strings.Cut(s, "/")
+	if lengths == "" {
+		return domain, bits4, bits6, nil
+	}
+
+	part4, part6, hasPart6 := strings.Cut(lengths, "//")
+	if strings.HasPrefix(lengths, "/") {
+		part4, part6, hasPart6 = "", lengths[1:], true
+	}
+
+	if part4 != "" {
+		if bits4, err = parseSPFLength(part4, 32); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	if hasPart6 {
+		if bits6, err = parseSPFLength(part6, 128); err != nil {
+			return "", 0, 0, err
+		}
+	}
+
+	return domain, bits4, bits6, nil
+}
+
+// parseSPFLength parses a prefix length of at most limit.
+func parseSPFLength(s string, limit int) (int, error) {
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 0 || bits > limit {
+		return 0, fmt.Errorf("invalid prefix length: %s", s)
+	}
+
+	return bits, nil
+}
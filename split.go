@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Ways of dealing records across the --split-files outputs.
+const (
+	splitRoundRobin = "round-robin"
+	splitContiguous = "contiguous"
+)
+
+// defaultSplitPrefix is the prefix of the files written by --split-files.
+const defaultSplitPrefix = "split-"
+
+// splitFormatter deals records across several output files, each a complete
+// document formatted by inner. In round-robin mode, record i goes to file
+// i mod n. In contiguous mode, the records are cut into n runs of nearly
+// equal size, which requires their total number up front.
+type splitFormatter struct {
+	inner   formatter
+	files   []*os.File
+	writers []*bufio.Writer
+
+	// total is the number of records in contiguous mode, 0 in round-robin
+	// mode. count is the number of records written so far.
+	total uint64
+	count uint64
+}
+
+// newSplitFormatter creates a splitFormatter writing records formatted by
+// inner to n files named prefix followed by their number. A total of 0 selects
+// round-robin mode.
+func newSplitFormatter(inner formatter, n int, prefix string, total uint64) (*splitFormatter, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of split files: %d", n)
+	}
+
+	// Formats that are written at the end cannot be split
+	if _, ok := inner.(footerWriter); ok {
+		return nil, fmt.Errorf("output format cannot be used with --split-files")
+	}
+
+	f := &splitFormatter{inner: inner, total: total}
+
+	width := len(strconv.Itoa(n - 1))
+	for i := 0; i < n; i++ {
+		file, err := os.Create(fmt.Sprintf("%s%0*d", prefix, width, i))
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+
+		w := bufio.NewWriterSize(file, defaultBufferSize)
+		f.files = append(f.files, file)
+		f.writers = append(f.writers, w)
+
+		if header, ok := inner.(headerWriter); ok {
+			if err := header.writeHeader(w); err != nil {
+				f.close()
+				return nil, err
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func (f *splitFormatter) write(_ io.Writer, rec record) error {
+	n := uint64(len(f.writers))
+
+	i := f.count % n
+	if f.total > 0 {
+		i = min(f.count*n/f.total, n-1)
+	}
+	f.count++
+
+	return f.inner.write(f.writers[i], rec)
+}
+
+// writeFooter flushes and closes the files.
+func (f *splitFormatter) writeFooter(_ io.Writer) error {
+	var err error
+	for _, w := range f.writers {
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+
+	if closeErr := f.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// close closes the files.
+func (f *splitFormatter) close() error {
+	var err error
+	for _, file := range f.files {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// countRecords returns the number of records that expanding args with opts
+// writes, by expanding them once as text and counting the lines. Name
+// lookups and feeds are cached, so the second run sees the same input.
+func countRecords(opts *expandOptions, args []string) (uint64, error) {
+	counting := *opts
+	counting.output = "text"
+	counting.splitFiles = 0
+	counting.groupBy = ""
+	counting.errors = "text"
+	counting.quiet = true
+
+	counter := &lineCounter{}
+	if err := expandTo(&counting, args, counter); err != nil && !isInvalidInput(err) {
+		return 0, err
+	}
+
+	return counter.lines, nil
+}
+
+// lineCounter is a writer counting the lines written to it.
+type lineCounter struct {
+	lines uint64
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += uint64(bytes.Count(p, []byte{'\n'}))
+	return len(p), nil
+}
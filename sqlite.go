@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+
+	_ "modernc.org/sqlite"
+)
+
+// defaultTable is the name of the table records are inserted into by the
+// database outputs.
+const defaultTable = "targets"
+
+// sqliteBatchSize is the number of rows inserted per transaction.
+const sqliteBatchSize = 10000
+
+// identifierRegex matches table and column names that can be used in SQL
+// statements without further checks.
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqliteFormatter inserts records into a table of an SQLite database, which is
+// created if needed. Rows are inserted with a prepared statement in batches of
+// sqliteBatchSize per transaction.
+type sqliteFormatter struct {
+	db      *sql.DB
+	insert  *sql.Stmt
+	tx      *sql.Tx
+	stmt    *sql.Stmt
+	pending int
+	tag     string
+}
+
+// newSQLiteFormatter opens the SQLite database at path and creates the table
+// if it does not exist.
+func newSQLiteFormatter(path string, opts formatOptions) (*sqliteFormatter, error) {
+	table := opts.table
+	if table == "" {
+		table = defaultTable
+	}
+
+	if !identifierRegex.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database %s: %w", path, err)
+	}
+
+	create := `CREATE TABLE IF NOT EXISTS "` + table + `" (
+		ip TEXT NOT NULL,
+		port INTEGER,
+		source TEXT,
+		"group" TEXT,
+		tag TEXT,
+		annotation TEXT
+	)`
+	if _, err := db.Exec(create); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create table %s: %w", table, err)
+	}
+
+	insert, err := db.Prepare(`INSERT INTO "` + table + `" (ip, port, source, "group", tag, annotation) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to prepare insert: %w", err)
+	}
+
+	return &sqliteFormatter{db: db, insert: insert, tag: opts.tag}, nil
+}
+
+func (f *sqliteFormatter) write(_ io.Writer, rec record) error {
+	if f.tx == nil {
+		tx, err := f.db.Begin()
+		if err != nil {
+			return fmt.Errorf("unable to begin transaction: %w", err)
+		}
+		f.tx, f.stmt = tx, tx.Stmt(f.insert)
+	}
+
+	// Fields that were not requested are stored as NULL
+	var port, source, group, tag, annotation any
+	if rec.port != 0 {
+		port = rec.port
+	}
+	if rec.source != "" {
+		source = rec.source
+	}
+	if rec.group.IsValid() {
+		group = rec.group.String()
+	}
+	if f.tag != "" {
+		tag = f.tag
+	}
+	if rec.annotation != "" {
+		annotation = rec.annotation
+	}
+
+	if _, err := f.stmt.Exec(rec.addr.String(), port, source, group, tag, annotation); err != nil {
+		return fmt.Errorf("unable to insert %s: %w", rec.addr, err)
+	}
+
+	f.pending++
+	if f.pending >= sqliteBatchSize {
+		return f.commit()
+	}
+
+	return nil
+}
+
+// commit commits the current transaction, if any.
+func (f *sqliteFormatter) commit() error {
+	if f.tx == nil {
+		return nil
+	}
+
+	err := f.tx.Commit()
+	f.tx, f.stmt, f.pending = nil, nil, 0
+	if err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// writeFooter commits the remaining rows and closes the database.
+func (f *sqliteFormatter) writeFooter(_ io.Writer) error {
+	err := f.commit()
+
+	f.insert.Close()
+	if closeErr := f.db.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("unable to close database: %w", closeErr)
+	}
+
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// subnetOptions holds the command-line options of the subnet command.
+type subnetOptions struct {
+	prefix string
+	nibble bool
+	zones  bool
+}
+
+// newSubnetCmd creates the subnet subcommand.
+func newSubnetCmd() *cobra.Command {
+	opts := &subnetOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "subnet [entry...]",
+		Short: "Split CIDR ranges into subnets of a given length",
+		Long: "Split CIDR ranges into subnets of a given length.\n\n" +
+			"If no entry is given, entries are read from stdin. With --nibble, subnet\n" +
+			"lengths must fall on the boundaries of reverse DNS delegation: nibbles (4\n" +
+			"bits) for IPv6, and octets for IPv4. --zones prints the name of the reverse\n" +
+			"zone of each subnet after it, and implies --nibble.",
+		Example: "  cidrex subnet -P 26 10.0.0.0/24\n" +
+			"  cidrex subnet --nibble -P ,52 2001:db8::/48\n" +
+			"  cidrex subnet --zones -P ,64 2001:db8::/60",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runSubnet(opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.prefix, "prefix", "P", "24", "Length of the subnets, e.g. 24 or 24,64 for IPv6")
+	cmd.Flags().BoolVar(&opts.nibble, "nibble", false, "Only split on nibble boundaries for IPv6 and octet boundaries for IPv4")
+	cmd.Flags().BoolVar(&opts.zones, "zones", false, "Print the reverse DNS zone of each subnet after it")
+
+	return cmd
+}
+
+// runSubnet splits each entry into subnets and prints them.
+func runSubnet(opts *subnetOptions, args []string) error {
+	groups, err := parseGroupBy(opts.prefix)
+	if err != nil {
+		return err
+	}
+
+	if opts.nibble || opts.zones {
+		if groups.bits4%8 != 0 || groups.bits6%4 != 0 {
+			return fmt.Errorf("subnet lengths must be a multiple of 8 for IPv4 and of 4 for IPv6: %s", opts.prefix)
+		}
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	errs := newTextReporter()
+	err = forEachEntry(args, os.Stdin, func(entry string) error {
+		return subnetEntry(writer, errs, entry, groups, opts.zones)
+	})
+
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return errs.status()
+}
+
+// subnetEntry prints the subnets of a single entry, with their reverse zone if
+// zones is set. Invalid entries are reported to errs, and prefixes smaller than
+// the subnets on stderr.
+func subnetEntry(w io.Writer, errs *errorReporter, entry string, groups *grouping, zones bool) error {
+	t, err := parseEntry(entry)
+	if err != nil {
+		errs.invalid("", 0, entry, entry, err)
+		return nil
+	}
+
+	for _, prefix := range t.prefixes {
+		bits := groups.group(prefix.Addr()).Bits()
+		if prefix.Bits() > bits {
+			slog.Warn("prefix smaller than the subnets, skipped", "entry", entry, "prefix", prefix, "bits", bits)
+			continue
+		}
+
+		for subnet := range cidrex.Subnets(prefix, bits) {
+			if err := printSubnet(w, subnet, t.zone, zones); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// printSubnet prints a subnet like printPrefix, followed by the name of its
+// reverse zone if zones is set.
+func printSubnet(w io.Writer, subnet netip.Prefix, zone string, zones bool) error {
+	if !zones {
+		return printPrefix(w, subnet, zone)
+	}
+
+	name, err := cidrex.ReverseZone(subnet)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s %s\n", subnet, name)
+	return err
+}
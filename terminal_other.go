@@ -0,0 +1,24 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// tuiSupported tells whether --tui can drive terminals on this platform.
+const tuiSupported = false
+
+// terminalSize cannot find out the size of terminals on this platform.
+func terminalSize(_ *os.File) (rows, cols int) {
+	return 0, 0
+}
+
+// makeRaw is not supported on this platform.
+func makeRaw(_ *os.File) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
+
+// notifyResize is not supported on this platform.
+func notifyResize(_ chan<- os.Signal) {}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// terraformOptions holds the command-line options of the terraform command.
+type terraformOptions struct {
+	ipv4   bool
+	ipv6   bool
+	expand bool
+}
+
+// newTerraformCmd creates the terraform subcommand.
+func newTerraformCmd() *cobra.Command {
+	opts := &terraformOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "terraform [file...]",
+		Short: "Print the ranges and addresses found in Terraform states and plans",
+		Long: "Print the ranges and addresses found in the attributes of the resources of\n" +
+			"Terraform states and plans in JSON, such as cidr_block, address_prefix,\n" +
+			"public_ip or private_ip.\n\n" +
+			"Plans are read from the output of terraform show -json, keeping the planned\n" +
+			"values. The 0.0.0.0/0 and ::/0 ranges of firewall rules are skipped.\n\n" +
+			"If no file is provided, input is read from stdin.",
+		Example: "  cidrex terraform terraform.tfstate\n" +
+			"  terraform show -json plan.out | cidrex terraform -4",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runTerraform(opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.ipv4, "ipv4", "4", false, "Print only IPv4 ranges")
+	flags.BoolVarP(&opts.ipv6, "ipv6", "6", false, "Print only IPv6 ranges")
+	flags.BoolVarP(&opts.expand, "expand", "e", false, "Print every address instead of the ranges")
+
+	return cmd
+}
+
+// runTerraform prints the ranges found in each Terraform file, once each.
+func runTerraform(opts *terraformOptions, args []string) error {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+
+	found := &tfRanges{seen: make(map[netip.Prefix]bool)}
+	for _, name := range args {
+		if err := found.readFile(name); err != nil {
+			return err
+		}
+	}
+
+	includeIPv4 := opts.ipv4 || !opts.ipv4 && !opts.ipv6
+	includeIPv6 := opts.ipv6 || !opts.ipv4 && !opts.ipv6
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+	for _, prefix := range found.prefixes {
+		if !(includeIPv4 && prefix.Addr().Is4()) && !(includeIPv6 && prefix.Addr().Is6()) {
+			continue
+		}
+
+		var err error
+		if opts.expand {
+			err = printAddrs(writer, prefix)
+		} else {
+			err = printPrefix(writer, prefix, "")
+		}
+		if err != nil {
+			writer.Close()
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// tfRanges collects the ranges found in Terraform files, in the order they
+// appear and without duplicates.
+type tfRanges struct {
+	prefixes []netip.Prefix
+	seen     map[netip.Prefix]bool
+}
+
+// readFile reads the named Terraform file, or stdin for "-".
+func (r *tfRanges) readFile(name string) error {
+	if name == "-" {
+		if err := r.read(os.Stdin); err != nil {
+			return fmt.Errorf("unable to read Terraform JSON from stdin: %w", err)
+		}
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("unable to open input file: %w", err)
+	}
+	defer file.Close()
+
+	if err := r.read(file); err != nil {
+		return fmt.Errorf("unable to read Terraform JSON from %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// read walks a Terraform state or plan, collecting the values of address
+// attributes. The document is read as a stream of tokens, rather than decoded
+// into maps, so that values are found in the order they appear.
+func (r *tfRanges) read(reader io.Reader) error {
+	dec := json.NewDecoder(reader)
+	if err := r.walk(dec, ""); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the JSON document")
+	}
+
+	return nil
+}
+
+// walk reads the next value of dec, the value of the attribute key. The
+// elements of arrays are values of the key of the array.
+func (r *tfRanges) walk(dec *json.Decoder, key string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			for dec.More() {
+				name, err := dec.Token()
+				if err != nil {
+					return err
+				}
+
+				// Plans hold the values before the changes too, which are
+				// left out for their planned values
+				if tfSkippedKeys[name.(string)] {
+					var skipped json.RawMessage
+					if err := dec.Decode(&skipped); err != nil {
+						return err
+					}
+					continue
+				}
+
+				if err := r.walk(dec, name.(string)); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for dec.More() {
+				if err := r.walk(dec, key); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Consume the closing delimiter
+		_, err = dec.Token()
+		return err
+
+	case string:
+		if isTFAddressKey(key) {
+			r.add(token)
+		}
+	}
+
+	return nil
+}
+
+// tfSkippedKeys are the attributes of plans holding the state before the
+// planned changes.
+var tfSkippedKeys = map[string]bool{"prior_state": true, "before": true, "before_sensitive": true}
+
+// isTFAddressKey reports whether an attribute holds ranges or addresses, such
+// as the cidr_block of an AWS VPC, the address_prefixes of an Azure subnet or
+// the private_ip of an instance.
+func isTFAddressKey(key string) bool {
+	for _, suffix := range []string{"cidr_block", "cidr_blocks", "cidr_range", "address_prefix", "address_prefixes", "address_space", "ip_address", "ip_addresses", "_ip", "_ips", "ipv6_address", "ipv6_addresses"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return key == "address" || key == "addresses"
+}
+
+// add collects the value of an address attribute if it is a range or an
+// address. Values that are neither, such as the names held by some address
+// attributes, are skipped, and so are the default routes of firewall rules
+// and unspecified addresses.
+func (r *tfRanges) add(value string) {
+	var prefix netip.Prefix
+	if strings.Contains(value, "/") {
+		p, err := netip.ParsePrefix(value)
+		if err != nil || p.Bits() == 0 {
+			return
+		}
+		prefix = p.Masked()
+	} else {
+		addr, err := netip.ParseAddr(value)
+		if err != nil || addr.Zone() != "" || addr.IsUnspecified() {
+			return
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	if !r.seen[prefix] {
+		r.seen[prefix] = true
+		r.prefixes = append(r.prefixes, prefix)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"os"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+	"github.com/spf13/cobra"
+)
+
+// maxTopSpan bounds the number of prefixes a single input range may be spread
+// over by the top command, as 2 to the power of maxTopSpan.
+const maxTopSpan = 24
+
+// newTopCmd creates the top subcommand.
+func newTopCmd() *cobra.Command {
+	var prefix string
+	var count int
+
+	cmd := &cobra.Command{
+		Use:   "top [filename...]",
+		Short: "Print the prefixes holding the most addresses",
+		Long: "Bin the IP addresses listed in the given files, or in stdin if no file is\n" +
+			"given, into prefixes of a fixed length, and print the most populous ones with\n" +
+			"the number of addresses they hold.\n\n" +
+			"Ranges count for every address they contain.",
+		Example: "  cidrex top --prefix 24 -n 20 ips.txt\n" +
+			"  grep 'Failed password' auth.log | grep -oE '([0-9]+\\.){3}[0-9]+' | cidrex top",
+		Args: cobra.ArbitraryArgs,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if count < 0 {
+				return fmt.Errorf("invalid count: %d", count)
+			}
+
+			return runTop(prefix, count, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&prefix, "prefix", "P", "24", "Length of the prefixes, e.g. 24 or 24,64 for IPv6")
+	cmd.Flags().IntVarP(&count, "count", "n", 10, "Number of prefixes to print (0 for all)")
+
+	return cmd
+}
+
+// runTop prints the count most populous prefixes of the addresses read from
+// files.
+func runTop(spec string, count int, files []string) error {
+	groups, err := parseGroupBy(spec)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	hist := newHistogram(groups, false)
+	errs := newTextReporter()
+
+	err = forEachFileTarget(files, errs, func(t target) error {
+		for _, prefix := range t.prefixes {
+			binPrefix(hist, groups, prefix)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	writer := newOutputWriter(os.Stdout, defaultBufferSize, 0)
+
+	if err := hist.writeTop(writer, count); err != nil {
+		writer.Close()
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return errs.status()
+}
+
+// binPrefix adds the addresses of prefix to the groups they fall into. Ranges
+// spanning more than 2^maxTopSpan groups are reported and skipped.
+func binPrefix(hist *histogram, groups *grouping, prefix netip.Prefix) {
+	group := groups.group(prefix.Addr())
+
+	// The prefix lies within a single group
+	if prefix.Bits() >= group.Bits() {
+		size := uint64(math.MaxUint64)
+		if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits < 64 {
+			size = 1 << hostBits
+		}
+
+		hist.addCount(group, size)
+		return
+	}
+
+	if group.Bits()-prefix.Bits() > maxTopSpan {
+		slog.Warn("prefix spans too many groups, skipped", "prefix", prefix, "bits", group.Bits())
+		return
+	}
+
+	// The prefix spans several groups, which it fills entirely
+	size := uint64(math.MaxUint64)
+	if hostBits := group.Addr().BitLen() - group.Bits(); hostBits < 64 {
+		size = 1 << hostBits
+	}
+
+	last := cidrex.LastAddr(prefix)
+	for {
+		hist.addCount(group, size)
+
+		if cidrex.LastAddr(group) == last {
+			return
+		}
+
+		group, _ = cidrex.NextPrefix(group)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// treeFormatter collects every record and prints them at the end as a single
+// JSON document nesting the input entries, the groups they contain and the
+// addresses in each group, with the number of records at every level.
+type treeFormatter struct {
+	root treeRoot
+
+	// index maps a source and entry to its node in root.Entries
+	index map[treeKey]*treeEntry
+}
+
+// treeKey identifies a top-level node of the tree.
+type treeKey struct {
+	source string
+	entry  string
+}
+
+// treeRoot is the document printed by treeFormatter.
+type treeRoot struct {
+	Tag     string       `json:"tag,omitempty"`
+	Count   int          `json:"count"`
+	Entries []*treeEntry `json:"entries"`
+}
+
+// treeEntry holds the records expanded from an input entry, by group.
+type treeEntry struct {
+	Entry  string       `json:"entry"`
+	Source string       `json:"source,omitempty"`
+	Count  int          `json:"count"`
+	Groups []*treeGroup `json:"groups"`
+
+	// index maps a group to its node in Groups
+	index map[netip.Prefix]*treeGroup
+}
+
+// treeGroup holds the addresses of an input entry within a group.
+type treeGroup struct {
+	Prefix    netip.Prefix `json:"prefix"`
+	Count     int          `json:"count"`
+	Addresses []string     `json:"addresses"`
+}
+
+// newTreeFormatter creates a treeFormatter.
+func newTreeFormatter(opts formatOptions) *treeFormatter {
+	return &treeFormatter{
+		root:  treeRoot{Tag: opts.tag, Entries: []*treeEntry{}},
+		index: make(map[treeKey]*treeEntry),
+	}
+}
+
+func (f *treeFormatter) write(_ io.Writer, rec record) error {
+	key := treeKey{source: rec.source, entry: rec.entry}
+
+	entry, ok := f.index[key]
+	if !ok {
+		entry = &treeEntry{
+			Entry:  rec.entry,
+			Source: rec.source,
+			Groups: []*treeGroup{},
+			index:  make(map[netip.Prefix]*treeGroup),
+		}
+		f.index[key] = entry
+		f.root.Entries = append(f.root.Entries, entry)
+	}
+
+	group, ok := entry.index[rec.group]
+	if !ok {
+		group = &treeGroup{Prefix: rec.group}
+		entry.index[rec.group] = group
+		entry.Groups = append(entry.Groups, group)
+	}
+
+	addr := rec.addr.String()
+	if rec.port != 0 {
+		addr = netip.AddrPortFrom(rec.addr, rec.port).String()
+	}
+
+	group.Addresses = append(group.Addresses, addr)
+	group.Count++
+	entry.Count++
+	f.root.Count++
+
+	return nil
+}
+
+func (f *treeFormatter) writeFooter(w io.Writer) error {
+	data, err := json.Marshal(f.root)
+	if err != nil {
+		return fmt.Errorf("unable to encode tree: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// defaultTerminalCols is the width of the terminal assumed when it cannot be
+// found out.
+const defaultTerminalCols = 80
+
+// tuiHelp is shown in the status line of the viewer.
+const tuiHelp = "/ search  & filter  enter fold  -/+ all  q quit"
+
+// runTUI expands the input into memory, then shows the output in a
+// full-screen viewer on the terminal, unless it fits on a single screen.
+// Addresses are grouped by their enclosing /24 and /64, or by --group-by, for
+// the groups to be folded.
+func runTUI(opts *expandOptions, args []string) error {
+	if !tuiSupported {
+		return fmt.Errorf("--tui is not supported on this platform")
+	}
+	if opts.output != "text" || opts.dbDSN != "" || opts.exec != "" || opts.pipe != "" || opts.splitFiles != 0 {
+		return fmt.Errorf("--tui requires --output text")
+	}
+	if opts.follow || opts.watch {
+		return fmt.Errorf("--tui cannot be combined with --follow or --watch")
+	}
+
+	tuiOpts := *opts
+	defaultGroups := tuiOpts.groupBy == ""
+	if defaultGroups {
+		tuiOpts.groupBy = fmt.Sprintf("%d,%d", defaultGroupBits4, defaultGroupBits6)
+	}
+
+	out := &tuiBuffer{}
+	err := expandTo(&tuiOpts, args, out)
+
+	// The output is still shown when invalid entries were skipped
+	var exit *exitError
+	if err != nil && !errors.As(err, &exit) {
+		return err
+	}
+
+	v := newTUIViewer(out.data)
+	rows, _ := terminalSize(os.Stdout)
+	if rows <= 0 {
+		rows = defaultPagerRows
+	}
+	if len(v.lines) < rows {
+		if writeErr := v.print(os.Stdout, !defaultGroups); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+
+	tty, ttyErr := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if ttyErr != nil {
+		return fmt.Errorf("unable to open the terminal: %w", ttyErr)
+	}
+	defer tty.Close()
+
+	if viewErr := v.run(tty); viewErr != nil {
+		return viewErr
+	}
+
+	return err
+}
+
+// tuiBuffer holds the output shown by the viewer.
+type tuiBuffer struct {
+	data []byte
+}
+
+// Write implements io.Writer.
+func (b *tuiBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// tuiFold is a group of lines, under the header line of the group, that can
+// be folded into the header.
+type tuiFold struct {
+	header int
+	end    int
+	folded bool
+}
+
+// tuiViewer shows lines of output one screen at a time, with a cursor. The
+// lines shown are those of the unfolded groups, and only those holding the
+// filter if one is set.
+type tuiViewer struct {
+	data []byte
+
+	// lines holds the offset of each line in data
+	lines []int
+	folds []tuiFold
+
+	// rows are the lines shown, top is the first one on the screen and
+	// cursor the selected one
+	rows   []int
+	top    int
+	cursor int
+
+	filter     []byte
+	search     []byte
+	searchBack bool
+
+	// prompt is the command being typed in the status line, if any: /, ? or
+	// &, followed by input
+	prompt  byte
+	input   []byte
+	message string
+
+	height int
+	width  int
+}
+
+// newTUIViewer creates a tuiViewer for the output in data. Group headers are
+// the comment lines written by the text output, such as "# 10.0.0.0/24".
+func newTUIViewer(data []byte) *tuiViewer {
+	v := &tuiViewer{data: data}
+
+	for start := 0; start < len(data); {
+		v.lines = append(v.lines, start)
+
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			break
+		}
+		start += end + 1
+	}
+
+	for i := range v.lines {
+		if bytes.HasPrefix(v.line(i), []byte("# ")) {
+			if len(v.folds) > 0 {
+				v.folds[len(v.folds)-1].end = i
+			}
+			v.folds = append(v.folds, tuiFold{header: i})
+		}
+	}
+	if len(v.folds) > 0 {
+		v.folds[len(v.folds)-1].end = len(v.lines)
+	}
+
+	v.rebuild()
+	return v
+}
+
+// line returns the i-th line, without its newline.
+func (v *tuiViewer) line(i int) []byte {
+	end := len(v.data)
+	if i+1 < len(v.lines) {
+		end = v.lines[i+1]
+	}
+
+	return bytes.TrimSuffix(v.data[v.lines[i]:end], []byte("\n"))
+}
+
+// foldOf returns the index of the group line i belongs to, or -1 if it
+// precedes the first group.
+func (v *tuiViewer) foldOf(i int) int {
+	return sort.Search(len(v.folds), func(f int) bool { return v.folds[f].header > i }) - 1
+}
+
+// rebuild computes the rows shown after folding or filtering, keeping the
+// cursor on the same line, or on the next one shown.
+func (v *tuiViewer) rebuild() {
+	current := 0
+	if v.cursor < len(v.rows) {
+		current = v.rows[v.cursor]
+	}
+
+	v.rows = v.rows[:0]
+	next := 0
+	for i := 0; i < len(v.lines); i++ {
+		if next < len(v.folds) && v.folds[next].header == i {
+			fold := v.folds[next]
+			next++
+
+			// Groups without matching lines are left out when filtering
+			if len(v.filter) > 0 && !v.foldMatches(fold) {
+				i = fold.end - 1
+				continue
+			}
+
+			v.rows = append(v.rows, i)
+			if fold.folded {
+				i = fold.end - 1
+			}
+			continue
+		}
+
+		if len(v.filter) == 0 || bytes.Contains(v.line(i), v.filter) {
+			v.rows = append(v.rows, i)
+		}
+	}
+
+	v.cursor = sort.SearchInts(v.rows, current)
+	if v.cursor >= len(v.rows) {
+		v.cursor = max(len(v.rows)-1, 0)
+	}
+}
+
+// foldMatches reports whether a line of the group holds the filter.
+func (v *tuiViewer) foldMatches(fold tuiFold) bool {
+	for i := fold.header + 1; i < fold.end; i++ {
+		if bytes.Contains(v.line(i), v.filter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// print writes the lines to w, without the group headers unless headers is
+// set.
+func (v *tuiViewer) print(w io.Writer, headers bool) error {
+	if headers {
+		_, err := w.Write(v.data)
+		return err
+	}
+
+	start := 0
+	for _, fold := range v.folds {
+		if _, err := w.Write(v.data[v.lines[start]:v.lines[fold.header]]); err != nil {
+			return err
+		}
+		start = fold.header + 1
+	}
+	if start < len(v.lines) {
+		_, err := w.Write(v.data[v.lines[start]:])
+		return err
+	}
+
+	return nil
+}
+
+// run shows the viewer on the terminal tty until it is quit.
+func (v *tuiViewer) run(tty *os.File) error {
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return fmt.Errorf("unable to set up the terminal: %w", err)
+	}
+	defer restore()
+
+	// Use the alternate screen, leaving the terminal as it was on exit
+	io.WriteString(tty, "\x1b[?1049h\x1b[?25l")
+	defer io.WriteString(tty, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(tty, keys)
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	for {
+		v.height, v.width = terminalSize(tty)
+		if v.height <= 1 {
+			v.height = defaultPagerRows
+		}
+		if v.width <= 0 {
+			v.width = defaultTerminalCols
+		}
+
+		v.scroll()
+		if _, err := tty.Write(v.draw()); err != nil {
+			return err
+		}
+
+		select {
+		case key, ok := <-keys:
+			if !ok || v.handle(key) {
+				return nil
+			}
+		case <-resized:
+		}
+	}
+}
+
+// readKeys reads the keys pressed on the terminal, sending escape sequences
+// such as those of the arrow keys as a single key, until reading fails.
+func readKeys(tty io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 256)
+	for {
+		n, err := tty.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for chunk := buf[:n]; len(chunk) > 0; {
+			size := 1
+			if chunk[0] == 0x1b && len(chunk) > 2 && (chunk[1] == '[' || chunk[1] == 'O') {
+				// The sequence ends with its first letter or ~
+				size = 2
+				for size < len(chunk) && (chunk[size] < 0x40 || chunk[size] > 0x7e) {
+					size++
+				}
+				size = min(size+1, len(chunk))
+			} else if chunk[0] >= utf8.RuneSelf {
+				_, size = utf8.DecodeRune(chunk)
+			}
+
+			keys <- string(chunk[:size])
+			chunk = chunk[size:]
+		}
+	}
+}
+
+// handle acts on a key, and reports whether the viewer should be quit.
+func (v *tuiViewer) handle(key string) bool {
+	if v.prompt != 0 {
+		v.edit(key)
+		return false
+	}
+
+	v.message = ""
+	page := v.height - 1
+
+	switch key {
+	case "q", "Q", "\x03":
+		return true
+	case "j", "\x1b[B", "\x1bOB", "\x0e":
+		v.cursor++
+	case "k", "\x1b[A", "\x1bOA", "\x10":
+		v.cursor--
+	case " ", "f", "\x1b[6~", "\x06":
+		v.cursor += page
+		v.top += page
+	case "b", "\x1b[5~", "\x02":
+		v.cursor -= page
+		v.top -= page
+	case "g", "<", "\x1b[H", "\x1bOH", "\x1b[1~":
+		v.cursor = 0
+	case "G", ">", "\x1b[F", "\x1bOF", "\x1b[4~":
+		v.cursor = len(v.rows) - 1
+	case "\r", "\n", "\t":
+		v.toggle()
+	case "-", "+":
+		for i := range v.folds {
+			v.folds[i].folded = key == "-"
+		}
+		v.rebuild()
+	case "/", "?", "&":
+		v.prompt, v.input = key[0], nil
+	case "n":
+		v.find(v.searchBack)
+	case "N":
+		v.find(!v.searchBack)
+	}
+
+	return false
+}
+
+// edit handles a key typed in the status line, applying the command on Enter.
+func (v *tuiViewer) edit(key string) {
+	switch key {
+	case "\r", "\n":
+		prompt, input := v.prompt, v.input
+		v.prompt = 0
+
+		if prompt == '&' {
+			v.filter = input
+			v.rebuild()
+			return
+		}
+		if len(input) > 0 {
+			v.search = input
+		}
+		v.searchBack = prompt == '?'
+		v.find(v.searchBack)
+	case "\x1b", "\x03", "\x07":
+		v.prompt = 0
+	case "\x7f", "\x08":
+		if len(v.input) == 0 {
+			v.prompt = 0
+			break
+		}
+		_, size := utf8.DecodeLastRune(v.input)
+		v.input = v.input[:len(v.input)-size]
+	default:
+		if key[0] >= ' ' && key[0] != 0x7f {
+			v.input = append(v.input, key...)
+		}
+	}
+}
+
+// toggle folds the group of the selected line, or unfolds it.
+func (v *tuiViewer) toggle() {
+	if len(v.rows) == 0 {
+		return
+	}
+
+	f := v.foldOf(v.rows[v.cursor])
+	if f < 0 {
+		return
+	}
+
+	v.folds[f].folded = !v.folds[f].folded
+	v.cursor = sort.SearchInts(v.rows, v.folds[f].header)
+	v.rebuild()
+}
+
+// find moves the cursor to the next line holding the search, or the previous
+// one if back is set, unfolding its group if needed.
+func (v *tuiViewer) find(back bool) {
+	if len(v.search) == 0 || len(v.rows) == 0 {
+		return
+	}
+
+	step := 1
+	if back {
+		step = -1
+	}
+
+	for i := v.rows[v.cursor] + step; i >= 0 && i < len(v.lines); i += step {
+		line := v.line(i)
+		if !bytes.Contains(line, v.search) || len(v.filter) > 0 && !bytes.Contains(line, v.filter) {
+			continue
+		}
+
+		if f := v.foldOf(i); f >= 0 && v.folds[f].header != i && v.folds[f].folded {
+			v.folds[f].folded = false
+			v.rebuild()
+		}
+
+		v.cursor = sort.SearchInts(v.rows, i)
+		return
+	}
+
+	v.message = "pattern not found: " + string(v.search)
+}
+
+// scroll keeps the cursor within the rows and on the screen.
+func (v *tuiViewer) scroll() {
+	page := v.height - 1
+
+	v.cursor = min(max(v.cursor, 0), max(len(v.rows)-1, 0))
+	v.top = min(max(v.top, 0), max(len(v.rows)-page, 0))
+
+	if v.cursor < v.top {
+		v.top = v.cursor
+	}
+	if v.cursor >= v.top+page {
+		v.top = v.cursor - page + 1
+	}
+}
+
+// draw returns the escape sequences drawing the screen: the rows, followed by
+// the status line.
+func (v *tuiViewer) draw() []byte {
+	var b []byte
+	b = append(b, "\x1b[H"...)
+
+	for r := 0; r < v.height-1; r++ {
+		b = append(b, "\x1b[2K"...)
+
+		if v.top+r < len(v.rows) {
+			row := v.top + r
+			if row == v.cursor {
+				b = append(b, "\x1b[7m"...)
+			}
+			b = appendTruncated(b, v.rowText(v.rows[row]), v.width)
+			if row == v.cursor {
+				b = append(b, "\x1b[0m"...)
+			}
+		}
+		b = append(b, "\r\n"...)
+	}
+
+	var status []byte
+	switch {
+	case v.prompt != 0:
+		status = append([]byte{v.prompt}, v.input...)
+	case v.message != "":
+		status = []byte(v.message)
+	default:
+		position := 0
+		if len(v.rows) > 0 {
+			position = v.cursor + 1
+		}
+		status = fmt.Appendf(nil, "%d/%d", position, len(v.rows))
+		if len(v.filter) > 0 {
+			status = fmt.Appendf(status, "  filter: %s", v.filter)
+		}
+		status = append(status, "  "+tuiHelp...)
+	}
+
+	b = append(b, "\x1b[2K\x1b[7m"...)
+	b = appendTruncated(b, status, v.width)
+	b = append(b, "\x1b[0m"...)
+
+	return b
+}
+
+// rowText returns the text shown for line i. Group headers are marked as
+// folded or not and followed by the number of lines of their group, and the
+// lines of groups are indented under them.
+func (v *tuiViewer) rowText(i int) []byte {
+	f := v.foldOf(i)
+	if f < 0 {
+		return v.line(i)
+	}
+
+	fold := v.folds[f]
+	if fold.header != i {
+		return append([]byte("    "), v.line(i)...)
+	}
+
+	text := []byte("- ")
+	if fold.folded {
+		text = []byte("+ ")
+	}
+	text = append(text, v.line(i)...)
+	text = append(text, " ("...)
+	text = strconv.AppendInt(text, int64(fold.end-fold.header-1), 10)
+	return append(text, " lines)"...)
+}
+
+// appendTruncated appends s to b, cut to width characters. Control characters
+// are replaced, so that they cannot garble the screen.
+func appendTruncated(b, s []byte, width int) []byte {
+	for n := 0; len(s) > 0 && n < width; n++ {
+		r, size := utf8.DecodeRune(s)
+		if r < ' ' || r == 0x7f {
+			r = '?'
+		}
+		b = utf8.AppendRune(b, r)
+		s = s[size:]
+	}
+
+	return b
+}
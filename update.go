@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// updateOptions holds the command-line options of the update command.
+type updateOptions struct {
+	list    bool
+	force   bool
+	offline bool
+}
+
+// newUpdateCmd creates the update subcommand.
+func newUpdateCmd() *cobra.Command {
+	opts := &updateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "update [dataset...]",
+		Short: "Download the datasets used by other commands",
+		Long: "Download the external datasets that can be used by name with --exclude-feed,\n" +
+			"such as bogons, verify them and store them in the data directory. Datasets\n" +
+			"are only downloaded again once older than their TTL, unless --force is\n" +
+			"given. With no arguments, every dataset is updated.\n\n" +
+			"Datasets used with --exclude-feed are also updated when stale, unless\n" +
+			"--offline is given.",
+		Example: "  cidrex update\n" +
+			"  cidrex update bogons aws\n" +
+			"  cidrex update --list\n" +
+			"  cidrex --exclude-feed bogons scope.txt",
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runUpdate(opts, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.list, "list", "l", false, "List the datasets, their TTL and the age of their stored copy instead of updating them")
+	flags.BoolVarP(&opts.force, "force", "f", false, "Download the datasets even if their stored copy is fresh")
+	flags.BoolVar(&opts.offline, "offline", false, "Only verify the stored copies of the datasets, never going to the network")
+
+	return cmd
+}
+
+// runUpdate updates the given datasets, or all of them.
+func runUpdate(opts *updateOptions, args []string) error {
+	selected := datasets
+	if len(args) > 0 {
+		selected = nil
+		for _, arg := range args {
+			d, ok := findDataset(arg)
+			if !ok {
+				return fmt.Errorf("unknown dataset: %s", arg)
+			}
+			selected = append(selected, d)
+		}
+	}
+
+	if opts.list {
+		return listDatasets(os.Stdout, selected)
+	}
+
+	failed := 0
+	for _, d := range selected {
+		status, err := updateDataset(d, opts)
+		if err != nil {
+			slog.Warn("unable to update dataset", "dataset", d.name, "error", err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s: %s\n", d.name, status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to update %d of %d datasets", failed, len(selected))
+	}
+
+	return nil
+}
+
+// updateDataset updates a single dataset as requested, and describes what was
+// done.
+func updateDataset(d dataset, opts *updateOptions) (string, error) {
+	age, err := d.age()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	stored := err == nil
+
+	if opts.offline || stored && age < d.ttl && !opts.force {
+		if !stored {
+			return "", fmt.Errorf("never downloaded, and --offline was given")
+		}
+
+		data, err := d.load(true)
+		if err != nil {
+			return "", err
+		}
+
+		set := &rangeSet{}
+		if err := parseFeed(bytes.NewReader(data), set); err != nil || set.set.Len() == 0 {
+			return "", fmt.Errorf("stored copy is corrupt, update it with --force")
+		}
+
+		state := "up to date"
+		if age >= d.ttl {
+			state = "stale"
+		}
+
+		return fmt.Sprintf("%s, %d prefixes, updated %s ago", state, set.set.Len(), age.Round(time.Second)), nil
+	}
+
+	_, count, err := d.update()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("updated, %d prefixes", count), nil
+}
+
+// listDatasets writes the name, TTL and age of the stored copy of datasets,
+// along with their description, as a table.
+func listDatasets(w io.Writer, datasets []dataset) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTTL\tAGE\tDESCRIPTION")
+
+	for _, d := range datasets {
+		age := "never downloaded"
+		if a, err := d.age(); err == nil {
+			age = a.Round(time.Second).String()
+			if a >= d.ttl {
+				age += " (stale)"
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.name, d.ttl, age, d.description)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the input files must stay unchanged before they
+// are expanded again, so that a burst of writes triggers a single run.
+const watchDebounce = 200 * time.Millisecond
+
+// runWatch expands the input files, then expands them again whenever they
+// change. Each run either rewrites opts.watchOutput or prints the records added
+// and removed since the previous run, prefixed with "+" and "-".
+func runWatch(opts *expandOptions, args []string) error {
+	switch {
+	case len(args) == 0 || slices.Contains(args, "-"):
+		return fmt.Errorf("--watch requires input files")
+	case opts.follow || opts.checkpoint != "" || opts.resume != "":
+		return fmt.Errorf("--watch cannot be combined with --follow, --checkpoint or --resume")
+	case opts.exec != "" || opts.pipe != "" || opts.dbDSN != "" || strings.HasPrefix(opts.output, "sqlite:") || strings.HasPrefix(opts.output, "parquet:"):
+		return fmt.Errorf("--watch can only be used with outputs written to stdout")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("unable to watch input files: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directories, since editors often replace files when saving
+	watched := make(map[string]bool)
+	for _, name := range args {
+		path, err := filepath.Abs(name)
+		if err != nil {
+			return err
+		}
+		watched[path] = true
+
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("unable to watch %s: %w", name, err)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var previous []string
+	run := func() error {
+		if opts.watchOutput != "" {
+			return expandToFile(opts, args, opts.watchOutput)
+		}
+
+		current, err := expandLines(opts, args)
+		if err != nil {
+			return err
+		}
+
+		err = printDiff(os.Stdout, previous, current)
+		previous = current
+		return err
+	}
+
+	if err := run(); err != nil {
+		return err
+	}
+
+	// A nil channel blocks until the timer is armed by a change
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if path, err := filepath.Abs(event.Name); err == nil && watched[path] {
+				debounce = time.After(watchDebounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("unable to watch inputs", "error", err)
+
+		case <-debounce:
+			debounce = nil
+
+			if err := run(); err != nil {
+				if err == errInterrupted {
+					return err
+				}
+
+				// Keep watching, the next change may fix the problem
+				slog.Error("run failed", "error", err)
+			}
+
+		case <-signals:
+			return errInterrupted
+		}
+	}
+}
+
+// expandLines expands the input files and returns the output lines.
+func expandLines(opts *expandOptions, args []string) ([]string, error) {
+	var buf bytes.Buffer
+	if err := expandTo(opts, args, &buf); err != nil && !isInvalidInput(err) {
+		return nil, err
+	}
+
+	return strings.SplitAfter(buf.String(), "\n"), nil
+}
+
+// printDiff prints the lines of current missing from previous prefixed with
+// "+", then the lines of previous missing from current prefixed with "-",
+// each in their original order.
+func printDiff(w io.Writer, previous, current []string) error {
+	before := make(map[string]bool, len(previous))
+	for _, line := range previous {
+		before[line] = true
+	}
+
+	after := make(map[string]bool, len(current))
+	for _, line := range current {
+		after[line] = true
+	}
+
+	writer := newOutputWriter(w, defaultBufferSize, 0)
+
+	for _, line := range current {
+		if line != "" && !before[line] {
+			if _, err := io.WriteString(writer, "+"+line); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+	}
+
+	for _, line := range previous {
+		if line != "" && !after[line] {
+			if _, err := io.WriteString(writer, "-"+line); err != nil {
+				writer.Close()
+				return err
+			}
+		}
+	}
+
+	return writer.Close()
+}
+
+// expandToFile expands the input files into a temporary file, then renames it
+// over filename, so that readers never see a partial output.
+func expandToFile(opts *expandOptions, args []string, filename string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := expandTo(opts, args, tmp); err != nil && !isInvalidInput(err) {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+
+	slog.Info("updated output", "file", filename, "time", time.Now().Format(time.TimeOnly))
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// whereEnv holds the variables available to --where expressions, describing
+// the address being filtered and where it came from.
+type whereEnv struct {
+	IP          string `expr:"ip"`
+	Version     int    `expr:"version"`
+	LastOctet   int    `expr:"last_octet"`
+	Private     bool   `expr:"private"`
+	Loopback    bool   `expr:"loopback"`
+	LinkLocal   bool   `expr:"link_local"`
+	Multicast   bool   `expr:"multicast"`
+	Unspecified bool   `expr:"unspecified"`
+	Global      bool   `expr:"global"`
+	Entry       string `expr:"entry"`
+	Source      string `expr:"source"`
+	ASN         int    `expr:"asn"`
+}
+
+// whereFilter keeps the addresses matching an expression, such as
+// `!private && last_octet in [1, 254]`, written in the expr language. Besides
+// the variables of whereEnv, expressions can call in_cidr(ip, "10.0.0.0/8"),
+// which reports whether ip is in the given prefix. A whereFilter is not safe
+// for concurrent use.
+type whereFilter struct {
+	program *vm.Program
+	machine vm.VM
+
+	// prefixes caches the prefixes of in_cidr, which are constants in
+	// practice
+	prefixes map[string]netip.Prefix
+}
+
+// newWhereFilter compiles the expression of --where.
+func newWhereFilter(expression string) (*whereFilter, error) {
+	f := &whereFilter{prefixes: make(map[string]netip.Prefix)}
+
+	program, err := expr.Compile(expression,
+		expr.Env(whereEnv{}),
+		expr.AsBool(),
+		expr.Function("in_cidr", f.inCIDR, new(func(string, string) bool)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --where expression: %w", err)
+	}
+
+	f.program = program
+	return f, nil
+}
+
+// match reports whether the address of rec, read from source, satisfies the
+// expression.
+func (f *whereFilter) match(rec record, source string) (bool, error) {
+	addr := rec.addr
+	env := whereEnv{
+		IP:          addr.String(),
+		Version:     4,
+		LastOctet:   int(addr.As16()[15]),
+		Private:     addr.IsPrivate(),
+		Loopback:    addr.IsLoopback(),
+		LinkLocal:   addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast(),
+		Multicast:   addr.IsMulticast(),
+		Unspecified: addr.IsUnspecified(),
+		Global:      addr.IsGlobalUnicast() && !addr.IsPrivate(),
+		Entry:       rec.entry,
+		Source:      source,
+	}
+	if addr.Is6() {
+		env.Version = 6
+	}
+	if asn, ok := parseASN(rec.entry); ok {
+		env.ASN = int(asn)
+	}
+
+	out, err := f.machine.Run(f.program, env)
+	if err != nil {
+		return false, fmt.Errorf("--where expression failed on %s: %w", addr, err)
+	}
+
+	return out.(bool), nil
+}
+
+// inCIDR implements in_cidr(ip, cidr).
+func (f *whereFilter) inCIDR(args ...any) (any, error) {
+	ip, cidr := args[0].(string), args[1].(string)
+
+	prefix, ok := f.prefixes[cidr]
+	if !ok {
+		var err error
+		if prefix, err = netip.ParsePrefix(cidr); err != nil {
+			return nil, fmt.Errorf("in_cidr: %w", err)
+		}
+		prefix = prefix.Masked()
+		f.prefixes[cidr] = prefix
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("in_cidr: %w", err)
+	}
+
+	return prefix.Contains(addr.WithZone("")), nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d3mondev/cidrex/pkg/cidrex"
+)
+
+// rdapURL is the RDAP bootstrap service redirecting the lookups of an address
+// to the registry it was allocated by.
+const rdapURL = "https://rdap.org/ip/%s"
+
+// rdapNetwork is the part of an RDAP IP network object, as defined by RFC 9083,
+// that annotations are made of. Cidrs are listed by the cidr0 extension.
+type rdapNetwork struct {
+	Name         string       `json:"name"`
+	StartAddress string       `json:"startAddress"`
+	EndAddress   string       `json:"endAddress"`
+	Cidrs        []rdapCidr   `json:"cidr0_cidrs"`
+	Entities     []rdapEntity `json:"entities"`
+}
+
+// rdapCidr is a prefix of an RDAP network.
+type rdapCidr struct {
+	V4Prefix string `json:"v4prefix"`
+	V6Prefix string `json:"v6prefix"`
+	Length   int    `json:"length"`
+}
+
+// rdapEntity is a contact of an RDAP network, such as its registrant.
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VCardArray []json.RawMessage `json:"vcardArray"`
+}
+
+// name returns the formatted name of the entity, from the fn property of its
+// jCard, or "" if it has none.
+func (e rdapEntity) name() string {
+	if len(e.VCardArray) != 2 {
+		return ""
+	}
+
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(e.VCardArray[1], &props); err != nil {
+		return ""
+	}
+
+	for _, prop := range props {
+		var name, value string
+		if len(prop) == 4 && json.Unmarshal(prop[0], &name) == nil && name == "fn" && json.Unmarshal(prop[3], &value) == nil {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// whoisAnnotator annotates addresses with the name, organization and prefix
+// of the allocation they belong to, looked up over RDAP. Each allocation is
+// only looked up once, for its first address, and responses are cached like
+// feeds.
+type whoisAnnotator struct {
+	feeds    feedCache
+	limiter  lookupLimiter
+	networks networkAnnotations
+}
+
+// newWhoisAnnotator creates a whoisAnnotator using cached responses as told by
+// feeds, and spacing out lookups by at least interval.
+func newWhoisAnnotator(feeds feedCache, interval time.Duration) *whoisAnnotator {
+	return &whoisAnnotator{feeds: feeds, limiter: lookupLimiter{interval: interval}}
+}
+
+func (a *whoisAnnotator) annotate(addr netip.Addr) string {
+	addr = addr.WithZone("")
+
+	if annotation, ok := a.networks.get(addr); ok {
+		return annotation
+	}
+
+	networks, err := a.lookup(addr)
+	if err != nil {
+		slog.Warn("unable to look up address", "addr", addr, "error", err)
+
+		// Leave the rest of the block unannotated rather than failing once
+		// per address
+		networks = []annotatedNetwork{{prefix: annotationBlock(addr)}}
+	}
+
+	for _, n := range networks {
+		a.networks.add(n.prefix, n.annotation)
+	}
+
+	annotation, _ := a.networks.get(addr)
+	return annotation
+}
+
+// lookup returns the prefixes of the allocation addr belongs to, one of which
+// holds it.
+func (a *whoisAnnotator) lookup(addr netip.Addr) ([]annotatedNetwork, error) {
+	data, err := readFeedWith(fmt.Sprintf(rdapURL, addr), a.feeds, func(url string) ([]byte, error) {
+		a.limiter.wait()
+		return downloadFeed(url)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp rdapNetwork
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid RDAP response: %w", err)
+	}
+
+	first, err := netip.ParseAddr(resp.StartAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start address in RDAP response: %s", resp.StartAddress)
+	}
+
+	last, err := netip.ParseAddr(resp.EndAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end address in RDAP response: %s", resp.EndAddress)
+	}
+
+	if first.Compare(addr) > 0 || addr.Compare(last) > 0 {
+		return nil, fmt.Errorf("RDAP response for %s-%s does not hold the address", first, last)
+	}
+
+	var org string
+	for _, entity := range resp.Entities {
+		if slices.Contains(entity.Roles, "registrant") {
+			org = entity.name()
+			break
+		}
+	}
+
+	// The range of the allocation is made of the prefixes of the cidr0
+	// extension, if listed, or else of those covering it
+	prefixes := cidrex.RangePrefixes(first, last)
+	if cidrs := rdapPrefixes(resp.Cidrs); slices.ContainsFunc(cidrs, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+		prefixes = cidrs
+	}
+
+	networks := make([]annotatedNetwork, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		networks = append(networks, annotatedNetwork{prefix: prefix, annotation: whoisAnnotation(resp.Name, org, prefix)})
+	}
+
+	return networks, nil
+}
+
+// rdapPrefixes returns the valid prefixes of an RDAP network.
+func rdapPrefixes(cidrs []rdapCidr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, c := range cidrs {
+		base := c.V4Prefix
+		if base == "" {
+			base = c.V6Prefix
+		}
+
+		if addr, err := netip.ParseAddr(base); err == nil {
+			if prefix, err := addr.Prefix(c.Length); err == nil {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+
+	return prefixes
+}
+
+// whoisAnnotation formats the annotation of an allocation, such as
+// netname=EXAMPLE-NET org="Example Org" cidr=192.0.2.0/24, leaving out the
+// name and organization if unknown.
+func whoisAnnotation(name, org string, prefix netip.Prefix) string {
+	var parts []string
+	if name != "" {
+		parts = append(parts, "netname="+name)
+	}
+	if org != "" {
+		parts = append(parts, "org="+strconv.Quote(org))
+	}
+	parts = append(parts, "cidr="+prefix.String())
+
+	return strings.Join(parts, " ")
+}